@@ -37,6 +37,16 @@ func init() {
 	l.Debugf("Setting log level to %s", level.String())
 }
 
+// Fields holds structured key/value pairs which are added to a log entry
+type Fields map[string]interface{}
+
+// WithFields returns an entry of the standard logger with the given fields, e.g.
+//
+//	log.WithFields(log.Fields{"topic": m.Topic, "offset": m.Offset}).Debug("message processed")
+func WithFields(fields Fields) *l.Entry {
+	return l.WithFields(l.Fields(fields))
+}
+
 // Debug logs a message at level Debug on the standard logger.
 func Debug(args ...interface{}) {
 	l.Debug(args...)
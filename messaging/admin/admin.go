@@ -0,0 +1,272 @@
+// Package admin manages the kafka topics used by a service, it lists, describes and creates topics and makes sure
+// the topics of a service exist when it starts.
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TopicSpec describes the expected settings of a topic
+type TopicSpec struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	// Configs are topic level configs like retention.ms, they are set when the topic is created and checked on
+	// existing topics
+	Configs map[string]string
+	// ExistenceOnly only checks that an existing topic exists, the settings are used to create a missing topic
+	ExistenceOnly bool
+}
+
+// TopicInfo describes an existing topic
+type TopicInfo struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	// Configs are the topic level configs including the broker defaults, configs with a hidden value are left out
+	Configs map[string]string
+}
+
+// MismatchError is returned by EnsureTopics when existing topics do not match their spec
+type MismatchError struct {
+	Problems []string
+}
+
+// Error returns all problems found
+func (e *MismatchError) Error() string {
+	return "kafka topics do not match their spec: " + strings.Join(e.Problems, "; ")
+}
+
+// conn is the part of a kafka connection used by the client, it is implemented by *brokerConn
+type conn interface {
+	ReadPartitions(topics ...string) ([]kafka.Partition, error)
+	CreateTopics(topics ...kafka.TopicConfig) error
+	Controller() (kafka.Broker, error)
+	DescribeConfigs(ctx context.Context, topics ...string) (map[string]map[string]string, error)
+	Close() error
+}
+
+// Client manages the topics of a kafka cluster
+type Client struct {
+	brokers []string
+	dial    func(ctx context.Context, address string) (conn, error)
+}
+
+// NewClient returns a client for the cluster of the given brokers
+func NewClient(brokers []string) *Client {
+	return &Client{brokers: brokers, dial: dialBroker}
+}
+
+// ListTopics returns the names of all topics sorted by name
+func (c *Client) ListTopics(ctx context.Context) ([]string, error) {
+	infos, err := c.topics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(infos))
+	for name := range infos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DescribeTopics returns the partitions, replication factor and configs of the given topics, unknown topics are left
+// out
+func (c *Client) DescribeTopics(ctx context.Context, names ...string) ([]TopicInfo, error) {
+	infos, err := c.topics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var described []TopicInfo
+	for _, name := range names {
+		if info, ok := infos[name]; ok {
+			described = append(described, info)
+		}
+	}
+	if len(described) == 0 {
+		return described, nil
+	}
+
+	existing := make([]string, len(described))
+	for i, info := range described {
+		existing[i] = info.Name
+	}
+	configs, err := c.configs(ctx, existing...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range described {
+		described[i].Configs = configs[described[i].Name]
+	}
+	return described, nil
+}
+
+// CreateTopics creates topics with the given specs on the controller of the cluster
+func (c *Client) CreateTopics(ctx context.Context, specs ...TopicSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	controller, err := c.controller(ctx)
+	if err != nil {
+		return err
+	}
+	defer controller.Close()
+
+	configs := make([]kafka.TopicConfig, len(specs))
+	for i, spec := range specs {
+		configs[i] = kafka.TopicConfig{
+			Topic:             spec.Name,
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+		}
+		for _, name := range sortedKeys(spec.Configs) {
+			configs[i].ConfigEntries = append(configs[i].ConfigEntries, kafka.ConfigEntry{ConfigName: name, ConfigValue: spec.Configs[name]})
+		}
+	}
+	return controller.CreateTopics(configs...)
+}
+
+// EnsureTopics creates missing topics and checks the partitions, replication factor and configs of existing topics,
+// a *MismatchError lists all topics which do not match their spec
+func (c *Client) EnsureTopics(ctx context.Context, specs ...TopicSpec) error {
+	infos, err := c.topics(ctx)
+	if err != nil {
+		return err
+	}
+
+	var missing []TopicSpec
+	var configured []string
+	var problems []string
+	for _, spec := range specs {
+		info, ok := infos[spec.Name]
+		if !ok {
+			missing = append(missing, spec)
+			continue
+		}
+		if spec.ExistenceOnly {
+			continue
+		}
+		if info.Partitions != spec.Partitions {
+			problems = append(problems, fmt.Sprintf("topic %s has %d partitions instead of %d", spec.Name, info.Partitions, spec.Partitions))
+		}
+		if info.ReplicationFactor != spec.ReplicationFactor {
+			problems = append(problems, fmt.Sprintf("topic %s has replication factor %d instead of %d", spec.Name, info.ReplicationFactor, spec.ReplicationFactor))
+		}
+		if len(spec.Configs) > 0 {
+			configured = append(configured, spec.Name)
+		}
+	}
+
+	if len(configured) > 0 {
+		configs, err := c.configs(ctx, configured...)
+		if err != nil {
+			return err
+		}
+		for _, spec := range specs {
+			existing, ok := configs[spec.Name]
+			if !ok {
+				continue
+			}
+			for _, name := range sortedKeys(spec.Configs) {
+				if value, set := existing[name]; !set || value != spec.Configs[name] {
+					problems = append(problems, fmt.Sprintf("topic %s has %s %q instead of %q", spec.Name, name, value, spec.Configs[name]))
+				}
+			}
+		}
+	}
+
+	if err := c.CreateTopics(ctx, missing...); err != nil {
+		return fmt.Errorf("cannot create topics: %v", err)
+	}
+	if len(problems) > 0 {
+		return &MismatchError{Problems: problems}
+	}
+	return nil
+}
+
+// topics reads the metadata of all topics, reading all topics at once avoids creating topics by requesting their
+// metadata on clusters which create topics automatically
+func (c *Client) topics(ctx context.Context) (map[string]TopicInfo, error) {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cn.Close()
+
+	partitions, err := cn.ReadPartitions()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make(map[string]TopicInfo)
+	for _, p := range partitions {
+		info := infos[p.Topic]
+		info.Name = p.Topic
+		info.Partitions++
+		if len(p.Replicas) > info.ReplicationFactor {
+			info.ReplicationFactor = len(p.Replicas)
+		}
+		infos[p.Topic] = info
+	}
+	return infos, nil
+}
+
+// configs reads the configs of the given existing topics by topic name
+func (c *Client) configs(ctx context.Context, topics ...string) (map[string]map[string]string, error) {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cn.Close()
+
+	return cn.DescribeConfigs(ctx, topics...)
+}
+
+// sortedKeys returns the keys of the configs sorted by name
+func sortedKeys(configs map[string]string) []string {
+	keys := make([]string, 0, len(configs))
+	for key := range configs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// connect returns a connection to the first available broker
+func (c *Client) connect(ctx context.Context) (conn, error) {
+	var err error
+	for _, broker := range c.brokers {
+		var cn conn
+		if cn, err = c.dial(ctx, broker); err == nil {
+			return cn, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no brokers given")
+	}
+	return nil, fmt.Errorf("cannot connect to kafka: %v", err)
+}
+
+// controller returns a connection to the controller of the cluster, topics can only be created on the controller
+func (c *Client) controller(ctx context.Context) (conn, error) {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cn.Close()
+
+	broker, err := cn.Controller()
+	if err != nil {
+		return nil, fmt.Errorf("cannot find kafka controller: %v", err)
+	}
+	return c.dial(ctx, net.JoinHostPort(broker.Host, strconv.Itoa(broker.Port)))
+}
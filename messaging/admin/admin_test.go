@@ -0,0 +1,210 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeConn is a kafka connection to a cluster held in memory
+type fakeConn struct {
+	partitions []kafka.Partition
+	created    []kafka.TopicConfig
+	createErr  error
+	configs    map[string]map[string]string
+	described  [][]string
+	closed     int
+}
+
+func (c *fakeConn) ReadPartitions(topics ...string) ([]kafka.Partition, error) {
+	return c.partitions, nil
+}
+
+func (c *fakeConn) CreateTopics(topics ...kafka.TopicConfig) error {
+	if c.createErr != nil {
+		return c.createErr
+	}
+	c.created = append(c.created, topics...)
+	return nil
+}
+
+func (c *fakeConn) Controller() (kafka.Broker, error) {
+	return kafka.Broker{Host: "controller", Port: 9092}, nil
+}
+
+func (c *fakeConn) DescribeConfigs(ctx context.Context, topics ...string) (map[string]map[string]string, error) {
+	c.described = append(c.described, topics)
+	configs := make(map[string]map[string]string)
+	for _, topic := range topics {
+		configs[topic] = c.configs[topic]
+	}
+	return configs, nil
+}
+
+func (c *fakeConn) Close() error {
+	c.closed++
+	return nil
+}
+
+func newFakeClient(cn *fakeConn, dialed *[]string) *Client {
+	return &Client{
+		brokers: []string{"down:9092", "up:9092"},
+		dial: func(ctx context.Context, address string) (conn, error) {
+			*dialed = append(*dialed, address)
+			if address == "down:9092" {
+				return nil, errors.New("connection refused")
+			}
+			return cn, nil
+		},
+	}
+}
+
+func partitions(topic string, count int, replicas int) []kafka.Partition {
+	var ps []kafka.Partition
+	for i := 0; i < count; i++ {
+		ps = append(ps, kafka.Partition{Topic: topic, ID: i, Replicas: make([]kafka.Broker, replicas)})
+	}
+	return ps
+}
+
+func TestClient_ListAndDescribeTopics(t *testing.T) {
+	cn := &fakeConn{
+		partitions: append(partitions("orders", 3, 2), partitions("audit", 1, 1)...),
+		configs:    map[string]map[string]string{"orders": {"retention.ms": "604800000"}},
+	}
+	var dialed []string
+	client := newFakeClient(cn, &dialed)
+
+	names, err := client.ListTopics(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error listing topics: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"audit", "orders"}) {
+		t.Errorf("Expected topics audit and orders, got %v", names)
+	}
+
+	infos, err := client.DescribeTopics(context.Background(), "orders", "unknown")
+	if err != nil {
+		t.Fatalf("Unexpected error describing topics: %v", err)
+	}
+	expected := []TopicInfo{{Name: "orders", Partitions: 3, ReplicationFactor: 2, Configs: map[string]string{"retention.ms": "604800000"}}}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Errorf("Expected %v, got %v", expected, infos)
+	}
+	if dialed[0] != "down:9092" || dialed[1] != "up:9092" {
+		t.Errorf("Expected the next broker to be used when one is down, dialed %v", dialed)
+	}
+}
+
+func TestClient_EnsureTopicsCreatesMissingTopics(t *testing.T) {
+	cn := &fakeConn{partitions: partitions("orders", 3, 2)}
+	var dialed []string
+	client := newFakeClient(cn, &dialed)
+
+	err := client.EnsureTopics(context.Background(),
+		TopicSpec{Name: "orders", Partitions: 3, ReplicationFactor: 2},
+		TopicSpec{Name: "orders.dlq", Partitions: 1, ReplicationFactor: 2, Configs: map[string]string{"retention.ms": "604800000"}},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error ensuring topics: %v", err)
+	}
+
+	expected := []kafka.TopicConfig{{
+		Topic:             "orders.dlq",
+		NumPartitions:     1,
+		ReplicationFactor: 2,
+		ConfigEntries:     []kafka.ConfigEntry{{ConfigName: "retention.ms", ConfigValue: "604800000"}},
+	}}
+	if !reflect.DeepEqual(cn.created, expected) {
+		t.Errorf("Expected %v to be created, got %v", expected, cn.created)
+	}
+	if dialed[len(dialed)-1] != "controller:9092" {
+		t.Errorf("Expected topics to be created on the controller, dialed %v", dialed)
+	}
+}
+
+func TestClient_EnsureTopicsReportsMismatches(t *testing.T) {
+	cn := &fakeConn{partitions: partitions("orders", 1, 1)}
+	var dialed []string
+	client := newFakeClient(cn, &dialed)
+
+	err := client.EnsureTopics(context.Background(), TopicSpec{Name: "orders", Partitions: 3, ReplicationFactor: 2})
+	mismatch, ok := err.(*MismatchError)
+	if !ok {
+		t.Fatalf("Expected a *MismatchError, got %v", err)
+	}
+	expected := "kafka topics do not match their spec: topic orders has 1 partitions instead of 3; topic orders has replication factor 1 instead of 2"
+	if mismatch.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, mismatch.Error())
+	}
+	if len(cn.created) != 0 {
+		t.Errorf("Expected no topics to be created, got %v", cn.created)
+	}
+}
+
+func TestClient_EnsureTopicsChecksConfigs(t *testing.T) {
+	cn := &fakeConn{
+		partitions: append(partitions("orders", 3, 2), partitions("audit", 1, 1)...),
+		configs:    map[string]map[string]string{"orders": {"retention.ms": "86400000", "cleanup.policy": "delete"}},
+	}
+	var dialed []string
+	client := newFakeClient(cn, &dialed)
+
+	err := client.EnsureTopics(context.Background(),
+		TopicSpec{Name: "orders", Partitions: 3, ReplicationFactor: 2, Configs: map[string]string{"retention.ms": "604800000", "cleanup.policy": "delete"}},
+		TopicSpec{Name: "audit", Partitions: 1, ReplicationFactor: 1},
+	)
+	expected := `kafka topics do not match their spec: topic orders has retention.ms "86400000" instead of "604800000"`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+	if !reflect.DeepEqual(cn.described, [][]string{{"orders"}}) {
+		t.Errorf("Expected only the configs of orders to be described, got %v", cn.described)
+	}
+}
+
+func TestClient_EnsureTopicsExistenceOnly(t *testing.T) {
+	cn := &fakeConn{partitions: partitions("orders", 1, 1)}
+	var dialed []string
+	client := newFakeClient(cn, &dialed)
+
+	err := client.EnsureTopics(context.Background(),
+		TopicSpec{Name: "orders", Partitions: 3, ReplicationFactor: 2, Configs: map[string]string{"retention.ms": "604800000"}, ExistenceOnly: true},
+		TopicSpec{Name: "orders.dlq", Partitions: 3, ReplicationFactor: 2, ExistenceOnly: true},
+	)
+	if err != nil {
+		t.Fatalf("Expected the settings of existing topics not to be checked, got %v", err)
+	}
+	if len(cn.described) != 0 {
+		t.Errorf("Expected no configs to be described, got %v", cn.described)
+	}
+	if len(cn.created) != 1 || cn.created[0].Topic != "orders.dlq" || cn.created[0].NumPartitions != 3 {
+		t.Errorf("Expected orders.dlq to be created with its settings, got %v", cn.created)
+	}
+}
+
+func TestClient_EnsureTopicsCreateFails(t *testing.T) {
+	cn := &fakeConn{createErr: errors.New("not authorized")}
+	var dialed []string
+	client := newFakeClient(cn, &dialed)
+
+	err := client.EnsureTopics(context.Background(), TopicSpec{Name: "orders", Partitions: 1, ReplicationFactor: 1})
+	if err == nil || err.Error() != "cannot create topics: not authorized" {
+		t.Errorf("Expected the create error to be returned, got %v", err)
+	}
+}
+
+func TestClient_NoBrokerAvailable(t *testing.T) {
+	client := &Client{
+		brokers: []string{"down:9092"},
+		dial: func(ctx context.Context, address string) (conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+	if _, err := client.ListTopics(context.Background()); err == nil || err.Error() != "cannot connect to kafka: connection refused" {
+		t.Errorf("Expected a connection error, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package admin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafka-go does not implement the DescribeConfigs request, so it is sent on a connection of its own
+
+const (
+	describeConfigsKey     = 32
+	describeConfigsVersion = 0
+	topicResourceType      = 2
+	describeConfigsClient  = "missy-admin"
+)
+
+// defaultDescribeConfigsTimeout limits describing configs when the context has no deadline
+const defaultDescribeConfigsTimeout = time.Second * 10
+
+// brokerConn is a kafka connection which can describe the configs of topics
+type brokerConn struct {
+	*kafka.Conn
+	address string
+}
+
+// dialBroker connects to the broker
+func dialBroker(ctx context.Context, address string) (conn, error) {
+	c, err := kafka.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &brokerConn{Conn: c, address: address}, nil
+}
+
+// DescribeConfigs returns the configs of the topics by topic name, configs with a hidden value are left out. The
+// request is sent until the deadline of the context or defaultDescribeConfigsTimeout if it has none.
+func (c *brokerConn) DescribeConfigs(ctx context.Context, topics ...string) (map[string]map[string]string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultDescribeConfigsTimeout)
+		defer cancel()
+	}
+	nc, err := (&net.Dialer{}).DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return nil, err
+	}
+	defer nc.Close()
+	deadline, _ := ctx.Deadline()
+	if err := nc.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	return describeConfigs(nc, topics)
+}
+
+// describeConfigs sends a DescribeConfigs request for all configs of the topics and reads the response
+func describeConfigs(rw io.ReadWriter, topics []string) (map[string]map[string]string, error) {
+	var body bytes.Buffer
+	writeInt16(&body, describeConfigsKey)
+	writeInt16(&body, describeConfigsVersion)
+	writeInt32(&body, 1) // correlation id
+	writeString(&body, describeConfigsClient)
+	writeInt32(&body, int32(len(topics)))
+	for _, topic := range topics {
+		body.WriteByte(topicResourceType)
+		writeString(&body, topic)
+		writeInt32(&body, -1) // all config names
+	}
+
+	var request bytes.Buffer
+	writeInt32(&request, int32(body.Len()))
+	body.WriteTo(&request)
+	if _, err := rw.Write(request.Bytes()); err != nil {
+		return nil, err
+	}
+
+	r := &responseReader{r: bufio.NewReader(rw)}
+	r.int32() // size
+	r.int32() // correlation id
+	r.int32() // throttle time
+	configs := make(map[string]map[string]string)
+	for resources := r.int32(); resources > 0 && r.err == nil; resources-- {
+		code := r.int16()
+		message, _ := r.nullableString()
+		r.int8() // resource type
+		name := r.string()
+		entries := make(map[string]string)
+		for count := r.int32(); count > 0 && r.err == nil; count-- {
+			entry := r.string()
+			value, ok := r.nullableString()
+			r.int8() // read only
+			r.int8() // default
+			r.int8() // sensitive
+			if ok {
+				entries[entry] = value
+			}
+		}
+		if r.err == nil && code != 0 {
+			return nil, fmt.Errorf("cannot describe configs of topic %s: kafka error %d %s", name, code, message)
+		}
+		configs[name] = entries
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("cannot read configs: %v", r.err)
+	}
+	return configs, nil
+}
+
+func writeInt16(b *bytes.Buffer, v int16) {
+	binary.Write(b, binary.BigEndian, v)
+}
+
+func writeInt32(b *bytes.Buffer, v int32) {
+	binary.Write(b, binary.BigEndian, v)
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	writeInt16(b, int16(len(s)))
+	b.WriteString(s)
+}
+
+// responseReader reads the fields of a kafka response, the first error is kept and stops reading
+type responseReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (r *responseReader) read(v interface{}) {
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.BigEndian, v)
+	}
+}
+
+func (r *responseReader) int8() (v int8) {
+	r.read(&v)
+	return v
+}
+
+func (r *responseReader) int16() (v int16) {
+	r.read(&v)
+	return v
+}
+
+func (r *responseReader) int32() (v int32) {
+	r.read(&v)
+	return v
+}
+
+func (r *responseReader) string() string {
+	s, _ := r.nullableString()
+	return s
+}
+
+// nullableString returns false for a null string
+func (r *responseReader) nullableString() (string, bool) {
+	n := r.int16()
+	if r.err != nil || n < 0 {
+		return "", false
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.err = err
+		return "", false
+	}
+	return string(b), true
+}
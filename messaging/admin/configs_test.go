@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// describeConfigsResponse encodes a DescribeConfigs response with the given resources
+func describeConfigsResponse(resources ...func(b *bytes.Buffer)) []byte {
+	var body bytes.Buffer
+	writeInt32(&body, 1) // correlation id
+	writeInt32(&body, 0) // throttle time
+	writeInt32(&body, int32(len(resources)))
+	for _, resource := range resources {
+		resource(&body)
+	}
+	var response bytes.Buffer
+	writeInt32(&response, int32(body.Len()))
+	body.WriteTo(&response)
+	return response.Bytes()
+}
+
+func TestDescribeConfigs(t *testing.T) {
+	client, broker := net.Pipe()
+	defer client.Close()
+
+	requests := make(chan []byte, 1)
+	go func() {
+		defer broker.Close()
+		var size int32
+		if err := binary.Read(broker, binary.BigEndian, &size); err != nil {
+			return
+		}
+		request := make([]byte, size)
+		io.ReadFull(broker, request)
+		requests <- request
+
+		broker.Write(describeConfigsResponse(func(b *bytes.Buffer) {
+			writeInt16(b, 0)  // error code
+			writeInt16(b, -1) // no error message
+			b.WriteByte(topicResourceType)
+			writeString(b, "orders")
+			writeInt32(b, 2)
+			writeString(b, "retention.ms")
+			writeString(b, "604800000")
+			b.Write([]byte{0, 0, 0})
+			writeString(b, "sasl.jaas.config")
+			writeInt16(b, -1) // hidden value
+			b.Write([]byte{0, 0, 1})
+		}))
+	}()
+
+	configs, err := describeConfigs(client, []string{"orders"})
+	if err != nil {
+		t.Fatalf("Unexpected error describing configs: %v", err)
+	}
+	expected := map[string]map[string]string{"orders": {"retention.ms": "604800000"}}
+	if !reflect.DeepEqual(configs, expected) {
+		t.Errorf("Expected %v, got %v", expected, configs)
+	}
+
+	var want bytes.Buffer
+	writeInt16(&want, describeConfigsKey)
+	writeInt16(&want, describeConfigsVersion)
+	writeInt32(&want, 1)
+	writeString(&want, describeConfigsClient)
+	writeInt32(&want, 1)
+	want.WriteByte(topicResourceType)
+	writeString(&want, "orders")
+	writeInt32(&want, -1)
+	if request := <-requests; !bytes.Equal(request, want.Bytes()) {
+		t.Errorf("Expected request %v, got %v", want.Bytes(), request)
+	}
+}
+
+func TestDescribeConfigs_Error(t *testing.T) {
+	client, broker := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		defer broker.Close()
+		var size int32
+		binary.Read(broker, binary.BigEndian, &size)
+		io.ReadFull(broker, make([]byte, size))
+		broker.Write(describeConfigsResponse(func(b *bytes.Buffer) {
+			writeInt16(b, 29) // topic authorization failed
+			writeString(b, "not authorized")
+			b.WriteByte(topicResourceType)
+			writeString(b, "orders")
+			writeInt32(b, 0)
+		}))
+	}()
+
+	_, err := describeConfigs(client, []string{"orders"})
+	if err == nil || err.Error() != "cannot describe configs of topic orders: kafka error 29 not authorized" {
+		t.Errorf("Expected the kafka error to be returned, got %v", err)
+	}
+}
+
+func TestBrokerConn_DescribeConfigsTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		// a hung broker accepts the connection but never answers
+		nc, err := listener.Accept()
+		if err == nil {
+			defer nc.Close()
+			io.Copy(ioutil.Discard, nc)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	c := &brokerConn{address: listener.Addr().String()}
+	if _, err := c.DescribeConfigs(ctx, "orders"); err == nil {
+		t.Error("Expected an error for a broker which does not answer")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected DescribeConfigs to give up at the deadline of the context, took %s", elapsed)
+	}
+}
@@ -0,0 +1,160 @@
+package admin
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/microdevs/missy/log"
+	"github.com/microdevs/missy/messaging"
+	"github.com/microdevs/missy/service"
+)
+
+const defaultTopicPartitions = 1
+const defaultTopicReplicationFactor = 1
+const defaultEnsureTopicsTimeout = time.Second * 30
+
+// ensureTopicsRetryInterval is the time waited before the topics are ensured again after a failure
+const ensureTopicsRetryInterval = time.Second * 10
+
+const (
+	kafkaEnsureTopics           = "kafka.ensure.topics"
+	kafkaTopicPartitions        = "kafka.topic.partitions"
+	kafkaTopicReplicationFactor = "kafka.topic.replication.factor"
+	kafkaEnsureTopicsTimeout    = "kafka.ensure.topics.timeout"
+	readinessCheckName          = "kafka topics"
+)
+
+func init() {
+	cfg := service.Config()
+	cfg.RegisterOptionalParameter("KAFKA_ENSURE_TOPICS", "false", kafkaEnsureTopics, "Create missing topics and check existing topics when the service starts")
+	cfg.RegisterOptionalParameter("KAFKA_TOPIC_PARTITIONS", strconv.Itoa(defaultTopicPartitions), kafkaTopicPartitions, "The number of partitions of topics created at startup")
+	cfg.RegisterOptionalParameter("KAFKA_TOPIC_REPLICATION_FACTOR", strconv.Itoa(defaultTopicReplicationFactor), kafkaTopicReplicationFactor, "The replication factor of topics created at startup")
+	cfg.RegisterOptionalParameter("KAFKA_ENSURE_TOPICS_TIMEOUT", defaultEnsureTopicsTimeout.String(), kafkaEnsureTopicsTimeout, "The time the topics are checked at startup before giving up")
+	cfg.Parse()
+}
+
+// EnsureTopicsOnStartup makes sure the topics registered with messaging.RegisterTopic, including their dead letter
+// queue and retry topics, and the given additional topics exist with the expected settings. Missing registered topics
+// are created with KAFKA_TOPIC_PARTITIONS and KAFKA_TOPIC_REPLICATION_FACTOR, existing ones are only checked to exist
+// unless they are given as spec. The step is opt-in with KAFKA_ENSURE_TOPICS=true. While it fails the service is not
+// ready, the error is listed in the readiness report and the topics are ensured again in the background.
+func EnsureTopicsOnStartup(s *service.Service, specs ...TopicSpec) {
+	if enabled, _ := strconv.ParseBool(service.Config().Get(kafkaEnsureTopics)); !enabled {
+		log.Debugf("Not checking kafka topics at startup, as kafka.ensure.topics is not enabled")
+		return
+	}
+
+	check := newTopicsCheck(func() error { return ensureTopics(specs) }, ensureTopicsRetryInterval)
+	s.RegisterReadinessCheck(readinessCheckName, check.Check)
+}
+
+// topicsCheck ensures the topics until it succeeds and reports the last error
+type topicsCheck struct {
+	retryInterval time.Duration
+	err           error
+	mu            sync.Mutex
+}
+
+// newTopicsCheck ensures the topics once and retries in the background after the interval while it fails
+func newTopicsCheck(ensure func() error, retryInterval time.Duration) *topicsCheck {
+	c := &topicsCheck{retryInterval: retryInterval}
+	if c.ensure(ensure) {
+		return c
+	}
+	go func() {
+		for {
+			time.Sleep(c.retryInterval)
+			if c.ensure(ensure) {
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// ensure runs ensure once and records the result
+func (c *topicsCheck) ensure(ensure func() error) bool {
+	err := ensure()
+	if err != nil {
+		log.Errorf("# messaging # kafka topics are not ready, trying again in %s: %v", c.retryInterval, err)
+	} else {
+		log.Infof("# messaging # kafka topics are ready")
+	}
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	return err == nil
+}
+
+// Check returns the error of the last attempt to ensure the topics
+func (c *topicsCheck) Check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// ensureTopics ensures the registered and given topics with the configured brokers
+func ensureTopics(specs []TopicSpec) error {
+	registered, err := registeredTopicSpecs()
+	if err != nil {
+		return err
+	}
+	specs = mergeSpecs(registered, specs)
+
+	brokers, err := messaging.ConfiguredBrokers()
+	if err != nil {
+		return err
+	}
+
+	timeout, err := time.ParseDuration(service.Config().Get(kafkaEnsureTopicsTimeout))
+	if timeout <= 0 || err != nil {
+		timeout = defaultEnsureTopicsTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return NewClient(brokers).EnsureTopics(ctx, specs...)
+}
+
+// registeredTopicSpecs returns the specs of all topics registered with messaging.RegisterTopic, existing topics are
+// only checked to exist as their settings are not known
+func registeredTopicSpecs() ([]TopicSpec, error) {
+	topics, err := messaging.RegisteredTopics()
+	if err != nil {
+		return nil, err
+	}
+
+	partitions, err := strconv.Atoi(service.Config().Get(kafkaTopicPartitions))
+	if partitions <= 0 || err != nil {
+		log.Debugf("Setting topic partitions to %v, as kafka.topic.partitions was not a positive int value", defaultTopicPartitions)
+		partitions = defaultTopicPartitions
+	}
+	replicationFactor, err := strconv.Atoi(service.Config().Get(kafkaTopicReplicationFactor))
+	if replicationFactor <= 0 || err != nil {
+		log.Debugf("Setting topic replication factor to %v, as kafka.topic.replication.factor was not a positive int value", defaultTopicReplicationFactor)
+		replicationFactor = defaultTopicReplicationFactor
+	}
+
+	specs := make([]TopicSpec, len(topics))
+	for i, topic := range topics {
+		specs[i] = TopicSpec{Name: topic, Partitions: partitions, ReplicationFactor: replicationFactor, ExistenceOnly: true}
+	}
+	return specs, nil
+}
+
+// mergeSpecs returns the registered specs with the given specs, a given spec replaces the registered one of its topic
+func mergeSpecs(registered []TopicSpec, specs []TopicSpec) []TopicSpec {
+	given := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		given[spec.Name] = true
+	}
+	var merged []TopicSpec
+	for _, spec := range registered {
+		if !given[spec.Name] {
+			merged = append(merged, spec)
+		}
+	}
+	return append(merged, specs...)
+}
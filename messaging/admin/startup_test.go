@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTopicsCheck_RetriesUntilReady(t *testing.T) {
+	attempts := make(chan struct{}, 3)
+	failures := 2
+	check := newTopicsCheck(func() error {
+		attempts <- struct{}{}
+		if len(attempts) <= failures {
+			return errors.New("broker not available")
+		}
+		return nil
+	}, 10*time.Millisecond)
+
+	if err := check.Check(); err == nil {
+		t.Error("Expected the check to fail while the topics cannot be ensured")
+	}
+	deadline := time.Now().Add(time.Second)
+	for check.Check() != nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := check.Check(); err != nil {
+		t.Errorf("Expected the check to succeed after ensuring the topics again, got %v", err)
+	}
+	if len(attempts) != 3 {
+		t.Errorf("Expected 3 attempts, got %d", len(attempts))
+	}
+}
+
+func TestMergeSpecs(t *testing.T) {
+	registered := []TopicSpec{
+		{Name: "orders", Partitions: 1, ReplicationFactor: 1, ExistenceOnly: true},
+		{Name: "orders.dlq", Partitions: 1, ReplicationFactor: 1, ExistenceOnly: true},
+	}
+	given := []TopicSpec{{Name: "orders", Partitions: 6, ReplicationFactor: 3}}
+
+	expected := []TopicSpec{registered[1], given[0]}
+	if merged := mergeSpecs(registered, given); !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %v, got %v", expected, merged)
+	}
+}
@@ -0,0 +1,349 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/microdevs/missy/log"
+	"github.com/microdevs/missy/service"
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrWriterClosed is returned when writing to a writer that was already closed
+var ErrWriterClosed = errors.New("writer is closed")
+
+// DeliveryFunc is called for every message of an asynchronous writer once the broker accepted it or the write failed
+type DeliveryFunc func(msg Message, err error)
+
+// AsyncWriterConfig configures the buffering of an asynchronous writer, zero values are replaced by the
+// configured defaults (KAFKA_WRITER_BATCH_SIZE, KAFKA_WRITER_LINGER and KAFKA_WRITER_BUFFER_SIZE)
+type AsyncWriterConfig struct {
+	// BatchSize is the number of messages which are written to the broker at once
+	BatchSize int
+	// Linger is the maximum time a message waits in the buffer for its batch to fill up
+	Linger time.Duration
+	// BufferSize is the maximum number of pending messages, writes block if the buffer is full
+	BufferSize int
+	// OnDelivery is called for every message after it was written or failed to be written
+	OnDelivery DeliveryFunc
+	// Partitioner distributes the messages across partitions, defaults to LeastBytesPartitioner
+	Partitioner Partitioner
+}
+
+// AsyncWriter is a Writer which buffers messages and writes them to the broker in batches in the background.
+// Write returns as soon as the message is buffered, the delivery result is reported to the configured
+// DeliveryFunc or through the Delivery returned by WriteAsync.
+type AsyncWriter interface {
+	Writer
+	// WriteAsync buffers a new message and returns its pending delivery
+	WriteAsync(key []byte, value []byte) *Delivery
+	// Flush writes all buffered messages and waits until they are delivered
+	Flush(ctx context.Context) error
+	// Shutdown flushes all buffered messages and closes the writer, it implements service.Shutdowner
+	Shutdown(ctx context.Context) error
+}
+
+// Delivery is the pending result of a message written by an AsyncWriter
+type Delivery struct {
+	msg  Message
+	err  error
+	done chan struct{}
+}
+
+func newDelivery(msg Message) *Delivery {
+	return &Delivery{msg: msg, done: make(chan struct{})}
+}
+
+// Message returns the message of this delivery
+func (d *Delivery) Message() Message {
+	return d.msg
+}
+
+// Done returns a channel which is closed when the message was delivered or failed to be delivered
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Wait blocks until the message was delivered and returns the delivery error or the context error
+func (d *Delivery) Wait(ctx context.Context) error {
+	select {
+	case <-d.done:
+		return d.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Delivery) complete(err error) {
+	d.err = err
+	close(d.done)
+}
+
+// asyncWriter used as the default missy AsyncWriter implementation
+type asyncWriter struct {
+	brokers []string
+	topic   string
+	writer  *missyWriter
+	config  AsyncWriterConfig
+
+	queue   chan *Delivery
+	flushes chan chan struct{}
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncWriter based on brokers hosts and topic. You need to close it after use to deliver all buffered messages. (Close())
+func NewAsyncWriter(brokers []string, topic string, config AsyncWriterConfig) AsyncWriter {
+	config = asyncWriterConfigWithDefaults(config)
+
+	newBrokerWriter := func(topic string) BrokerWriter {
+		return &writeBroker{kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      brokers,
+			Topic:        topic,
+			Balancer:     config.Partitioner.balancer(),
+			BatchSize:    config.BatchSize,
+			BatchTimeout: config.Linger,
+		})}
+	}
+
+	return startAsyncWriter(&missyWriter{
+		brokers:         brokers,
+		topic:           topic,
+		brokerWriter:    newBrokerWriter(topic),
+		newBrokerWriter: newBrokerWriter,
+	}, config)
+}
+
+func newAsyncWriter(brokers []string, topic string, brokerWriter BrokerWriter, config AsyncWriterConfig) *asyncWriter {
+	return startAsyncWriter(&missyWriter{brokers: brokers, topic: topic, brokerWriter: brokerWriter}, config)
+}
+
+// startAsyncWriter buffers messages for the given writer and starts writing them in the background
+func startAsyncWriter(writer *missyWriter, config AsyncWriterConfig) *asyncWriter {
+	aw := &asyncWriter{
+		brokers: writer.brokers,
+		topic:   writer.topic,
+		writer:  writer,
+		config:  config,
+		queue:   make(chan *Delivery, config.BufferSize),
+		flushes: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go aw.run()
+	return aw
+}
+
+// Write buffers a new message, it blocks while the buffer is full
+func (aw *asyncWriter) Write(key []byte, value []byte) error {
+	_, err := aw.enqueue(context.Background(), aw.message(key, value))
+	return err
+}
+
+// WriteContext buffers new messages, it blocks while the buffer is full until the context is done
+func (aw *asyncWriter) WriteContext(ctx context.Context, msgs ...Message) error {
+	for _, m := range msgs {
+		if m.Time.IsZero() {
+			m.Time = time.Now().UTC()
+		}
+		if _, err := aw.enqueue(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteAsync buffers a new message and returns its pending delivery, it blocks while the buffer is full
+func (aw *asyncWriter) WriteAsync(key []byte, value []byte) *Delivery {
+	d, _ := aw.enqueue(context.Background(), aw.message(key, value))
+	return d
+}
+
+// message returns a new message for the topic of the writer
+func (aw *asyncWriter) message(key []byte, value []byte) Message {
+	return Message{
+		Topic: aw.topic,
+		Key:   key,
+		Value: value,
+		Time:  time.Now().UTC(),
+	}
+}
+
+// enqueue adds a new message to the buffer, the delivery is completed right away if the writer was closed
+// or the context is done before the message could be buffered
+func (aw *asyncWriter) enqueue(ctx context.Context, msg Message) (*Delivery, error) {
+	d := newDelivery(msg)
+
+	aw.mu.RLock()
+	defer aw.mu.RUnlock()
+	if aw.closed {
+		d.complete(ErrWriterClosed)
+		return d, ErrWriterClosed
+	}
+	select {
+	case aw.queue <- d:
+		return d, nil
+	case <-ctx.Done():
+		d.complete(ctx.Err())
+		return d, ctx.Err()
+	}
+}
+
+// Flush writes all messages buffered before the call and waits until they are delivered
+func (aw *asyncWriter) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case aw.flushes <- flushed:
+	case <-aw.done:
+		// nothing left to flush after the writer was closed
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown flushes all buffered messages within the deadline of the context and closes the writer
+func (aw *asyncWriter) Shutdown(ctx context.Context) error {
+	if err := aw.Flush(ctx); err != nil {
+		log.Errorf("# messaging # flushing writer for %s failed, pending messages may be lost: %v", aw.topic, err)
+	}
+	return aw.Close()
+}
+
+// Close delivers all buffered messages and closes the writer
+func (aw *asyncWriter) Close() error {
+	aw.mu.Lock()
+	if aw.closed {
+		aw.mu.Unlock()
+		return nil
+	}
+	aw.closed = true
+	close(aw.queue)
+	aw.mu.Unlock()
+
+	<-aw.done
+	return aw.writer.Close()
+}
+
+// run collects buffered messages into batches and writes them when the batch is full or the linger time is over
+func (aw *asyncWriter) run() {
+	defer close(aw.done)
+
+	batch := make([]*Delivery, 0, aw.config.BatchSize)
+	linger := time.NewTimer(aw.config.Linger)
+	linger.Stop()
+
+	for {
+		select {
+		case d, ok := <-aw.queue:
+			if !ok {
+				linger.Stop()
+				aw.send(batch)
+				return
+			}
+			batch = append(batch, d)
+			if len(batch) == 1 {
+				linger.Reset(aw.config.Linger)
+			}
+			if len(batch) >= aw.config.BatchSize {
+				linger.Stop()
+				batch = aw.send(batch)
+			}
+		case <-linger.C:
+			batch = aw.send(batch)
+		case flushed := <-aw.flushes:
+			linger.Stop()
+			batch = aw.drain(batch)
+			close(flushed)
+		}
+	}
+}
+
+// drain sends all messages which are currently buffered
+func (aw *asyncWriter) drain(batch []*Delivery) []*Delivery {
+	for {
+		select {
+		case d, ok := <-aw.queue:
+			if !ok {
+				return aw.send(batch)
+			}
+			batch = append(batch, d)
+			if len(batch) >= aw.config.BatchSize {
+				batch = aw.send(batch)
+			}
+		default:
+			return aw.send(batch)
+		}
+	}
+}
+
+// send writes a batch to the broker, reports the result of every message and returns the emptied batch
+func (aw *asyncWriter) send(batch []*Delivery) []*Delivery {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	msgs := make([]Message, len(batch))
+	for i, d := range batch {
+		msgs[i] = d.msg
+	}
+
+	err := aw.writer.WriteContext(context.Background(), msgs...)
+	if err != nil {
+		log.Errorf("# messaging # writing batch of %d messages to %s failed: %v", len(batch), aw.topic, err)
+	}
+
+	for _, d := range batch {
+		d.complete(err)
+		if aw.config.OnDelivery != nil {
+			aw.config.OnDelivery(d.msg, err)
+		}
+	}
+	return batch[:0]
+}
+
+// asyncWriterConfigWithDefaults replaces zero values of the config with the configured defaults
+func asyncWriterConfigWithDefaults(config AsyncWriterConfig) AsyncWriterConfig {
+	batchSize, linger, bufferSize := fetchAsyncWriterDefaults()
+	if config.BatchSize <= 0 {
+		config.BatchSize = batchSize
+	}
+	if config.Linger <= 0 {
+		config.Linger = linger
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = bufferSize
+	}
+	return config
+}
+
+func fetchAsyncWriterDefaults() (int, time.Duration, int) {
+	batchSize, err := strconv.Atoi(service.Config().Get(kafkaWriterBatchSize))
+	if batchSize <= 0 || err != nil {
+		log.Debugf("Setting writer batch size to %v, as kafka.writer.batch.size was not a positive int value", defaultKafkaWriterBatchSize)
+		batchSize = defaultKafkaWriterBatchSize
+	}
+	linger, err := time.ParseDuration(service.Config().Get(kafkaWriterLinger))
+	if linger <= 0 || err != nil {
+		log.Debugf("Setting writer linger to %s, as kafka.writer.linger was not a positive duration", defaultKafkaWriterLinger)
+		linger = defaultKafkaWriterLinger
+	}
+	bufferSize, err := strconv.Atoi(service.Config().Get(kafkaWriterBufferSize))
+	if bufferSize <= 0 || err != nil {
+		log.Debugf("Setting writer buffer size to %v, as kafka.writer.buffer.size was not a positive int value", defaultKafkaWriterBufferSize)
+		bufferSize = defaultKafkaWriterBufferSize
+	}
+	return batchSize, linger, bufferSize
+}
@@ -0,0 +1,152 @@
+package messaging
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+)
+
+func TestNewAsyncWriter(t *testing.T) {
+	w := NewAsyncWriter([]string{"localhost:9091"}, "test", AsyncWriterConfig{})
+
+	writerType := reflect.TypeOf((*Writer)(nil)).Elem()
+
+	if !reflect.TypeOf(w).Implements(writerType) {
+		t.Error("messaging.NewAsyncWriter does not implement messaging.Writer interface")
+	}
+}
+
+func TestAsyncWriter_WritesFullBatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	brokerWriterMock := NewMockBrokerWriter(mockCtrl)
+
+	written := make(chan int, 1)
+	brokerWriterMock.EXPECT().WriteMessages(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msgs ...Message) error {
+		written <- len(msgs)
+		return nil
+	})
+	brokerWriterMock.EXPECT().Close().Return(nil)
+
+	writer := newAsyncWriter(nil, "test", brokerWriterMock, AsyncWriterConfig{BatchSize: 2, Linger: time.Hour, BufferSize: 10})
+
+	for _, key := range []string{"key1", "key2"} {
+		if err := writer.Write([]byte(key), []byte("value")); err != nil {
+			t.Errorf("there was an unexpected error during Write message: %v", err)
+		}
+	}
+
+	select {
+	case n := <-written:
+		if n != 2 {
+			t.Errorf("expecting a batch of 2 messages but got %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Error("full batch was not written")
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Errorf("there is an error during Close call: %v", err)
+	}
+}
+
+func TestAsyncWriter_WritesAfterLinger(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	brokerWriterMock := NewMockBrokerWriter(mockCtrl)
+
+	brokerWriterMock.EXPECT().WriteMessages(gomock.Any(), gomock.Any()).Return(nil)
+	brokerWriterMock.EXPECT().Close().Return(nil)
+
+	writer := newAsyncWriter(nil, "test", brokerWriterMock, AsyncWriterConfig{BatchSize: 100, Linger: time.Millisecond, BufferSize: 10})
+	defer writer.Close()
+
+	d := writer.WriteAsync([]byte("key"), []byte("value"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Errorf("message was not delivered after the linger time: %v", err)
+	}
+	if string(d.Message().Key) != "key" {
+		t.Error(expected(string(d.Message().Key), "key"))
+	}
+}
+
+func TestAsyncWriter_FlushReportsDelivery(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	brokerWriterMock := NewMockBrokerWriter(mockCtrl)
+
+	brokerWriterMock.EXPECT().WriteMessages(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("error"))
+	brokerWriterMock.EXPECT().Close().Return(nil)
+
+	var mu sync.Mutex
+	var failed int
+	onDelivery := func(msg Message, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed++
+		}
+	}
+
+	writer := newAsyncWriter(nil, "test", brokerWriterMock, AsyncWriterConfig{BatchSize: 100, Linger: time.Hour, BufferSize: 10, OnDelivery: onDelivery})
+	defer writer.Close()
+
+	d1 := writer.WriteAsync([]byte("key1"), []byte("value"))
+	d2 := writer.WriteAsync([]byte("key2"), []byte("value"))
+
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Errorf("there was an unexpected error during Flush: %v", err)
+	}
+
+	for _, d := range []*Delivery{d1, d2} {
+		select {
+		case <-d.Done():
+			if err := d.Wait(context.Background()); err == nil {
+				t.Error("delivery error was expected")
+			}
+		default:
+			t.Error("delivery was not done after Flush")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if failed != 2 {
+		t.Errorf("expecting 2 failed deliveries to be reported but got %d", failed)
+	}
+}
+
+func TestAsyncWriter_CloseDrainsBuffer(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	brokerWriterMock := NewMockBrokerWriter(mockCtrl)
+
+	brokerWriterMock.EXPECT().WriteMessages(gomock.Any(), gomock.Any()).Return(nil)
+	brokerWriterMock.EXPECT().Close().Return(nil)
+
+	writer := newAsyncWriter(nil, "test", brokerWriterMock, AsyncWriterConfig{BatchSize: 100, Linger: time.Hour, BufferSize: 10})
+
+	d := writer.WriteAsync([]byte("key"), []byte("value"))
+
+	if err := writer.Shutdown(context.Background()); err != nil {
+		t.Errorf("there is an error during Shutdown call: %v", err)
+	}
+
+	select {
+	case <-d.Done():
+	default:
+		t.Error("buffered message was not delivered on Shutdown")
+	}
+
+	if err := writer.Write([]byte("key"), []byte("value")); err != ErrWriterClosed {
+		t.Errorf("expecting ErrWriterClosed after Close but got %v", err)
+	}
+}
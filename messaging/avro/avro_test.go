@@ -0,0 +1,224 @@
+package avro
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func mustParse(t *testing.T, schema string) *Schema {
+	s, err := Parse(schema)
+	if err != nil {
+		t.Fatalf("unexpected error parsing %s: %v", schema, err)
+	}
+	return s
+}
+
+// the examples of the binary encoding in the Avro specification
+func TestMarshal_Specification(t *testing.T) {
+	tests := []struct {
+		schema   string
+		value    interface{}
+		expected []byte
+	}{
+		{`"int"`, 0, []byte{0x00}},
+		{`"int"`, -1, []byte{0x01}},
+		{`"int"`, 1, []byte{0x02}},
+		{`"long"`, -64, []byte{0x7f}},
+		{`"long"`, 64, []byte{0x80, 0x01}},
+		{`"string"`, "foo", []byte{0x06, 0x66, 0x6f, 0x6f}},
+		{`{"type": "record", "name": "test", "fields": [{"name": "a", "type": "long"}, {"name": "b", "type": "string"}]}`,
+			map[string]interface{}{"a": 27, "b": "foo"}, []byte{0x36, 0x06, 0x66, 0x6f, 0x6f}},
+		{`{"type": "array", "items": "long"}`, []int64{3, 27}, []byte{0x04, 0x06, 0x36, 0x00}},
+		{`["null", "string"]`, nil, []byte{0x00}},
+		{`["null", "string"]`, "a", []byte{0x02, 0x02, 0x61}},
+		{`"boolean"`, true, []byte{0x01}},
+		{`"float"`, float32(1), []byte{0x00, 0x00, 0x80, 0x3f}},
+		{`"double"`, 1.0, []byte{0, 0, 0, 0, 0, 0, 0xf0, 0x3f}},
+		{`{"type": "enum", "name": "suit", "symbols": ["SPADES", "HEARTS"]}`, "HEARTS", []byte{0x02}},
+		{`{"type": "fixed", "name": "md5", "size": 2}`, [2]byte{1, 2}, []byte{0x01, 0x02}},
+		{`{"type": "map", "values": "int"}`, map[string]int{"a": 1}, []byte{0x02, 0x02, 0x61, 0x02, 0x00}},
+	}
+	for _, test := range tests {
+		data, err := Marshal(mustParse(t, test.schema), test.value)
+		if err != nil {
+			t.Errorf("%s: unexpected error encoding %v: %v", test.schema, test.value, err)
+			continue
+		}
+		if !bytes.Equal(data, test.expected) {
+			t.Errorf("%s: expected %x for %v, got %x", test.schema, test.expected, test.value, data)
+		}
+	}
+}
+
+type address struct {
+	Street string `avro:"street"`
+}
+
+type customer struct {
+	ID       int64             `avro:"id"`
+	Name     string            `avro:"name"`
+	Email    *string           `avro:"email"`
+	Status   string            `avro:"status"`
+	Tags     []string          `avro:"tags"`
+	Scores   map[string]int    `avro:"scores"`
+	Address  address           `avro:"address"`
+	Previous *address          `avro:"previous"`
+	Hash     [4]byte           `avro:"hash"`
+	Balance  float64           `avro:"balance"`
+	Extra    map[string]string `avro:"-"`
+}
+
+const customerSchema = `{
+	"type": "record", "name": "Customer", "namespace": "com.missy",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "name", "type": "string"},
+		{"name": "email", "type": ["null", "string"]},
+		{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["ACTIVE", "DISABLED"]}},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "scores", "type": {"type": "map", "values": "int"}},
+		{"name": "address", "type": {"type": "record", "name": "Address", "fields": [{"name": "street", "type": "string"}]}},
+		{"name": "previous", "type": ["null", "Address"]},
+		{"name": "hash", "type": {"type": "fixed", "name": "Hash", "size": 4}},
+		{"name": "balance", "type": {"type": "double", "logicalType": "none"}}
+	]
+}`
+
+func TestMarshalUnmarshal(t *testing.T) {
+	s := mustParse(t, customerSchema)
+	email := "jane@missy.com"
+	in := customer{
+		ID:       12345678901,
+		Name:     "Jane",
+		Email:    &email,
+		Status:   "DISABLED",
+		Tags:     []string{"vip", "beta"},
+		Scores:   map[string]int{"orders": 42},
+		Address:  address{Street: "Main Street 1"},
+		Previous: nil,
+		Hash:     [4]byte{1, 2, 3, 4},
+		Balance:  -12.5,
+	}
+
+	data, err := Marshal(s, in)
+	if err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+	var out customer
+	if err := Unmarshal(s, data, &out); err != nil {
+		t.Fatalf("unexpected error decoding: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("expected %+v, got %+v", in, out)
+	}
+
+	var native interface{}
+	if err := Unmarshal(s, data, &native); err != nil {
+		t.Fatalf("unexpected error decoding into an interface: %v", err)
+	}
+	record := native.(map[string]interface{})
+	if record["id"] != int64(12345678901) || record["email"] != email || record["status"] != "DISABLED" || record["previous"] != nil {
+		t.Errorf("unexpected native record %v", record)
+	}
+	if street := record["address"].(map[string]interface{})["street"]; street != "Main Street 1" {
+		t.Errorf("unexpected nested record %v", record["address"])
+	}
+}
+
+func TestUnmarshal_SkipsUnknownFields(t *testing.T) {
+	s := mustParse(t, customerSchema)
+	data, err := Marshal(s, customer{Status: "ACTIVE", Previous: &address{Street: "Old Street"}})
+	if err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+
+	var out struct {
+		Name    string   `avro:"name"`
+		Balance *float64 `avro:"balance"`
+	}
+	if err := Unmarshal(s, data, &out); err != nil {
+		t.Fatalf("unexpected error decoding: %v", err)
+	}
+	if out.Balance == nil || *out.Balance != 0 {
+		t.Errorf("expected the balance to be decoded, got %v", out.Balance)
+	}
+}
+
+func TestMarshal_Errors(t *testing.T) {
+	tests := []struct {
+		schema string
+		value  interface{}
+	}{
+		{`"int"`, int64(1) << 40},
+		{`"int"`, "1"},
+		{`"null"`, 1},
+		{`"string"`, nil},
+		{`["null", "int"]`, "a"},
+		{`{"type": "enum", "name": "suit", "symbols": ["SPADES"]}`, "CLUBS"},
+		{`{"type": "fixed", "name": "md5", "size": 2}`, []byte{1}},
+		{`{"type": "record", "name": "test", "fields": [{"name": "a", "type": "long"}]}`, struct{ B int }{}},
+	}
+	for _, test := range tests {
+		if _, err := Marshal(mustParse(t, test.schema), test.value); err == nil {
+			t.Errorf("%s: expected an error encoding %v", test.schema, test.value)
+		}
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	var i int8
+	var s string
+	tests := []struct {
+		schema string
+		data   []byte
+		v      interface{}
+	}{
+		{`"string"`, []byte{0x06, 0x66}, &s},
+		{`"long"`, []byte{0x80}, &s},
+		{`"long"`, []byte{0x80, 0x04}, &i},
+		{`["null", "string"]`, []byte{0x04}, &s},
+		{`{"type": "array", "items": "long"}`, []byte{0x7e, 0x02}, &[]int{}},
+		{`"string"`, []byte{0x02, 0x61}, s},
+	}
+	for _, test := range tests {
+		if err := Unmarshal(mustParse(t, test.schema), test.data, test.v); err == nil {
+			t.Errorf("%s: expected an error decoding %x", test.schema, test.data)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, schema := range []string{
+		`"unknown"`,
+		`{"type": "record", "fields": []}`,
+		`{"type": "record", "name": "a", "fields": [{"name": "b", "type": "c"}]}`,
+		`{"type": "enum", "name": "a", "symbols": []}`,
+		`{"type": "fixed", "name": "a"}`,
+		`["null", "null"]`,
+		`["null", ["string"]]`,
+		`{"name": "a"}`,
+		`not json`,
+	} {
+		if _, err := Parse(schema); err == nil {
+			t.Errorf("expected an error parsing %s", schema)
+		}
+	}
+}
+
+func TestParse_RecursiveRecord(t *testing.T) {
+	s := mustParse(t, `{"type": "record", "name": "Node", "fields": [{"name": "value", "type": "int"}, {"name": "next", "type": ["null", "Node"]}]}`)
+	type node struct {
+		Value int   `avro:"value"`
+		Next  *node `avro:"next"`
+	}
+	in := node{Value: 1, Next: &node{Value: 2}}
+	data, err := Marshal(s, in)
+	if err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+	var out node
+	if err := Unmarshal(s, data, &out); err != nil || !reflect.DeepEqual(in, out) {
+		t.Errorf("expected %+v, got %+v, error %v", in, out, err)
+	}
+}
@@ -0,0 +1,358 @@
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// ErrShortData is returned when the data ends before the value of the schema
+var ErrShortData = errors.New("avro data is too short")
+
+// Unmarshal decodes the Avro binary encoding of a value of the schema into the value v points to. Records are decoded
+// into structs, record fields without a struct field are skipped, and into maps with string keys. Into an empty
+// interface records and maps are decoded as map[string]interface{}, arrays as []interface{}, ints as int, longs as
+// int64, enums as string and fixed types as []byte.
+func Unmarshal(s *Schema, data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cannot decode avro into %T, a non-nil pointer is needed", v)
+	}
+	d := &decoder{data: data}
+	return d.decode(s, rv.Elem())
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) decode(s *Schema, v reflect.Value) error {
+	if s.Type == Union {
+		i, err := d.long()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(s.Types)) {
+			return fmt.Errorf("avro union has no type %d", i)
+		}
+		s = s.Types[i]
+		if s.Type == Null {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+	}
+	if s.Type != Null && v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(s, v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		native, err := d.native(s)
+		if err != nil {
+			return err
+		}
+		if native == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(native))
+		}
+		return nil
+	}
+
+	switch s.Type {
+	case Null:
+		return nil
+	case Boolean:
+		b, err := d.read(1)
+		if err != nil {
+			return err
+		}
+		if v.Kind() == reflect.Bool {
+			v.SetBool(b[0] != 0)
+			return nil
+		}
+	case Int, Long:
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		if setNumber(v, float64(n), n) {
+			return nil
+		}
+	case Float:
+		b, err := d.read(4)
+		if err != nil {
+			return err
+		}
+		if isFloat(v) {
+			v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+			return nil
+		}
+	case Double:
+		b, err := d.read(8)
+		if err != nil {
+			return err
+		}
+		if isFloat(v) {
+			v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			return nil
+		}
+	case Bytes, String:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		if setBytes(v, b) {
+			return nil
+		}
+	case Fixed:
+		b, err := d.read(s.Size)
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.String && setBytes(v, b) {
+			return nil
+		}
+	case Enum:
+		i, err := d.long()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(s.Symbols)) {
+			return fmt.Errorf("avro enum %s has no symbol %d", s.Name, i)
+		}
+		if v.Kind() == reflect.String {
+			v.SetString(s.Symbols[i])
+			return nil
+		}
+		if !isFloat(v) && setNumber(v, float64(i), i) {
+			return nil
+		}
+	case Record:
+		return d.record(s, v)
+	case Array:
+		return d.array(s, v)
+	case Map:
+		return d.mapOf(s, v)
+	}
+	return fmt.Errorf("cannot decode avro %s into %s", s.Type, v.Type())
+}
+
+func (d *decoder) record(s *Schema, v reflect.Value) error {
+	switch {
+	case v.Kind() == reflect.Struct:
+		fields := structFields(v.Type())
+		for _, f := range s.Fields {
+			index, ok := fields[f.Name]
+			if !ok {
+				if _, err := d.native(f.Type); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(f.Type, v.FieldByIndex(index)); err != nil {
+				return fmt.Errorf("field %s: %v", f.Name, err)
+			}
+		}
+		return nil
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, f := range s.Fields {
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(f.Type, value); err != nil {
+				return fmt.Errorf("field %s: %v", f.Name, err)
+			}
+			v.SetMapIndex(reflect.ValueOf(f.Name).Convert(v.Type().Key()), value)
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot decode avro record %s into %s", s.Name, v.Type())
+}
+
+func (d *decoder) array(s *Schema, v reflect.Value) error {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("cannot decode avro array into %s", v.Type())
+	}
+	if v.Kind() == reflect.Slice {
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	}
+	n := 0
+	err := d.blocks(func() error {
+		if v.Kind() == reflect.Array {
+			if n >= v.Len() {
+				return fmt.Errorf("avro array has more than %d items", v.Len())
+			}
+		} else {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		n++
+		return d.decode(s.Items, v.Index(n-1))
+	})
+	return err
+}
+
+func (d *decoder) mapOf(s *Schema, v reflect.Value) error {
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("cannot decode avro map into %s", v.Type())
+	}
+	v.Set(reflect.MakeMap(v.Type()))
+	return d.blocks(func() error {
+		key, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		value := reflect.New(v.Type().Elem()).Elem()
+		if err := d.decode(s.Values, value); err != nil {
+			return fmt.Errorf("value %s: %v", key, err)
+		}
+		v.SetMapIndex(reflect.ValueOf(string(key)).Convert(v.Type().Key()), value)
+		return nil
+	})
+}
+
+// blocks reads the blocks of an array or map until the empty block, item is called for every item of a block
+func (d *decoder) blocks(item func() error) error {
+	for {
+		count, err := d.long()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 {
+			// a negative count is followed by the size of the block in bytes
+			count = -count
+			if _, err := d.long(); err != nil {
+				return err
+			}
+		}
+		// every item takes at least a byte except null, which is not worth an array
+		if count > int64(len(d.data)) {
+			return ErrShortData
+		}
+		for ; count > 0; count-- {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// native decodes a value of the schema into its natural Go type
+func (d *decoder) native(s *Schema) (interface{}, error) {
+	var t reflect.Type
+	switch s.Type {
+	case Union:
+		var v interface{}
+		err := d.decode(s, reflect.ValueOf(&v).Elem())
+		return v, err
+	case Null:
+		return nil, nil
+	case Boolean:
+		t = reflect.TypeOf(false)
+	case Int:
+		t = reflect.TypeOf(0)
+	case Long:
+		t = reflect.TypeOf(int64(0))
+	case Float:
+		t = reflect.TypeOf(float32(0))
+	case Double:
+		t = reflect.TypeOf(float64(0))
+	case Bytes, Fixed:
+		t = reflect.TypeOf([]byte(nil))
+	case String, Enum:
+		t = reflect.TypeOf("")
+	case Array:
+		t = reflect.TypeOf([]interface{}(nil))
+	default:
+		t = reflect.TypeOf(map[string]interface{}(nil))
+	}
+	v := reflect.New(t).Elem()
+	if err := d.decode(s, v); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// long reads a zig-zag encoded variable length integer
+func (d *decoder) long() (int64, error) {
+	n, size := binary.Varint(d.data)
+	if size == 0 {
+		return 0, ErrShortData
+	}
+	if size < 0 {
+		return 0, errors.New("avro long overflows 64 bits")
+	}
+	d.data = d.data[size:]
+	return n, nil
+}
+
+// bytes reads a length followed by that many bytes
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.long()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("avro bytes have a negative length %d", n)
+	}
+	if n > int64(len(d.data)) {
+		return nil, ErrShortData
+	}
+	return d.read(int(n))
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n > len(d.data) {
+		return nil, ErrShortData
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+// setNumber sets integers to n and floats to f, it fails for other types and integers which do not fit
+func setNumber(v reflect.Value, f float64, n int64) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(n) {
+			return false
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return false
+		}
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(f)
+	default:
+		return false
+	}
+	return true
+}
+
+func isFloat(v reflect.Value) bool {
+	return v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+// setBytes sets strings, byte slices and byte arrays of the same length to a copy of b
+func setBytes(v reflect.Value, b []byte) bool {
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(string(b))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(append([]byte(nil), b...))
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 && v.Len() == len(b):
+		reflect.Copy(v, reflect.ValueOf(b))
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,268 @@
+package avro
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Marshal returns the Avro binary encoding of v. Records are encoded from structs, whose fields are matched to the
+// record fields by their avro tag or their name, or from maps with string keys. A union is encoded with the first of
+// its types v can be encoded with, nil pointers and nil values are encoded as null.
+func Marshal(s *Schema, v interface{}) ([]byte, error) {
+	e := &encoder{}
+	if err := e.encode(s, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) encode(s *Schema, v reflect.Value) error {
+	for v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if s.Type == Union {
+		return e.union(s, v)
+	}
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v = reflect.Value{}
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		if s.Type == Null {
+			return nil
+		}
+		return fmt.Errorf("cannot encode nil as avro %s", s.Type)
+	}
+
+	switch s.Type {
+	case Boolean:
+		if v.Kind() == reflect.Bool {
+			if v.Bool() {
+				e.buf = append(e.buf, 1)
+			} else {
+				e.buf = append(e.buf, 0)
+			}
+			return nil
+		}
+	case Int, Long:
+		if n, ok := integer(v); ok {
+			if s.Type == Int && (n < math.MinInt32 || n > math.MaxInt32) {
+				return fmt.Errorf("%d does not fit into avro int", n)
+			}
+			e.long(n)
+			return nil
+		}
+	case Float, Double:
+		f, ok := float(v)
+		if !ok {
+			break
+		}
+		if s.Type == Float {
+			e.buf = append(e.buf, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint32(e.buf[len(e.buf)-4:], math.Float32bits(float32(f)))
+		} else {
+			e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], math.Float64bits(f))
+		}
+		return nil
+	case Bytes, String:
+		if b, ok := bytesOf(v); ok {
+			e.long(int64(len(b)))
+			e.buf = append(e.buf, b...)
+			return nil
+		}
+	case Fixed:
+		if b, ok := bytesOf(v); ok && v.Kind() != reflect.String {
+			if len(b) != s.Size {
+				return fmt.Errorf("cannot encode %d bytes as avro fixed %s of size %d", len(b), s.Name, s.Size)
+			}
+			e.buf = append(e.buf, b...)
+			return nil
+		}
+	case Enum:
+		return e.enum(s, v)
+	case Record:
+		return e.record(s, v)
+	case Array:
+		return e.array(s, v)
+	case Map:
+		return e.mapOf(s, v)
+	}
+	return fmt.Errorf("cannot encode %s as avro %s", v.Type(), s.Type)
+}
+
+// union writes the index of the first type the value can be encoded with followed by the value
+func (e *encoder) union(s *Schema, v reflect.Value) error {
+	for i, t := range s.Types {
+		branch := &encoder{}
+		if err := branch.encode(t, v); err != nil {
+			continue
+		}
+		e.long(int64(i))
+		e.buf = append(e.buf, branch.buf...)
+		return nil
+	}
+	if !v.IsValid() {
+		return fmt.Errorf("cannot encode nil as avro union without null")
+	}
+	return fmt.Errorf("cannot encode %s as any type of the avro union", v.Type())
+}
+
+func (e *encoder) enum(s *Schema, v reflect.Value) error {
+	if v.Kind() == reflect.String {
+		for i, symbol := range s.Symbols {
+			if symbol == v.String() {
+				e.long(int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is no symbol of avro enum %s", v.String(), s.Name)
+	}
+	if n, ok := integer(v); ok && n >= 0 && n < int64(len(s.Symbols)) {
+		e.long(n)
+		return nil
+	}
+	return fmt.Errorf("cannot encode %s as avro enum %s", v.Type(), s.Name)
+}
+
+func (e *encoder) record(s *Schema, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		for _, f := range s.Fields {
+			index, ok := fields[f.Name]
+			if !ok {
+				return fmt.Errorf("%s has no field for %s of avro record %s", v.Type(), f.Name, s.Name)
+			}
+			if err := e.encode(f.Type, v.FieldByIndex(index)); err != nil {
+				return fmt.Errorf("field %s: %v", f.Name, err)
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		for _, f := range s.Fields {
+			value := v.MapIndex(reflect.ValueOf(f.Name).Convert(v.Type().Key()))
+			if !value.IsValid() {
+				return fmt.Errorf("map has no value for field %s of avro record %s", f.Name, s.Name)
+			}
+			if err := e.encode(f.Type, value); err != nil {
+				return fmt.Errorf("field %s: %v", f.Name, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot encode %s as avro record %s", v.Type(), s.Name)
+}
+
+// array writes the items in a single block followed by the empty block
+func (e *encoder) array(s *Schema, v reflect.Value) error {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("cannot encode %s as avro array", v.Type())
+	}
+	if v.Len() > 0 {
+		e.long(int64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(s.Items, v.Index(i)); err != nil {
+				return fmt.Errorf("item %d: %v", i, err)
+			}
+		}
+	}
+	e.long(0)
+	return nil
+}
+
+// mapOf writes the entries in a single block followed by the empty block
+func (e *encoder) mapOf(s *Schema, v reflect.Value) error {
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("cannot encode %s as avro map", v.Type())
+	}
+	if v.Len() > 0 {
+		e.long(int64(v.Len()))
+		for _, key := range v.MapKeys() {
+			e.long(int64(len(key.String())))
+			e.buf = append(e.buf, key.String()...)
+			if err := e.encode(s.Values, v.MapIndex(key)); err != nil {
+				return fmt.Errorf("value %s: %v", key.String(), err)
+			}
+		}
+	}
+	e.long(0)
+	return nil
+}
+
+// long writes a zig-zag encoded variable length integer
+func (e *encoder) long(n int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], n)]...)
+}
+
+// integer returns the value of signed and unsigned integers
+func integer(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+// float returns the value of floats and integers
+func float(v reflect.Value) (float64, bool) {
+	if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+		return v.Float(), true
+	}
+	n, ok := integer(v)
+	return float64(n), ok
+}
+
+// bytesOf returns the bytes of strings, byte slices and byte arrays
+func bytesOf(v reflect.Value) ([]byte, bool) {
+	switch {
+	case v.Kind() == reflect.String:
+		return []byte(v.String()), true
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return v.Bytes(), true
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return b, true
+	}
+	return nil, false
+}
+
+// structFields returns the index of the exported fields of a struct by their avro tag or name
+func structFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("avro"); ok {
+			name = strings.Split(tag, ",")[0]
+		}
+		if name == "-" {
+			continue
+		}
+		fields[name] = f.Index
+	}
+	return fields
+}
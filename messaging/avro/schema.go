@@ -0,0 +1,219 @@
+// Package avro encodes and decodes Go values in the Avro binary encoding of a schema. It supports all Avro types,
+// logical types are encoded as their underlying type. Values are written with the schema they are read with, schema
+// resolution between different writer and reader schemas is not supported.
+package avro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// types of Avro schemas
+const (
+	Null    = "null"
+	Boolean = "boolean"
+	Int     = "int"
+	Long    = "long"
+	Float   = "float"
+	Double  = "double"
+	Bytes   = "bytes"
+	String  = "string"
+	Record  = "record"
+	Enum    = "enum"
+	Array   = "array"
+	Map     = "map"
+	Union   = "union"
+	Fixed   = "fixed"
+)
+
+var primitives = map[string]bool{Null: true, Boolean: true, Int: true, Long: true, Float: true, Double: true, Bytes: true, String: true}
+
+// Schema is a parsed Avro schema
+type Schema struct {
+	Type string
+	// Name is the full name of records, enums and fixed types
+	Name string
+	// Fields of a record
+	Fields []*Field
+	// Symbols of an enum
+	Symbols []string
+	// Items of an array
+	Items *Schema
+	// Values of a map
+	Values *Schema
+	// Types of a union
+	Types []*Schema
+	// Size of a fixed type
+	Size int
+}
+
+// Field is a field of a record
+type Field struct {
+	Name string
+	Type *Schema
+}
+
+// Parse parses a schema in the Avro JSON format
+func Parse(schema string) (*Schema, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(schema), &v); err != nil {
+		return nil, fmt.Errorf("schema is no valid JSON: %v", err)
+	}
+	p := &parser{named: make(map[string]*Schema)}
+	return p.parse(v, "")
+}
+
+// parser keeps the named types of a schema, so they can be referenced by name after their definition
+type parser struct {
+	named map[string]*Schema
+}
+
+func (p *parser) parse(v interface{}, namespace string) (*Schema, error) {
+	switch v := v.(type) {
+	case string:
+		return p.reference(v, namespace)
+	case []interface{}:
+		return p.union(v, namespace)
+	case map[string]interface{}:
+		return p.complex(v, namespace)
+	default:
+		return nil, fmt.Errorf("invalid schema %v", v)
+	}
+}
+
+// reference returns a primitive type or a named type defined before
+func (p *parser) reference(name string, namespace string) (*Schema, error) {
+	if primitives[name] {
+		return &Schema{Type: name}, nil
+	}
+	if s, ok := p.named[fullName(name, namespace)]; ok {
+		return s, nil
+	}
+	if s, ok := p.named[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown type %s", name)
+}
+
+func (p *parser) union(types []interface{}, namespace string) (*Schema, error) {
+	s := &Schema{Type: Union}
+	seen := make(map[string]bool)
+	for _, t := range types {
+		branch, err := p.parse(t, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if branch.Type == Union {
+			return nil, errors.New("unions must not contain unions")
+		}
+		key := branch.Type
+		if branch.Name != "" {
+			key = branch.Name
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("union contains %s twice", key)
+		}
+		seen[key] = true
+		s.Types = append(s.Types, branch)
+	}
+	return s, nil
+}
+
+func (p *parser) complex(v map[string]interface{}, namespace string) (*Schema, error) {
+	t, _ := v["type"].(string)
+	switch t {
+	case Record, "error", Enum, Fixed:
+		return p.definition(v, t, namespace)
+	case Array:
+		items, err := p.parse(v["items"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid array items: %v", err)
+		}
+		return &Schema{Type: Array, Items: items}, nil
+	case Map:
+		values, err := p.parse(v["values"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map values: %v", err)
+		}
+		return &Schema{Type: Map, Values: values}, nil
+	default:
+		if _, ok := v["type"]; !ok {
+			return nil, errors.New("schema has no type")
+		}
+		// a primitive or a reference with attributes like a logical type
+		return p.parse(v["type"], namespace)
+	}
+}
+
+// definition parses a record, enum or fixed type and registers its name
+func (p *parser) definition(v map[string]interface{}, t string, namespace string) (*Schema, error) {
+	name, _ := v["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%s has no name", t)
+	}
+	if ns, ok := v["namespace"].(string); ok && !strings.Contains(name, ".") {
+		namespace = ns
+	}
+	name = fullName(name, namespace)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		namespace = name[:i]
+	}
+	if _, ok := p.named[name]; ok {
+		return nil, fmt.Errorf("type %s is defined twice", name)
+	}
+
+	s := &Schema{Type: t, Name: name}
+	p.named[name] = s
+	switch t {
+	case Enum:
+		symbols, _ := v["symbols"].([]interface{})
+		for _, symbol := range symbols {
+			sym, ok := symbol.(string)
+			if !ok {
+				return nil, fmt.Errorf("enum %s has a symbol which is no string", name)
+			}
+			s.Symbols = append(s.Symbols, sym)
+		}
+		if len(s.Symbols) == 0 {
+			return nil, fmt.Errorf("enum %s has no symbols", name)
+		}
+	case Fixed:
+		size, ok := v["size"].(float64)
+		if !ok || size < 0 || size != float64(int(size)) {
+			return nil, fmt.Errorf("fixed %s has no valid size", name)
+		}
+		s.Size = int(size)
+	default:
+		s.Type = Record
+		fields, ok := v["fields"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record %s has no fields", name)
+		}
+		for _, f := range fields {
+			field, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("record %s has an invalid field", name)
+			}
+			fieldName, _ := field["name"].(string)
+			if fieldName == "" {
+				return nil, fmt.Errorf("record %s has a field without name", name)
+			}
+			fieldType, err := p.parse(field["type"], namespace)
+			if err != nil {
+				return nil, fmt.Errorf("invalid type of field %s of record %s: %v", fieldName, name, err)
+			}
+			s.Fields = append(s.Fields, &Field{Name: fieldName, Type: fieldType})
+		}
+	}
+	return s, nil
+}
+
+// fullName returns the name within the namespace unless it is a full name already
+func fullName(name string, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
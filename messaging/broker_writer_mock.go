@@ -46,6 +46,23 @@ func (mr *MockWriterMockRecorder) Write(key, value interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockWriter)(nil).Write), key, value)
 }
 
+// WriteContext mocks base method
+func (m *MockWriter) WriteContext(ctx context.Context, msgs ...Message) error {
+	varargs := []interface{}{ctx}
+	for _, a := range msgs {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "WriteContext", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteContext indicates an expected call of WriteContext
+func (mr *MockWriterMockRecorder) WriteContext(ctx interface{}, msgs ...interface{}) *gomock.Call {
+	varargs := append([]interface{}{ctx}, msgs...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteContext", reflect.TypeOf((*MockWriter)(nil).WriteContext), varargs...)
+}
+
 // Close mocks base method
 func (m *MockWriter) Close() error {
 	ret := m.ctrl.Call(m, "Close")
@@ -0,0 +1,34 @@
+package messaging
+
+// Chain is an immutable list of message middleware, it is applied to a ReadMessageFunc with Then
+type Chain struct {
+	constructors []Constructor
+}
+
+// NewChain returns a chain of the middleware, the first one sees a message first
+func NewChain(constructors ...Constructor) *Chain {
+	return &Chain{append(([]Constructor)(nil), constructors...)}
+}
+
+// Then wraps fn in the middleware of the chain, NewChain(m1, m2).Then(fn) equals m1(m2(fn)). The constructors are
+// called on every call, so a chain can be used for several funcs.
+func (c Chain) Then(fn ReadMessageFunc) ReadMessageFunc {
+	for i := range c.constructors {
+		fn = c.constructors[len(c.constructors)-1-i](fn)
+	}
+	return fn
+}
+
+// Append returns a new chain with the middleware added after the middleware of c
+func (c Chain) Append(constructors ...Constructor) Chain {
+	newCons := make([]Constructor, 0, len(c.constructors)+len(constructors))
+	newCons = append(newCons, c.constructors...)
+	newCons = append(newCons, constructors...)
+
+	return Chain{newCons}
+}
+
+// Extend returns a new chain with the middleware of chain added after the middleware of c
+func (c Chain) Extend(chain Chain) Chain {
+	return c.Append(chain.constructors...)
+}
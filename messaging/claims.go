@@ -0,0 +1,66 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/microdevs/missy/service"
+)
+
+// AuthorizationHeader holds the bearer token of the user or service a message was published for
+const AuthorizationHeader = "authorization"
+
+// ErrNoToken is returned for messages without a token in the AuthorizationHeader
+var ErrNoToken = errors.New("message has no token")
+
+// UnauthorizedError is returned when the token of a message is missing or invalid, KafkaReader sends such messages to
+// the DLQ without retries
+type UnauthorizedError struct {
+	Err error
+}
+
+// Error returns the error message
+func (e *UnauthorizedError) Error() string {
+	return fmt.Sprintf("message is not authorized: %v", e.Err)
+}
+
+// Permanent marks authorization errors as permanent
+func (e *UnauthorizedError) Permanent() bool {
+	return true
+}
+
+// ClaimsMessageFunc processes a message with the claims of its token in the context, see service.ClaimsFrom
+type ClaimsMessageFunc func(ctx context.Context, m Message) error
+
+// SetToken attaches a signed token to the message, e.g. the token of the request the message is published for
+func (m *Message) SetToken(token string) {
+	m.SetHeader(AuthorizationHeader, []byte("Bearer "+token))
+}
+
+// MessageClaims validates the token of the message with the keys and options configured for token authentication
+// and returns its claims
+func MessageClaims(m Message) (*service.Claims, error) {
+	header, ok := m.Header(AuthorizationHeader)
+	if !ok {
+		return nil, ErrNoToken
+	}
+	token := strings.TrimPrefix(string(header), "Bearer ")
+	if token == "" {
+		return nil, ErrNoToken
+	}
+	return service.ParseClaims(token)
+}
+
+// Authenticated returns a ReadMessageFunc which validates the token of a message and passes its claims to fn in the
+// context, messages without a valid token are rejected with an *UnauthorizedError
+func Authenticated(fn ClaimsMessageFunc) ReadMessageFunc {
+	return func(m Message) error {
+		claims, err := MessageClaims(m)
+		if err != nil {
+			return &UnauthorizedError{Err: err}
+		}
+		return fn(service.WithClaims(context.Background(), claims), m)
+	}
+}
@@ -0,0 +1,66 @@
+package messaging
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/microdevs/missy/service"
+)
+
+func testToken(t *testing.T, claims jwt.MapClaims) string {
+	data, err := ioutil.ReadFile("../service/test-fixtures/key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAuthenticated(t *testing.T) {
+	os.Setenv("TOKEN_CA_FILE", "../service/test-fixtures/cert.pem")
+	service.Config().ParseEnvironment(true)
+	defer func() {
+		os.Unsetenv("TOKEN_CA_FILE")
+		service.Config().ParseEnvironment(true)
+	}()
+
+	var subject string
+	var hasPolicy bool
+	fn := Authenticated(func(ctx context.Context, m Message) error {
+		claims, ok := service.ClaimsFrom(ctx)
+		if !ok {
+			t.Fatal("expected claims in the context")
+		}
+		subject = claims.Subject
+		hasPolicy = claims.HasPolicy("orders.write")
+		return nil
+	})
+
+	m := Message{Value: []byte("order")}
+	m.SetToken(testToken(t, jwt.MapClaims{"sub": "user-1", "policies": map[string]interface{}{"default": []interface{}{"orders.write"}}}))
+	if err := fn(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if subject != "user-1" || !hasPolicy {
+		t.Errorf("unexpected claims: subject %q, policy %t", subject, hasPolicy)
+	}
+
+	invalid := Message{Value: []byte("order")}
+	invalid.SetToken("not a token")
+	for _, m := range []Message{{Value: []byte("order")}, invalid} {
+		err := fn(m)
+		if _, ok := err.(*UnauthorizedError); !ok || !isPermanent(err) {
+			t.Errorf("expected a permanent *UnauthorizedError but got %v", err)
+		}
+	}
+}
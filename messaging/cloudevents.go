@@ -0,0 +1,327 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/microdevs/missy/service"
+)
+
+// CloudEventsSpecVersion is the version of the CloudEvents specification implemented
+const CloudEventsSpecVersion = "1.0"
+
+// ContentTypeCloudEventsJSON is the content type of events in structured mode
+const ContentTypeCloudEventsJSON = "application/cloudevents+json"
+
+// cloudEventsHeaderPrefix is the prefix of the headers holding the event attributes in binary mode
+const cloudEventsHeaderPrefix = "ce_"
+
+// EventMode selects how an event is mapped to a message
+type EventMode int
+
+const (
+	// BinaryMode keeps the attributes in ce_ headers and the data as message value
+	BinaryMode EventMode = iota
+	// StructuredMode writes the attributes and the data as a JSON envelope
+	StructuredMode
+)
+
+// Event is a CloudEvents 1.0 event
+type Event struct {
+	ID              string
+	Source          string
+	SpecVersion     string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	DataSchema      string
+	Data            []byte
+	// Extensions holds additional attributes by their lower case name
+	Extensions map[string]string
+}
+
+// NewEvent returns an event of the given type with a new ID, the current time and the service name as source
+func NewEvent(eventType string) (Event, error) {
+	id, err := newID()
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:          id,
+		Source:      service.Config().Name,
+		SpecVersion: CloudEventsSpecVersion,
+		Type:        eventType,
+		Time:        time.Now().UTC(),
+	}, nil
+}
+
+// SetData encodes v with the codec as data of the event
+func (e *Event) SetData(codec Codec, v interface{}) error {
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cannot encode %T as %s: %v", v, codec.ContentType(), err)
+	}
+	e.Data = data
+	e.DataContentType = codec.ContentType()
+	return nil
+}
+
+// DecodeData decodes the data of the event into v, a *DecodeError is returned if the event has a different content
+// type or cannot be decoded
+func (e Event) DecodeData(codec Codec, v interface{}) error {
+	if e.DataContentType != "" && e.DataContentType != codec.ContentType() {
+		return &DecodeError{ContentType: codec.ContentType(), Err: fmt.Errorf("unexpected content type %s", e.DataContentType)}
+	}
+	if err := codec.Unmarshal(e.Data, v); err != nil {
+		return &DecodeError{ContentType: codec.ContentType(), Err: err}
+	}
+	return nil
+}
+
+// Validate checks that the required attributes are set
+func (e Event) Validate() error {
+	var missing []string
+	if e.ID == "" {
+		missing = append(missing, "id")
+	}
+	if e.Source == "" {
+		missing = append(missing, "source")
+	}
+	if e.Type == "" {
+		missing = append(missing, "type")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("event is missing required attributes %s", strings.Join(missing, ", "))
+	}
+	if e.SpecVersion != CloudEventsSpecVersion {
+		return fmt.Errorf("unsupported cloudevents spec version %q", e.SpecVersion)
+	}
+	return nil
+}
+
+// Message returns a message with the given key holding the event in the given mode
+func (e Event) Message(key []byte, mode EventMode) (Message, error) {
+	if err := e.Validate(); err != nil {
+		return Message{}, err
+	}
+	if mode == StructuredMode {
+		value, err := json.Marshal(e.envelope())
+		if err != nil {
+			return Message{}, err
+		}
+		msg := Message{Key: key, Value: value, Time: e.Time}
+		msg.SetHeader(ContentTypeHeader, []byte(ContentTypeCloudEventsJSON))
+		return msg, nil
+	}
+
+	msg := Message{Key: key, Value: e.Data, Time: e.Time}
+	for name, value := range e.attributes() {
+		msg.SetHeader(cloudEventsHeaderPrefix+name, []byte(value))
+	}
+	if e.DataContentType != "" {
+		msg.SetHeader(ContentTypeHeader, []byte(e.DataContentType))
+	}
+	return msg, nil
+}
+
+// PublishEvent writes the event with the given key in the given mode
+func PublishEvent(ctx context.Context, w Writer, key []byte, e Event, mode EventMode) error {
+	msg, err := e.Message(key, mode)
+	if err != nil {
+		return err
+	}
+	return w.WriteContext(ctx, msg)
+}
+
+// EventFromMessage decodes an event in binary or structured mode, a *DecodeError is returned if the message holds
+// no valid event, so KafkaReader sends it to the DLQ without retries
+func EventFromMessage(m Message) (Event, error) {
+	e, err := eventFromMessage(m)
+	if err == nil {
+		err = e.Validate()
+	}
+	if err != nil {
+		return Event{}, &DecodeError{ContentType: ContentTypeCloudEventsJSON, Err: err}
+	}
+	return e, nil
+}
+
+// eventFromMessage decodes an event depending on the mode of the message
+func eventFromMessage(m Message) (Event, error) {
+	contentType, _ := m.Header(ContentTypeHeader)
+	if strings.HasPrefix(string(contentType), "application/cloudevents") {
+		return eventFromEnvelope(m.Value)
+	}
+
+	if _, ok := m.Header(cloudEventsHeaderPrefix + "specversion"); !ok {
+		return Event{}, errors.New("message is no cloudevent, it has neither a cloudevents content type nor a ce_specversion header")
+	}
+	attributes := make(map[string]string)
+	for _, h := range m.Headers {
+		if strings.HasPrefix(h.Key, cloudEventsHeaderPrefix) {
+			attributes[strings.TrimPrefix(h.Key, cloudEventsHeaderPrefix)] = string(h.Value)
+		}
+	}
+	e, err := eventFromAttributes(attributes)
+	if err != nil {
+		return Event{}, err
+	}
+	e.DataContentType = string(contentType)
+	e.Data = m.Value
+	return e, nil
+}
+
+// attributes returns the attributes of the event except data and datacontenttype by name
+func (e Event) attributes() map[string]string {
+	attributes := make(map[string]string, len(e.Extensions)+7)
+	for name, value := range e.Extensions {
+		attributes[strings.ToLower(name)] = value
+	}
+	attributes["id"] = e.ID
+	attributes["source"] = e.Source
+	attributes["specversion"] = e.SpecVersion
+	attributes["type"] = e.Type
+	if e.Subject != "" {
+		attributes["subject"] = e.Subject
+	}
+	if !e.Time.IsZero() {
+		attributes["time"] = e.Time.Format(time.RFC3339Nano)
+	}
+	if e.DataSchema != "" {
+		attributes["dataschema"] = e.DataSchema
+	}
+	return attributes
+}
+
+// eventFromAttributes returns an event with the given attributes, unknown attributes become extensions
+func eventFromAttributes(attributes map[string]string) (Event, error) {
+	var e Event
+	for name, value := range attributes {
+		switch name {
+		case "id":
+			e.ID = value
+		case "source":
+			e.Source = value
+		case "specversion":
+			e.SpecVersion = value
+		case "type":
+			e.Type = value
+		case "subject":
+			e.Subject = value
+		case "dataschema":
+			e.DataSchema = value
+		case "datacontenttype":
+			e.DataContentType = value
+		case "time":
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return Event{}, fmt.Errorf("invalid time attribute %q: %v", value, err)
+			}
+			e.Time = t
+		default:
+			if e.Extensions == nil {
+				e.Extensions = make(map[string]string)
+			}
+			e.Extensions[name] = value
+		}
+	}
+	return e, nil
+}
+
+// envelope is the JSON format of an event in structured mode, data is embedded as JSON if it has a JSON content type
+// and base64 encoded otherwise
+type envelope map[string]interface{}
+
+// envelope returns the structured mode representation of the event
+func (e Event) envelope() envelope {
+	env := make(envelope)
+	for name, value := range e.attributes() {
+		env[name] = value
+	}
+	if e.DataContentType != "" {
+		env["datacontenttype"] = e.DataContentType
+	}
+	if e.Data != nil {
+		if isJSONContentType(e.DataContentType) && json.Valid(e.Data) {
+			env["data"] = json.RawMessage(e.Data)
+		} else {
+			env["data_base64"] = e.Data
+		}
+	}
+	return env
+}
+
+// eventFromEnvelope returns the event of a structured mode envelope
+func eventFromEnvelope(value []byte) (Event, error) {
+	var env map[string]json.RawMessage
+	if err := json.Unmarshal(value, &env); err != nil {
+		return Event{}, err
+	}
+
+	attributes := make(map[string]string, len(env))
+	for name, raw := range env {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+		s, ok, err := attributeString(raw)
+		if err != nil {
+			return Event{}, fmt.Errorf("attribute %s %v", name, err)
+		}
+		if ok {
+			attributes[name] = s
+		}
+	}
+	e, err := eventFromAttributes(attributes)
+	if err != nil {
+		return Event{}, err
+	}
+
+	if raw, ok := env["data_base64"]; ok {
+		if err := json.Unmarshal(raw, &e.Data); err != nil {
+			return Event{}, fmt.Errorf("invalid data_base64: %v", err)
+		}
+	} else if raw, ok := env["data"]; ok {
+		e.Data = []byte(raw)
+	}
+	return e, nil
+}
+
+// attributeString returns the canonical string form of a JSON attribute value, integers and booleans are converted as
+// described by the JSON event format, null is treated as a missing attribute
+func attributeString(raw json.RawMessage) (string, bool, error) {
+	var value interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&value); err != nil {
+		return "", false, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, true, nil
+	case bool:
+		return strconv.FormatBool(v), true, nil
+	case json.Number:
+		i, err := strconv.ParseInt(v.String(), 10, 32)
+		if err != nil {
+			return "", false, fmt.Errorf("is not a 32 bit integer: %s", v)
+		}
+		return strconv.FormatInt(i, 10), true, nil
+	default:
+		return "", false, errors.New("is not a string, integer or boolean")
+	}
+}
+
+// isJSONContentType checks for application/json and content types with a +json suffix
+func isJSONContentType(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	return mediaType == "" || mediaType == ContentTypeJSON || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,133 @@
+package messaging
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/microdevs/missy/service"
+)
+
+func testEvent(t *testing.T) Event {
+	e, err := NewEvent("com.example.order.created")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	e.Source = "orders"
+	e.Subject = "order-1"
+	e.Time = time.Date(2018, 5, 1, 10, 30, 0, 0, time.UTC)
+	e.Extensions = map[string]string{"traceparent": "00-abc-def-01"}
+	if err := e.SetData(JSONCodec{}, orderCreated{ID: "order-1", Total: 42}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return e
+}
+
+func TestNewEvent(t *testing.T) {
+	e, err := NewEvent("com.example.order.created")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.ID == "" || e.SpecVersion != "1.0" || e.Source != service.Config().Name || e.Time.IsZero() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestEvent_Modes(t *testing.T) {
+	for _, mode := range []EventMode{BinaryMode, StructuredMode} {
+		e := testEvent(t)
+		msg, err := e.Message([]byte("order-1"), mode)
+		if err != nil {
+			t.Fatalf("Unexpected error in mode %d: %v", mode, err)
+		}
+
+		decoded, err := EventFromMessage(msg)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding mode %d: %v", mode, err)
+		}
+		if !reflect.DeepEqual(decoded, e) {
+			t.Errorf("Expected event %+v in mode %d, got %+v", e, mode, decoded)
+		}
+
+		var order orderCreated
+		if err := decoded.DecodeData(JSONCodec{}, &order); err != nil || order.ID != "order-1" || order.Total != 42 {
+			t.Errorf("Expected decoded order order-1, got %+v (%v)", order, err)
+		}
+	}
+}
+
+func TestEvent_BinaryModeHeaders(t *testing.T) {
+	msg, err := testEvent(t).Message(nil, BinaryMode)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for header, expected := range map[string]string{
+		"ce_type":        "com.example.order.created",
+		"ce_subject":     "order-1",
+		"ce_specversion": "1.0",
+		"ce_time":        "2018-05-01T10:30:00Z",
+		"ce_traceparent": "00-abc-def-01",
+		"content-type":   ContentTypeJSON,
+	} {
+		if value, _ := msg.Header(header); string(value) != expected {
+			t.Errorf("Expected header %s to be %s, got %s", header, expected, value)
+		}
+	}
+	if string(msg.Value) != `{"id":"order-1","total":42}` {
+		t.Errorf("Expected data as message value, got %s", msg.Value)
+	}
+}
+
+func TestEvent_StructuredModeBinaryData(t *testing.T) {
+	e := testEvent(t)
+	e.DataContentType = ContentTypeProtobuf
+	e.Data = []byte{0x0a, 0x01}
+
+	msg, err := e.Message(nil, StructuredMode)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	decoded, err := EventFromMessage(msg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Data, e.Data) {
+		t.Errorf("Expected data %v, got %v", e.Data, decoded.Data)
+	}
+}
+
+func TestEventFromMessage_Invalid(t *testing.T) {
+	missingType := Message{Headers: []Header{{Key: "ce_specversion", Value: []byte("1.0")}, {Key: "ce_id", Value: []byte("1")}, {Key: "ce_source", Value: []byte("orders")}}}
+	structured := Message{Value: []byte("{"), Headers: []Header{{Key: ContentTypeHeader, Value: []byte(ContentTypeCloudEventsJSON)}}}
+
+	for name, msg := range map[string]Message{"no event": {Value: []byte("{}")}, "missing type": missingType, "invalid json": structured} {
+		_, err := EventFromMessage(msg)
+		if !isPermanent(err) {
+			t.Errorf("Expected a permanent error for %s, got %v", name, err)
+		}
+	}
+	if err := (Event{ID: "1", Source: "orders", Type: "created", SpecVersion: "0.3"}).Validate(); err == nil {
+		t.Error("Expected spec version 0.3 to be rejected")
+	}
+}
+
+func TestEventFromMessage_NonStringAttributes(t *testing.T) {
+	value := `{"specversion": "1.0", "id": "1", "source": "orders", "type": "created", "sequence": 42, "sampled": true, "traceparent": null}`
+	msg := Message{Value: []byte(value), Headers: []Header{{Key: ContentTypeHeader, Value: []byte(ContentTypeCloudEventsJSON)}}}
+
+	e, err := EventFromMessage(msg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{"sequence": "42", "sampled": "true"}
+	if !reflect.DeepEqual(e.Extensions, expected) {
+		t.Errorf("Expected extensions %v, got %v", expected, e.Extensions)
+	}
+
+	for _, attribute := range []string{`1.5`, `4294967296`, `{"a": 1}`} {
+		msg.Value = []byte(`{"specversion": "1.0", "id": "1", "source": "orders", "type": "created", "sequence": ` + attribute + `}`)
+		if _, err := EventFromMessage(msg); !isPermanent(err) {
+			t.Errorf("Expected a permanent error for %s, got %v", attribute, err)
+		}
+	}
+}
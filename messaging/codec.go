@@ -0,0 +1,210 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/microdevs/missy/messaging/avro"
+	"github.com/pkg/errors"
+)
+
+// ContentTypeHeader is the header which records the content type of an encoded message value
+const ContentTypeHeader = "content-type"
+
+// content types of the built in codecs
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+)
+
+// Codec encodes and decodes message values
+type Codec interface {
+	// ContentType returns the content type recorded in the ContentTypeHeader of encoded messages
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// permanent is implemented by errors which will not go away by processing the message again
+type permanent interface {
+	Permanent() bool
+}
+
+// isPermanent checks if the cause of an error is permanent, such messages are sent to the DLQ without retries
+func isPermanent(err error) bool {
+	p, ok := errors.Cause(err).(permanent)
+	return ok && p.Permanent()
+}
+
+// DecodeError is returned when a message value cannot be decoded, KafkaReader sends such messages to the DLQ without retries
+type DecodeError struct {
+	ContentType string
+	Err         error
+}
+
+// Error returns the error message
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cannot decode message as %s: %v", e.ContentType, e.Err)
+}
+
+// Permanent marks decoding errors as permanent
+func (e *DecodeError) Permanent() bool {
+	return true
+}
+
+// JSONCodec encodes values as JSON
+type JSONCodec struct{}
+
+// ContentType returns application/json
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+// Marshal encodes v as JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec encodes values implementing proto.Message
+type ProtobufCodec struct{}
+
+// ContentType returns application/x-protobuf
+func (ProtobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+// Marshal encodes v which has to be a proto.Message
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Marshal(pm)
+}
+
+// Unmarshal decodes data into v which has to be a proto.Message
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, pm)
+}
+
+// AvroCodec encodes values in the Avro binary encoding of a schema, using the messaging/avro package. Struct fields are
+// matched to the fields of the schema by their avro tag.
+type AvroCodec struct {
+	Schema *avro.Schema
+}
+
+// NewAvroCodec parses the Avro schema and returns a codec for it
+func NewAvroCodec(schema string) (*AvroCodec, error) {
+	parsed, err := avro.Parse(schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse avro schema")
+	}
+	return &AvroCodec{Schema: parsed}, nil
+}
+
+// ContentType returns application/avro
+func (c *AvroCodec) ContentType() string {
+	return ContentTypeAvro
+}
+
+// Marshal encodes v in the Avro binary encoding
+func (c *AvroCodec) Marshal(v interface{}) ([]byte, error) {
+	return avro.Marshal(c.Schema, v)
+}
+
+// Unmarshal decodes Avro binary data into v
+func (c *AvroCodec) Unmarshal(data []byte, v interface{}) error {
+	return avro.Unmarshal(c.Schema, data, v)
+}
+
+// Encode returns a message with the encoded value and the content type header of the codec
+func Encode(codec Codec, key []byte, v interface{}) (Message, error) {
+	value, err := codec.Marshal(v)
+	if err != nil {
+		return Message{}, errors.Wrapf(err, "cannot encode %T as %s", v, codec.ContentType())
+	}
+	msg := Message{Key: key, Value: value}
+	msg.SetHeader(ContentTypeHeader, []byte(codec.ContentType()))
+	return msg, nil
+}
+
+// Decode decodes the value of a message into v, a *DecodeError is returned if the message has a different content
+// type or cannot be decoded
+func Decode(codec Codec, msg Message, v interface{}) error {
+	if contentType, ok := msg.Header(ContentTypeHeader); ok && string(contentType) != codec.ContentType() {
+		return &DecodeError{ContentType: codec.ContentType(), Err: fmt.Errorf("unexpected content type %s", contentType)}
+	}
+	if err := codec.Unmarshal(msg.Value, v); err != nil {
+		// errors which know whether they are permanent, e.g. a failed schema lookup, are returned as they are
+		if _, ok := err.(permanent); ok {
+			return err
+		}
+		return &DecodeError{ContentType: codec.ContentType(), Err: err}
+	}
+	return nil
+}
+
+// Publish encodes v with the codec and writes it with the given key
+func Publish(ctx context.Context, w Writer, codec Codec, key []byte, v interface{}) error {
+	msg, err := Encode(codec, key, v)
+	if err != nil {
+		return err
+	}
+	return w.WriteContext(ctx, msg)
+}
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	messageType = reflect.TypeOf(Message{})
+)
+
+// Handler returns a ReadMessageFunc which decodes messages with the codec and calls fn with the decoded value.
+// fn has to be a func(T) error or func(Message, T) error, where T is the type messages are decoded into, e.g.
+//
+//	reader.Read(messaging.Handler(messaging.JSONCodec{}, func(o OrderCreated) error { ... }))
+//
+// Handler panics if fn has a different signature. Messages which cannot be decoded are sent to the DLQ.
+func Handler(codec Codec, fn interface{}) ReadMessageFunc {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumIn() < 1 || ft.NumIn() > 2 || ft.NumOut() != 1 || ft.Out(0) != errorType ||
+		(ft.NumIn() == 2 && ft.In(0) != messageType) {
+		panic(fmt.Sprintf("messaging: handler has to be a func(T) error or func(Message, T) error, got %s", ft))
+	}
+	valueType := ft.In(ft.NumIn() - 1)
+
+	return func(msg Message) error {
+		// decode into a pointer, so the codecs can fill the value
+		pv := reflect.New(valueType)
+		if valueType.Kind() == reflect.Ptr {
+			pv.Elem().Set(reflect.New(valueType.Elem()))
+			if err := Decode(codec, msg, pv.Elem().Interface()); err != nil {
+				return err
+			}
+		} else if err := Decode(codec, msg, pv.Interface()); err != nil {
+			return err
+		}
+
+		args := []reflect.Value{pv.Elem()}
+		if ft.NumIn() == 2 {
+			args = []reflect.Value{reflect.ValueOf(msg), pv.Elem()}
+		}
+		if err, _ := fv.Call(args)[0].Interface().(error); err != nil {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/pkg/errors"
+)
+
+type orderCreated struct {
+	ID    string `json:"id" avro:"id"`
+	Total int    `json:"total" avro:"total"`
+}
+
+const orderCreatedSchema = `{"type": "record", "name": "OrderCreated", "fields": [{"name": "id", "type": "string"}, {"name": "total", "type": "int"}]}`
+
+func TestCodecs(t *testing.T) {
+	avroCodec, err := NewAvroCodec(orderCreatedSchema)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the avro schema: %v", err)
+	}
+	codecs := []Codec{JSONCodec{}, avroCodec}
+
+	for _, codec := range codecs {
+		msg, err := Encode(codec, []byte("key"), orderCreated{ID: "1", Total: 42})
+		if err != nil {
+			t.Fatalf("unexpected error encoding %s: %v", codec.ContentType(), err)
+		}
+
+		if contentType, _ := msg.Header(ContentTypeHeader); string(contentType) != codec.ContentType() {
+			t.Errorf("invalid content type: expected: %s, got %s", codec.ContentType(), contentType)
+		}
+
+		var order orderCreated
+		if err := Decode(codec, msg, &order); err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", codec.ContentType(), err)
+		}
+		if order.ID != "1" || order.Total != 42 {
+			t.Errorf("invalid order decoded from %s: %+v", codec.ContentType(), order)
+		}
+	}
+}
+
+func TestAvroCodec_BinaryEncoding(t *testing.T) {
+	codec, err := NewAvroCodec(orderCreatedSchema)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the avro schema: %v", err)
+	}
+
+	data, err := codec.Marshal(orderCreated{ID: "1", Total: 42})
+	if err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+	// the string length and the int are zig-zag encoded varints
+	if expected := []byte{0x02, '1', 0x54}; !bytes.Equal(data, expected) {
+		t.Errorf("invalid avro binary encoding: expected %x, got %x", expected, data)
+	}
+
+	if _, err := NewAvroCodec(`{"type": "record"}`); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	codec := ProtobufCodec{}
+
+	msg, err := Encode(codec, nil, &wrappers.StringValue{Value: "order"})
+	if err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+
+	var value wrappers.StringValue
+	if err := Decode(codec, msg, &value); err != nil {
+		t.Fatalf("unexpected error decoding: %v", err)
+	}
+	if value.Value != "order" {
+		t.Errorf("invalid value: expected: order, got %s", value.Value)
+	}
+
+	if _, err := codec.Marshal(orderCreated{}); err == nil {
+		t.Error("there should be an error encoding a value which is no proto.Message")
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	msg := Message{Value: []byte("{}")}
+	msg.SetHeader(ContentTypeHeader, []byte(ContentTypeProtobuf))
+
+	err := Decode(JSONCodec{}, msg, &orderCreated{})
+	if _, ok := err.(*DecodeError); !ok {
+		t.Errorf("expected a DecodeError for a different content type, got %v", err)
+	}
+
+	err = Decode(JSONCodec{}, Message{Value: []byte("not json")}, &orderCreated{})
+	if !isPermanent(errors.Wrap(err, "wrapped")) {
+		t.Errorf("expected a permanent error for an invalid value, got %v", err)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	writerMock := NewMockWriter(mockCtrl)
+
+	ctx := context.Background()
+	expectedMsg, _ := Encode(JSONCodec{}, []byte("key"), orderCreated{ID: "1"})
+	writerMock.EXPECT().WriteContext(ctx, expectedMsg).Return(nil)
+
+	if err := Publish(ctx, writerMock, JSONCodec{}, []byte("key"), orderCreated{ID: "1"}); err != nil {
+		t.Errorf("unexpected error during Publish: %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	msg, _ := Encode(JSONCodec{}, []byte("key"), orderCreated{ID: "1"})
+
+	var received orderCreated
+	if err := Handler(JSONCodec{}, func(o orderCreated) error {
+		received = o
+		return nil
+	})(msg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if received.ID != "1" {
+		t.Errorf("invalid order received: %+v", received)
+	}
+
+	var receivedKey string
+	if err := Handler(JSONCodec{}, func(m Message, o *orderCreated) error {
+		receivedKey = string(m.Key)
+		received = *o
+		return errors.New("handler error")
+	})(msg); err == nil || err.Error() != "handler error" {
+		t.Errorf("expected the handler error, got %v", err)
+	}
+	if receivedKey != "key" {
+		t.Errorf("invalid key received: %s", receivedKey)
+	}
+
+	err := Handler(JSONCodec{}, func(o orderCreated) error {
+		t.Error("handler should not be called for an invalid message")
+		return nil
+	})(Message{Value: []byte("not json")})
+	if !isPermanent(err) {
+		t.Errorf("expected a permanent error, got %v", err)
+	}
+}
+
+func TestHandler_InvalidSignature(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Handler should panic for an invalid handler")
+		}
+	}()
+	Handler(JSONCodec{}, func(o orderCreated) {})
+}
+
+func TestKafkaReader_DecodeErrorKeepsContentTypeInDLQ(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	msg, _ := Encode(ProtobufCodec{}, []byte("key"), &wrappers.StringValue{Value: "order"})
+
+	brokerReaderMock := NewMockBrokerReader(mockCtrl)
+	gomock.InOrder(
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).Return(msg, nil),
+		brokerReaderMock.EXPECT().CommitMessages(gomock.Any(), msg).Return(nil),
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).Return(Message{}, errors.New("closed")),
+	)
+	dead := make(chan Message, 1)
+	dlqWriterMock := NewMockWriter(mockCtrl)
+	dlqWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).Do(func(_ context.Context, msgs ...Message) { dead <- msgs[0] }).Return(nil)
+	reader := KafkaReader{brokerReader: brokerReaderMock, maxRetries: 3, dlqWriter: dlqWriterMock}
+
+	reader.Read(Handler(JSONCodec{}, func(o orderCreated) error { return nil }))
+
+	select {
+	case m := <-dead:
+		if contentType, _ := m.Header(ContentTypeHeader); string(contentType) != ContentTypeProtobuf {
+			t.Errorf("expected the content type %s in the dead letter queue, got %q", ContentTypeProtobuf, contentType)
+		}
+		if string(m.Value) != string(msg.Value) {
+			t.Error("expected the encoded value in the dead letter queue")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the message to be sent to the dead letter queue")
+	}
+	time.Sleep(time.Millisecond * 10)
+}
@@ -10,11 +10,23 @@ import (
 const defaultKafkaMaxRetries = 3
 const defaultKafkaRetriesInterval = time.Second * 5
 const defaultKafkaRetentionTime = time.Minute * 60 * 24 * 30
+const defaultKafkaBrokers = "localhost:9092"
+const defaultKafkaWriterBatchSize = 100
+const defaultKafkaWriterLinger = time.Millisecond * 50
+const defaultKafkaWriterBufferSize = 10000
 
 const (
-	kafkaRetriesMaxNumber = "kafka.retries.max.number"
-	kafkaRetriesInterval  = "kafka.retries.interval"
-	kafkaRetentionTime    = "kafka.retention.time"
+	kafkaRetriesMaxNumber   = "kafka.retries.max.number"
+	kafkaRetriesInterval    = "kafka.retries.interval"
+	kafkaRetentionTime      = "kafka.retention.time"
+	kafkaBrokers            = "kafka.brokers"
+	kafkaGroupID            = "kafka.group.id"
+	kafkaWriterBatchSize    = "kafka.writer.batch.size"
+	kafkaWriterLinger       = "kafka.writer.linger"
+	kafkaWriterBufferSize   = "kafka.writer.buffer.size"
+	kafkaSchemaRegistryURL  = "kafka.schema.registry.url"
+	kafkaEncryptionKeyFiles = "kafka.encryption.key.files"
+	kafkaSigningKeyFiles    = "kafka.signing.key.files"
 )
 
 func init() {
@@ -26,5 +38,13 @@ func InitConfig() {
 	cfg.RegisterOptionalParameter("KAFKA_RETRIES_MAX_NUMBER", strconv.Itoa(defaultKafkaMaxRetries), kafkaRetriesMaxNumber, "The number of times a kafka reader will retry")
 	cfg.RegisterOptionalParameter("KAFKA_RETRIES_INTERVAL", defaultKafkaRetriesInterval.String(), kafkaRetriesInterval, "The time between retries in a kafka reader")
 	cfg.RegisterOptionalParameter("KAFKA_RETENTION_TIME", defaultKafkaRetentionTime.String(), kafkaRetentionTime, "Consumer retention duration on kafka broker, defaults to "+defaultKafkaRetentionTime.String())
+	cfg.RegisterOptionalParameter("KAFKA_BROKERS", defaultKafkaBrokers, kafkaBrokers, "Comma separated list of kafka broker addresses, defaults to "+defaultKafkaBrokers)
+	cfg.RegisterOptionalParameter("KAFKA_GROUP_ID", "", kafkaGroupID, "The consumer group id used by readers created from config, defaults to the service name")
+	cfg.RegisterOptionalParameter("KAFKA_WRITER_BATCH_SIZE", strconv.Itoa(defaultKafkaWriterBatchSize), kafkaWriterBatchSize, "The number of messages an asynchronous writer sends in one batch")
+	cfg.RegisterOptionalParameter("KAFKA_WRITER_LINGER", defaultKafkaWriterLinger.String(), kafkaWriterLinger, "The maximum time an asynchronous writer waits for a batch to fill up")
+	cfg.RegisterOptionalParameter("KAFKA_WRITER_BUFFER_SIZE", strconv.Itoa(defaultKafkaWriterBufferSize), kafkaWriterBufferSize, "The maximum number of messages an asynchronous writer buffers before writes block")
+	cfg.RegisterOptionalParameter("KAFKA_SCHEMA_REGISTRY_URL", "", kafkaSchemaRegistryURL, "The URL of the schema registry, a file:// URL uses a local file as schema registry")
+	cfg.RegisterOptionalParameter("KAFKA_ENCRYPTION_KEY_FILES", "", kafkaEncryptionKeyFiles, "Comma separated files of base64 encoded AES keys wrapping the data keys of sealed messages, the first key is used for new messages")
+	cfg.RegisterOptionalParameter("KAFKA_SIGNING_KEY_FILES", "", kafkaSigningKeyFiles, "Comma separated files of HMAC secrets or Ed25519 PEM keys signing sealed messages, the first key is used for new messages")
 	cfg.Parse()
 }
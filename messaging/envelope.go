@@ -0,0 +1,270 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// headers of sealed messages
+const (
+	// EncryptionKeyIDHeader holds the ID of the key-encryption key which wrapped the data key
+	EncryptionKeyIDHeader = "enc-key-id"
+	// DataKeyHeader holds the data key the value is encrypted with, wrapped by the key-encryption key
+	DataKeyHeader = "enc-data-key"
+	// SignatureAlgorithmHeader holds the algorithm of the signature, HMAC-SHA256 or Ed25519
+	SignatureAlgorithmHeader = "sig-alg"
+	// SignatureKeyIDHeader holds the ID of the key which signed the message
+	SignatureKeyIDHeader = "sig-key-id"
+	// SignatureHeader holds the signature of the key, value and encryption headers
+	SignatureHeader = "sig"
+)
+
+var envelopeHeaders = []string{EncryptionKeyIDHeader, DataKeyHeader, SignatureAlgorithmHeader, SignatureKeyIDHeader, SignatureHeader}
+
+// dataKeySize is the size of the AES-256 key generated for every message
+const dataKeySize = 32
+
+// EnvelopeError is returned when a message cannot be opened, e.g. because its signature is invalid or the key it was
+// sealed with is unknown. KafkaReader sends such messages to the DLQ without retries.
+type EnvelopeError struct {
+	Err error
+}
+
+// Error returns the error message
+func (e *EnvelopeError) Error() string {
+	return fmt.Sprintf("cannot open message envelope: %v", e.Err)
+}
+
+// Permanent marks envelope errors as permanent
+func (e *EnvelopeError) Permanent() bool {
+	return true
+}
+
+// Seal encrypts the value of the message with a new AES-GCM data key, which is wrapped by the active encryption key,
+// and signs it with the active signing key. Without encryption keys the value is only signed and vice versa.
+func (k *KeyRing) Seal(m Message) (Message, error) {
+	sealed := m
+	sealed.Headers = append([]Header(nil), m.Headers...)
+
+	if k.encrypts() {
+		kekID, kek, _ := k.encryptionKey("")
+		dataKey := make([]byte, dataKeySize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return Message{}, fmt.Errorf("cannot create data key: %v", err)
+		}
+		// the message key is authenticated with the value, so a value cannot be moved to another key
+		value, err := gcmSeal(dataKey, m.Value, m.Key)
+		if err != nil {
+			return Message{}, err
+		}
+		wrapped, err := gcmSeal(kek, dataKey, []byte(kekID))
+		if err != nil {
+			return Message{}, err
+		}
+		sealed.Value = value
+		sealed.SetHeader(EncryptionKeyIDHeader, []byte(kekID))
+		sealed.SetHeader(DataKeyHeader, wrapped)
+	}
+
+	if k.signs() {
+		keyID, key, _ := k.signingKey("")
+		sealed.SetHeader(SignatureAlgorithmHeader, []byte(key.algorithm()))
+		sealed.SetHeader(SignatureKeyIDHeader, []byte(keyID))
+		signature, err := key.sign(signedData(sealed))
+		if err != nil {
+			return Message{}, err
+		}
+		sealed.SetHeader(SignatureHeader, signature)
+	}
+	return sealed, nil
+}
+
+// Open verifies the signature of a sealed message and decrypts its value, the envelope headers are removed. Messages
+// which are not signed or encrypted although the key ring has such keys are rejected with an *EnvelopeError.
+func (k *KeyRing) Open(m Message) (Message, error) {
+	if k.signs() {
+		if err := k.verify(m); err != nil {
+			return Message{}, &EnvelopeError{Err: err}
+		}
+	}
+
+	opened := m
+	if k.encrypts() {
+		value, err := k.decrypt(m)
+		if err != nil {
+			return Message{}, &EnvelopeError{Err: err}
+		}
+		opened.Value = value
+	}
+
+	opened.Headers = nil
+	for _, h := range m.Headers {
+		if !isEnvelopeHeader(h.Key) {
+			opened.Headers = append(opened.Headers, h)
+		}
+	}
+	return opened, nil
+}
+
+// verify checks the signature of a message with the key it was signed with
+func (k *KeyRing) verify(m Message) error {
+	keyID, ok := m.Header(SignatureKeyIDHeader)
+	if !ok {
+		return errors.New("message is not signed")
+	}
+	_, key, ok := k.signingKey(string(keyID))
+	if !ok {
+		return fmt.Errorf("unknown signing key %s", keyID)
+	}
+	if alg, _ := m.Header(SignatureAlgorithmHeader); string(alg) != key.algorithm() {
+		return fmt.Errorf("signature algorithm %s does not match %s key %s", alg, key.algorithm(), keyID)
+	}
+	signature, _ := m.Header(SignatureHeader)
+	if !key.verify(signedData(m), signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// decrypt unwraps the data key of a message and decrypts its value
+func (k *KeyRing) decrypt(m Message) ([]byte, error) {
+	kekID, ok := m.Header(EncryptionKeyIDHeader)
+	if !ok {
+		return nil, errors.New("message is not encrypted")
+	}
+	_, kek, ok := k.encryptionKey(string(kekID))
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %s", kekID)
+	}
+	wrapped, _ := m.Header(DataKeyHeader)
+	dataKey, err := gcmOpen(kek, wrapped, kekID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unwrap data key: %v", err)
+	}
+	value, err := gcmOpen(dataKey, m.Value, m.Key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt value: %v", err)
+	}
+	return value, nil
+}
+
+// signedData returns the key, value and envelope headers of a message in an unambiguous encoding
+func signedData(m Message) []byte {
+	var buf bytes.Buffer
+	write := func(b []byte) {
+		binary.Write(&buf, binary.BigEndian, uint32(len(b)))
+		buf.Write(b)
+	}
+	write(m.Key)
+	write(m.Value)
+	for _, header := range []string{EncryptionKeyIDHeader, DataKeyHeader, SignatureAlgorithmHeader, SignatureKeyIDHeader} {
+		value, _ := m.Header(header)
+		write(value)
+	}
+	return buf.Bytes()
+}
+
+// gcmSeal encrypts plaintext with AES-GCM, the random nonce is prepended to the ciphertext
+func gcmSeal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot create nonce: %v", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// gcmOpen decrypts a ciphertext created by gcmSeal
+func gcmOpen(key []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce := ciphertext[:gcm.NonceSize()]
+	return gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isEnvelopeHeader(key string) bool {
+	for _, h := range envelopeHeaders {
+		if h == key {
+			return true
+		}
+	}
+	return false
+}
+
+// envelopeWriter seals all messages before writing them
+type envelopeWriter struct {
+	Writer
+	keys *KeyRing
+}
+
+// NewEnvelopeWriter returns a writer which seals the messages with the key ring before writing them with w
+func NewEnvelopeWriter(w Writer, keys *KeyRing) Writer {
+	return &envelopeWriter{Writer: w, keys: keys}
+}
+
+// Write seals and writes a message
+func (ew *envelopeWriter) Write(key, value []byte) error {
+	return ew.WriteContext(context.Background(), Message{Key: key, Value: value})
+}
+
+// WriteContext seals and writes messages
+func (ew *envelopeWriter) WriteContext(ctx context.Context, msgs ...Message) error {
+	sealed := make([]Message, len(msgs))
+	for i, m := range msgs {
+		var err error
+		if sealed[i], err = ew.keys.Seal(m); err != nil {
+			return err
+		}
+	}
+	return ew.Writer.WriteContext(ctx, sealed...)
+}
+
+// envelopeReader opens all messages before passing them to the read func
+type envelopeReader struct {
+	Reader
+	keys *KeyRing
+}
+
+// NewEnvelopeReader returns a reader which opens the messages read by r with the key ring before the read func runs
+func NewEnvelopeReader(r Reader, keys *KeyRing) Reader {
+	return &envelopeReader{Reader: r, keys: keys}
+}
+
+// Read opens messages before calling msgFunc
+func (er *envelopeReader) Read(msgFunc ReadMessageFunc) error {
+	return er.Reader.Read(OpenEnvelope(er.keys, msgFunc))
+}
+
+// OpenEnvelope returns a ReadMessageFunc which opens messages with the key ring before calling msgFunc, messages
+// which cannot be opened are sent to the DLQ
+func OpenEnvelope(keys *KeyRing, msgFunc ReadMessageFunc) ReadMessageFunc {
+	return func(m Message) error {
+		opened, err := keys.Open(m)
+		if err != nil {
+			return err
+		}
+		return msgFunc(opened)
+	}
+}
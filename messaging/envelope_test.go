@@ -0,0 +1,227 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/microdevs/missy/service"
+)
+
+func testKeyRing(t *testing.T, kekID string, kek byte) *KeyRing {
+	keys := NewKeyRing()
+	if err := keys.AddEncryptionKey(kekID, bytes.Repeat([]byte{kek}, 32)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := keys.AddHMACKey("hmac-1", bytes.Repeat([]byte{1}, 32)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return keys
+}
+
+func TestKeyRing_SealOpen(t *testing.T) {
+	keys := testKeyRing(t, "kek-1", 7)
+	m := Message{Key: []byte("customer-1"), Value: []byte(`{"email":"jane@example.com"}`), Headers: []Header{{Key: "trace", Value: []byte("1")}}}
+
+	sealed, err := keys.Seal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if bytes.Contains(sealed.Value, []byte("jane")) {
+		t.Error("Expected the value to be encrypted")
+	}
+	if id, _ := sealed.Header(EncryptionKeyIDHeader); string(id) != "kek-1" {
+		t.Errorf("Expected encryption key id kek-1, got %s", id)
+	}
+	if alg, _ := sealed.Header(SignatureAlgorithmHeader); string(alg) != SignatureHMACSHA256 {
+		t.Errorf("Expected signature algorithm %s, got %s", SignatureHMACSHA256, alg)
+	}
+
+	opened, err := keys.Open(sealed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(opened.Value, m.Value) || len(opened.Headers) != 1 || opened.Headers[0].Key != "trace" {
+		t.Errorf("Expected the original message, got %+v", opened)
+	}
+}
+
+func TestKeyRing_OpenRejectsTamperedMessages(t *testing.T) {
+	keys := testKeyRing(t, "kek-1", 7)
+	sealed, _ := keys.Seal(Message{Key: []byte("customer-1"), Value: []byte("secret")})
+
+	otherKey := sealed
+	otherKey.Key = []byte("customer-2")
+	tampered := sealed
+	tampered.Value = append([]byte(nil), sealed.Value...)
+	tampered.Value[len(tampered.Value)-1] ^= 1
+	unsigned := Message{Key: []byte("customer-1"), Value: []byte("secret")}
+
+	for name, m := range map[string]Message{"other key": otherKey, "tampered value": tampered, "unsigned": unsigned} {
+		if _, err := keys.Open(m); !isPermanent(err) {
+			t.Errorf("Expected a permanent error for %s, got %v", name, err)
+		}
+	}
+
+	// without signing keys the encryption still authenticates the value
+	encryptOnly := NewKeyRing()
+	encryptOnly.AddEncryptionKey("kek-1", bytes.Repeat([]byte{7}, 32))
+	if _, err := encryptOnly.Open(tampered); !isPermanent(err) {
+		t.Errorf("Expected a permanent error for a tampered value, got %v", err)
+	}
+}
+
+func TestKeyRing_Rotation(t *testing.T) {
+	old := testKeyRing(t, "kek-1", 7)
+	sealed, _ := old.Seal(Message{Value: []byte("secret")})
+
+	rotated := testKeyRing(t, "kek-2", 8)
+	rotated.AddEncryptionKey("kek-1", bytes.Repeat([]byte{7}, 32))
+
+	opened, err := rotated.Open(sealed)
+	if err != nil || string(opened.Value) != "secret" {
+		t.Errorf("Expected a message sealed with the old key to be opened, got %s (%v)", opened.Value, err)
+	}
+	resealed, _ := rotated.Seal(opened)
+	if id, _ := resealed.Header(EncryptionKeyIDHeader); string(id) != "kek-2" {
+		t.Errorf("Expected new messages to use kek-2, got %s", id)
+	}
+	if _, err := old.Open(resealed); !isPermanent(err) {
+		t.Errorf("Expected unknown key to be a permanent error, got %v", err)
+	}
+}
+
+func TestKeyRing_Ed25519(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	producer := NewKeyRing()
+	producer.AddEd25519Key("ed-1", private)
+	consumer := NewKeyRing()
+	consumer.AddEd25519PublicKey("ed-1", public)
+
+	sealed, err := producer.Seal(Message{Value: []byte("signed")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if opened, err := consumer.Open(sealed); err != nil || string(opened.Value) != "signed" {
+		t.Errorf("Expected the signature to be verified, got %s (%v)", opened.Value, err)
+	}
+	if _, err := consumer.Seal(Message{Value: []byte("x")}); err == nil {
+		t.Error("Expected a public key not to sign")
+	}
+}
+
+func TestEnvelopeWriterAndReader(t *testing.T) {
+	keys := testKeyRing(t, "kek-1", 7)
+	reader := &funcReader{}
+	var received Message
+	NewEnvelopeReader(reader, keys).Read(func(m Message) error {
+		received = m
+		return nil
+	})
+	writer := NewEnvelopeWriter(&funcWriter{write: reader.msgFunc}, keys)
+
+	if err := writer.WriteContext(context.Background(), Message{Value: []byte("secret")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(received.Value) != "secret" {
+		t.Errorf("Expected the opened value, got %s", received.Value)
+	}
+}
+
+func TestNewKeyRingFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, content []byte) string {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, content, 0600)
+		return path
+	}
+	kek2 := write("kek-2.key", []byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, 32))+"\n"))
+	kek1 := write("kek-1.key", []byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))))
+	_, private, _ := ed25519.GenerateKey(nil)
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+	ed := write("ed-1.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	os.Setenv("KAFKA_ENCRYPTION_KEY_FILES", kek2+","+kek1)
+	os.Setenv("KAFKA_SIGNING_KEY_FILES", ed)
+	service.Config().ParseEnvironment(true)
+	defer func() {
+		os.Unsetenv("KAFKA_ENCRYPTION_KEY_FILES")
+		os.Unsetenv("KAFKA_SIGNING_KEY_FILES")
+		service.Config().ParseEnvironment(true)
+	}()
+
+	keys, err := NewKeyRingFromConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sealed, _ := keys.Seal(Message{Value: []byte("secret")})
+	if id, _ := sealed.Header(EncryptionKeyIDHeader); string(id) != "kek-2" {
+		t.Errorf("Expected the first key kek-2 to be active, got %s", id)
+	}
+	if alg, _ := sealed.Header(SignatureAlgorithmHeader); string(alg) != SignatureEd25519 {
+		t.Errorf("Expected an Ed25519 signature, got %s", alg)
+	}
+	if _, _, ok := keys.encryptionKey("kek-1"); !ok {
+		t.Error("Expected kek-1 to be loaded for rotation")
+	}
+}
+
+func TestNewKeyRingFromConfig_NoKeys(t *testing.T) {
+	if _, err := NewKeyRingFromConfig(); err == nil {
+		t.Error("Expected an error without configured keys")
+	}
+}
+
+func TestKafkaReader_FailedEnvelopeKeepsHeadersInDLQ(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	sealed, err := testKeyRing(t, "kek-1", 7).Seal(Message{Topic: "customers", Key: []byte("customer-1"), Value: []byte("secret")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	brokerReaderMock := NewMockBrokerReader(mockCtrl)
+	gomock.InOrder(
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).Return(sealed, nil),
+		brokerReaderMock.EXPECT().CommitMessages(gomock.Any(), sealed).Return(nil),
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).Return(Message{}, errors.New("closed")),
+	)
+	dead := make(chan Message, 1)
+	dlqWriterMock := NewMockWriter(mockCtrl)
+	dlqWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).Do(func(_ context.Context, msgs ...Message) { dead <- msgs[0] }).Return(nil)
+	reader := KafkaReader{brokerReader: brokerReaderMock, maxRetries: 1, dlqWriter: dlqWriterMock}
+
+	// the message is encrypted with a key the reader does not know
+	reader.Read(OpenEnvelope(testKeyRing(t, "kek-2", 8), func(m Message) error { return nil }))
+
+	select {
+	case m := <-dead:
+		if !bytes.Equal(m.Value, sealed.Value) {
+			t.Error("Expected the sealed value in the dead letter queue")
+		}
+		for _, header := range envelopeHeaders {
+			expected, _ := sealed.Header(header)
+			if value, ok := m.Header(header); !ok || !bytes.Equal(value, expected) {
+				t.Errorf("Expected the %s header in the dead letter queue", header)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the message to be sent to the dead letter queue")
+	}
+	time.Sleep(time.Millisecond * 10)
+}
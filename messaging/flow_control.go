@@ -0,0 +1,140 @@
+package messaging
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/microdevs/missy/log"
+	"github.com/microdevs/missy/service"
+)
+
+// flowControl holds the pause state and rate limit of a KafkaReader
+type flowControl struct {
+	manual   bool
+	checkErr error
+	// resumed is closed when a paused reader continues
+	resumed chan struct{}
+	limiter *tokenBucket
+}
+
+func (fc *flowControl) paused() bool {
+	return fc.manual || fc.checkErr != nil
+}
+
+// Pause stops dispatching messages until Resume is called, the reader stays member of its consumer group
+func (mr *KafkaReader) Pause() {
+	mr.updateFlow(func(fc *flowControl) {
+		fc.manual = true
+	})
+}
+
+// Resume continues dispatching messages after Pause, a reader paused by a failing check stays paused until the check succeeds
+func (mr *KafkaReader) Resume() {
+	mr.updateFlow(func(fc *flowControl) {
+		fc.manual = false
+	})
+}
+
+// Paused tells if the reader is paused manually or by a failing check
+func (mr *KafkaReader) Paused() bool {
+	mr.flowMu.Lock()
+	defer mr.flowMu.Unlock()
+	return mr.flow.paused()
+}
+
+// SetRateLimit limits the number of messages dispatched per second, burst messages may be dispatched at once.
+// A rate of 0 removes the limit.
+func (mr *KafkaReader) SetRateLimit(messagesPerSecond float64, burst int) {
+	mr.updateFlow(func(fc *flowControl) {
+		fc.limiter = nil
+		if messagesPerSecond > 0 {
+			fc.limiter = newTokenBucket(messagesPerSecond, burst)
+		}
+	})
+	readerRateLimit.WithLabelValues(mr.topic).Set(messagesPerSecond)
+}
+
+// PauseWhen runs the check every interval and pauses the reader while the check fails, e.g. with a health check
+// registered with the service:
+//
+//	reader.PauseWhen(s.HealthCheck("payments-api"), 10*time.Second)
+func (mr *KafkaReader) PauseWhen(check service.Check, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := check()
+			mr.updateFlow(func(fc *flowControl) {
+				if err != nil && fc.checkErr == nil {
+					log.Warnf("# messaging # pausing reader for %s, check failed: %v", mr.topic, err)
+				}
+				if err == nil && fc.checkErr != nil {
+					log.Infof("# messaging # check for reader of %s succeeded again", mr.topic)
+				}
+				fc.checkErr = err
+			})
+
+			select {
+			case <-ticker.C:
+			case <-mr.done:
+				return
+			}
+		}
+	}()
+}
+
+// Status returns the state of the reader for the readiness report, register it with service.RegisterStatus
+func (mr *KafkaReader) Status() string {
+	mr.flowMu.Lock()
+	defer mr.flowMu.Unlock()
+
+	status := "consuming"
+	switch {
+	case mr.flow.checkErr != nil:
+		status = fmt.Sprintf("paused, check failed: %v", mr.flow.checkErr)
+	case mr.flow.manual:
+		status = "paused"
+	}
+	if mr.flow.limiter != nil {
+		status += fmt.Sprintf(", limited to %v messages/s", mr.flow.limiter.rate)
+	}
+	return status
+}
+
+// updateFlow changes the flow control of the reader and wakes up waiting consumers when the reader continues
+func (mr *KafkaReader) updateFlow(update func(fc *flowControl)) {
+	mr.flowMu.Lock()
+	defer mr.flowMu.Unlock()
+
+	wasPaused := mr.flow.paused()
+	update(&mr.flow)
+	isPaused := mr.flow.paused()
+
+	switch {
+	case !wasPaused && isPaused:
+		mr.flow.resumed = make(chan struct{})
+		readerPaused.WithLabelValues(mr.topic).Set(1)
+	case wasPaused && !isPaused:
+		close(mr.flow.resumed)
+		readerPaused.WithLabelValues(mr.topic).Set(0)
+	}
+}
+
+// waitForDispatch blocks while the reader is paused and until the rate limit allows the next message, it returns
+// false if the reader was closed meanwhile
+func (mr *KafkaReader) waitForDispatch() bool {
+	for {
+		mr.flowMu.Lock()
+		paused, resumed, limiter := mr.flow.paused(), mr.flow.resumed, mr.flow.limiter
+		mr.flowMu.Unlock()
+
+		if !paused {
+			return limiter == nil || limiter.wait(mr.done)
+		}
+		select {
+		case <-resumed:
+		case <-mr.done:
+			return false
+		}
+	}
+}
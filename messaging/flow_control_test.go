@@ -0,0 +1,118 @@
+package messaging
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKafkaReader_PauseResume(t *testing.T) {
+	reader := &KafkaReader{topic: "test", done: make(chan struct{})}
+
+	reader.Pause()
+	if !reader.Paused() {
+		t.Error("reader should be paused")
+	}
+
+	dispatched := make(chan bool)
+	go func() {
+		dispatched <- reader.waitForDispatch()
+	}()
+
+	select {
+	case <-dispatched:
+		t.Fatal("paused reader should not dispatch messages")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	reader.Resume()
+	select {
+	case ok := <-dispatched:
+		if !ok {
+			t.Error("resumed reader should dispatch messages")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("resumed reader did not dispatch messages")
+	}
+
+	if reader.Status() != "consuming" {
+		t.Error(expected(reader.Status(), "consuming"))
+	}
+}
+
+func TestKafkaReader_WaitForDispatchClosed(t *testing.T) {
+	reader := &KafkaReader{topic: "test", done: make(chan struct{})}
+	reader.Pause()
+	close(reader.done)
+
+	if reader.waitForDispatch() {
+		t.Error("closed reader should not dispatch messages")
+	}
+}
+
+func TestKafkaReader_PauseWhen(t *testing.T) {
+	reader := &KafkaReader{topic: "test", done: make(chan struct{})}
+	defer close(reader.done)
+
+	checkErr := make(chan error, 1)
+	checkErr <- errors.New("payments api unavailable")
+	reader.PauseWhen(func() error {
+		select {
+		case err := <-checkErr:
+			return err
+		default:
+			return nil
+		}
+	}, 10*time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for !reader.Paused() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if status := reader.Status(); !strings.Contains(status, "payments api unavailable") {
+		t.Errorf("status should contain the check error, got %s", status)
+	}
+
+	for reader.Paused() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if reader.Paused() {
+		t.Error("reader should continue when the check succeeds")
+	}
+}
+
+func TestKafkaReader_SetRateLimit(t *testing.T) {
+	reader := &KafkaReader{topic: "test", done: make(chan struct{})}
+	reader.SetRateLimit(100, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		reader.waitForDispatch()
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("3 messages with a rate of 100/s and burst 1 should take 20ms, took %s", elapsed)
+	}
+	if status := reader.Status(); status != "consuming, limited to 100 messages/s" {
+		t.Error(expected(status, "consuming, limited to 100 messages/s"))
+	}
+
+	reader.SetRateLimit(0, 0)
+	if reader.flow.limiter != nil {
+		t.Error("rate limit should be removed")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb := newTokenBucket(10, 2)
+
+	if d := tb.reserve(); d != 0 {
+		t.Errorf("first token should be available, wait %s", d)
+	}
+	if d := tb.reserve(); d != 0 {
+		t.Errorf("burst token should be available, wait %s", d)
+	}
+	if d := tb.reserve(); d <= 50*time.Millisecond || d > 100*time.Millisecond {
+		t.Errorf("third token should be available in 100ms, wait %s", d)
+	}
+}
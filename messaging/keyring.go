@@ -0,0 +1,271 @@
+package messaging
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/microdevs/missy/service"
+)
+
+// signature algorithms recorded in the SignatureAlgorithmHeader
+const (
+	SignatureHMACSHA256 = "HMAC-SHA256"
+	SignatureEd25519    = "Ed25519"
+)
+
+// signingKey signs and verifies envelopes, keys without private part can only verify
+type signingKey interface {
+	algorithm() string
+	sign(data []byte) ([]byte, error)
+	verify(data []byte, signature []byte) bool
+}
+
+type hmacKey []byte
+
+func (k hmacKey) algorithm() string {
+	return SignatureHMACSHA256
+}
+
+func (k hmacKey) sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (k hmacKey) verify(data []byte, signature []byte) bool {
+	expected, _ := k.sign(data)
+	return hmac.Equal(expected, signature)
+}
+
+type ed25519Key struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func (k ed25519Key) algorithm() string {
+	return SignatureEd25519
+}
+
+func (k ed25519Key) sign(data []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, fmt.Errorf("ed25519 key has no private key, it can only verify signatures")
+	}
+	return ed25519.Sign(k.private, data), nil
+}
+
+func (k ed25519Key) verify(data []byte, signature []byte) bool {
+	return ed25519.Verify(k.public, data, signature)
+}
+
+// KeyRing holds the keys used to seal and open message envelopes by key ID. The first key added of each kind is the
+// active key used for new messages, the other keys are kept to open messages sealed before a key rotation.
+type KeyRing struct {
+	encryptionKeys      map[string][]byte
+	activeEncryptionKey string
+	signingKeys         map[string]signingKey
+	activeSigningKey    string
+	mu                  sync.RWMutex
+}
+
+// NewKeyRing returns an empty key ring
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		encryptionKeys: make(map[string][]byte),
+		signingKeys:    make(map[string]signingKey),
+	}
+}
+
+// AddEncryptionKey adds an AES key-encryption key of 16, 24 or 32 bytes which wraps the data keys of messages
+func (k *KeyRing) AddEncryptionKey(id string, key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return fmt.Errorf("encryption key %s has %d bytes, AES needs 16, 24 or 32 bytes", id, len(key))
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.encryptionKeys[id] = append([]byte(nil), key...)
+	if k.activeEncryptionKey == "" {
+		k.activeEncryptionKey = id
+	}
+	return nil
+}
+
+// AddHMACKey adds a secret which signs messages with HMAC-SHA256
+func (k *KeyRing) AddHMACKey(id string, secret []byte) error {
+	if len(secret) < 32 {
+		return fmt.Errorf("hmac key %s has %d bytes, it needs at least 32 bytes", id, len(secret))
+	}
+	return k.addSigningKey(id, hmacKey(append([]byte(nil), secret...)))
+}
+
+// AddEd25519Key adds a private key which signs messages with Ed25519
+func (k *KeyRing) AddEd25519Key(id string, key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return fmt.Errorf("ed25519 key %s has an invalid size", id)
+	}
+	return k.addSigningKey(id, ed25519Key{private: key, public: key.Public().(ed25519.PublicKey)})
+}
+
+// AddEd25519PublicKey adds a public key which verifies Ed25519 signatures, e.g. for consumers which must not sign
+func (k *KeyRing) AddEd25519PublicKey(id string, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("ed25519 public key %s has an invalid size", id)
+	}
+	return k.addSigningKey(id, ed25519Key{public: key})
+}
+
+func (k *KeyRing) addSigningKey(id string, key signingKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.signingKeys[id] = key
+	if k.activeSigningKey == "" {
+		k.activeSigningKey = id
+	}
+	return nil
+}
+
+// encryptionKey returns the key-encryption key with the given id, the active key for an empty id
+func (k *KeyRing) encryptionKey(id string) (string, []byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if id == "" {
+		id = k.activeEncryptionKey
+	}
+	key, ok := k.encryptionKeys[id]
+	return id, key, ok
+}
+
+// signingKey returns the signing key with the given id, the active key for an empty id
+func (k *KeyRing) signingKey(id string) (string, signingKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if id == "" {
+		id = k.activeSigningKey
+	}
+	key, ok := k.signingKeys[id]
+	return id, key, ok
+}
+
+// encrypts checks if the key ring has an encryption key
+func (k *KeyRing) encrypts() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.encryptionKeys) > 0
+}
+
+// signs checks if the key ring has a signing key
+func (k *KeyRing) signs() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.signingKeys) > 0
+}
+
+// NewKeyRingFromConfig loads the keys from the files listed in KAFKA_ENCRYPTION_KEY_FILES and
+// KAFKA_SIGNING_KEY_FILES, the first file of each list holds the active key. The ID of a key is the name of its file
+// without extension, so a key is rotated by adding a new file at the beginning of the list and keeping the old one
+// until all messages sealed with it were consumed.
+//
+// Encryption key files hold a base64 encoded AES key. Signing key files hold a base64 encoded HMAC secret, a PEM
+// encoded Ed25519 private key (PKCS #8) or a PEM encoded Ed25519 public key which can only verify signatures.
+func NewKeyRingFromConfig() (*KeyRing, error) {
+	keys := NewKeyRing()
+	for _, path := range configuredFiles(kafkaEncryptionKeyFiles) {
+		key, err := readBase64File(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := keys.AddEncryptionKey(keyID(path), key); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range configuredFiles(kafkaSigningKeyFiles) {
+		if err := addSigningKeyFile(keys, path); err != nil {
+			return nil, err
+		}
+	}
+	if !keys.encrypts() && !keys.signs() {
+		return nil, fmt.Errorf("no keys configured, set KAFKA_ENCRYPTION_KEY_FILES or KAFKA_SIGNING_KEY_FILES")
+	}
+	return keys, nil
+}
+
+// addSigningKeyFile adds the HMAC secret or Ed25519 key in the file to the key ring
+func addSigningKeyFile(keys *KeyRing, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read signing key: %v", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+		if err != nil {
+			return fmt.Errorf("signing key %s is neither PEM nor base64 encoded: %v", path, err)
+		}
+		return keys.AddHMACKey(keyID(path), secret)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("cannot parse signing key %s: %v", path, err)
+		}
+		private, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return fmt.Errorf("signing key %s is a %T, only ed25519 keys are supported", path, key)
+		}
+		return keys.AddEd25519Key(keyID(path), private)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("cannot parse signing key %s: %v", path, err)
+		}
+		public, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("signing key %s is a %T, only ed25519 keys are supported", path, key)
+		}
+		return keys.AddEd25519PublicKey(keyID(path), public)
+	default:
+		return fmt.Errorf("signing key %s has unsupported PEM type %s", path, block.Type)
+	}
+}
+
+// readBase64File reads a base64 encoded key
+func readBase64File(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read encryption key: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key %s is not base64 encoded: %v", path, err)
+	}
+	return key, nil
+}
+
+// keyID returns the file name of a key without extension
+func keyID(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// configuredFiles returns the comma separated file paths of a config parameter
+func configuredFiles(name string) []string {
+	var paths []string
+	for _, p := range strings.Split(service.Config().Get(name), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
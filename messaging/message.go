@@ -7,6 +7,8 @@ import (
 	"encoding/hex"
 	"hash"
 	"time"
+
+	"github.com/segmentio/kafka-go"
 )
 
 // Message is a Kafka message
@@ -14,11 +16,61 @@ type Message struct {
 	Topic     string
 	Key       []byte
 	Value     []byte
+	Headers   []Header
 	Time      time.Time
 	Partition int
 	Offset    int64
 }
 
+// Header is a key/value pair attached to a Message
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Header returns the value of the first header with the given key and whether it was found
+func (m Message) Header(key string) ([]byte, bool) {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetHeader sets the value of the header with the given key, replacing an existing value
+func (m *Message) SetHeader(key string, value []byte) {
+	for i, h := range m.Headers {
+		if h.Key == key {
+			m.Headers[i].Value = value
+			return
+		}
+	}
+	m.Headers = append(m.Headers, Header{Key: key, Value: value})
+}
+
+func toKafkaHeaders(headers []Header) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	kafkaHeaders := make([]kafka.Header, len(headers))
+	for i, h := range headers {
+		kafkaHeaders[i] = kafka.Header{Key: h.Key, Value: h.Value}
+	}
+	return kafkaHeaders
+}
+
+func fromKafkaHeaders(kafkaHeaders []kafka.Header) []Header {
+	if len(kafkaHeaders) == 0 {
+		return nil
+	}
+	headers := make([]Header, len(kafkaHeaders))
+	for i, h := range kafkaHeaders {
+		headers[i] = Header{Key: h.Key, Value: h.Value}
+	}
+	return headers
+}
+
 // Hash returns bytes array of a hash of a Message using provided hash mechanism
 func (m Message) Hash(hash hash.Hash) ([]byte, error) {
 	var binBuffer bytes.Buffer
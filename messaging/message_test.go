@@ -92,3 +92,22 @@ func TestMessage_Sha256(t *testing.T) {
 		t.Error("hash bytes len is 0!")
 	}
 }
+
+func TestMessage_Header(t *testing.T) {
+	message := Message{}
+
+	if _, ok := message.Header("content-type"); ok {
+		t.Error("header should not be found in empty message")
+	}
+
+	message.SetHeader("content-type", []byte("application/json"))
+	message.SetHeader("content-type", []byte("application/avro"))
+
+	if len(message.Headers) != 1 {
+		t.Errorf("header should be replaced, got %v headers", len(message.Headers))
+	}
+
+	if value, ok := message.Header("content-type"); !ok || string(value) != "application/avro" {
+		t.Errorf("invalid header value: %s", value)
+	}
+}
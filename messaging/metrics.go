@@ -0,0 +1,30 @@
+package messaging
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	readerPaused = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "missy_kafka_reader_paused",
+		Help: "Whether a kafka reader is paused (1) or consuming (0) by topic",
+	},
+		[]string{"topic"},
+	)
+	readerRateLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "missy_kafka_reader_rate_limit",
+		Help: "The maximum number of messages per second a kafka reader dispatches by topic, 0 is unlimited",
+	},
+		[]string{"topic"},
+	)
+	messageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "missy_kafka_message_duration_seconds",
+		Help: "The time a message handler took by topic and result",
+	},
+		[]string{"topic", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(readerPaused, readerRateLimit, messageDuration)
+}
@@ -0,0 +1,107 @@
+package messaging
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/microdevs/missy/log"
+)
+
+// PanicError is returned by Recover when a ReadMessageFunc panicked, KafkaReader sends such messages to the DLQ
+// without retries. Panics recovered by RecoverTransient are retried like other errors.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+	// Transient marks a panic which may not happen again when the message is processed again
+	Transient bool
+}
+
+// Error returns the panic value
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("message handler panicked: %v", e.Value)
+}
+
+// Permanent marks panics as permanent unless they are transient, processing the message again would usually panic
+// again
+func (e *PanicError) Permanent() bool {
+	return !e.Transient
+}
+
+// Recover turns a panic of the next ReadMessageFunc into a permanent *PanicError, so the message is sent to the DLQ
+// without retries. KafkaReader recovers from panics of the ReadMessageFunc passed to Read on its own, use Recover to
+// recover closer to a handler, e.g. for a single route.
+func Recover(next ReadMessageFunc) ReadMessageFunc {
+	return recoverPanic(next, false)
+}
+
+// RecoverTransient turns a panic of the next ReadMessageFunc into a transient *PanicError, so the message is processed
+// again like for other errors. Use it for handlers whose panics depend on state outside of the message.
+func RecoverTransient(next ReadMessageFunc) ReadMessageFunc {
+	return recoverPanic(next, true)
+}
+
+// recoverPanic logs a panic of the next ReadMessageFunc and returns it as *PanicError
+func recoverPanic(next ReadMessageFunc, transient bool) ReadMessageFunc {
+	return func(m Message) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				stack := make([]byte, 1024*8)
+				stack = stack[:runtime.Stack(stack, false)]
+				log.WithFields(messageFields(m)).Errorf("PANIC: %v\n%s", r, stack)
+				err = &PanicError{Value: r, Stack: stack, Transient: transient}
+			}
+		}()
+		return next(m)
+	}
+}
+
+// Metrics records the duration and result of the next ReadMessageFunc in missy_kafka_message_duration_seconds
+func Metrics(next ReadMessageFunc) ReadMessageFunc {
+	return func(m Message) error {
+		start := time.Now()
+		err := next(m)
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		messageDuration.WithLabelValues(m.Topic, result).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Logging logs every message with its topic, partition, offset and sizes and the duration of the next
+// ReadMessageFunc at debug level, failures are logged at warn level. Keys and values are not logged, as they may
+// contain personal data.
+func Logging(next ReadMessageFunc) ReadMessageFunc {
+	return func(m Message) error {
+		start := time.Now()
+		err := next(m)
+
+		fields := messageFields(m)
+		fields["duration"] = time.Since(start).String()
+		if err != nil {
+			fields["error"] = err.Error()
+			log.WithFields(fields).Warn("# messaging # processing message failed")
+			return err
+		}
+		log.WithFields(fields).Debug("# messaging # message processed")
+		return nil
+	}
+}
+
+// messageFields returns the log fields identifying a message
+func messageFields(m Message) log.Fields {
+	fields := log.Fields{
+		"topic":      m.Topic,
+		"partition":  m.Partition,
+		"offset":     m.Offset,
+		"key_size":   len(m.Key),
+		"value_size": len(m.Value),
+	}
+	if tc, ok := TraceFrom(m); ok {
+		fields["trace_id"] = tc.TraceID
+		fields["span_id"] = tc.SpanID
+	}
+	return fields
+}
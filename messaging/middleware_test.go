@@ -0,0 +1,180 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	middleware := func(name string) Constructor {
+		return func(next ReadMessageFunc) ReadMessageFunc {
+			return func(m Message) error {
+				calls = append(calls, name)
+				return next(m)
+			}
+		}
+	}
+	fn := func(m Message) error {
+		calls = append(calls, "handler")
+		return nil
+	}
+
+	base := NewChain(middleware("m1"), middleware("m2"))
+	extended := base.Extend(*NewChain(middleware("m3"))).Append(middleware("m4"))
+
+	base.Then(fn)(Message{})
+	if !reflect.DeepEqual(calls, []string{"m1", "m2", "handler"}) {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+	calls = nil
+	extended.Then(fn)(Message{})
+	if !reflect.DeepEqual(calls, []string{"m1", "m2", "m3", "m4", "handler"}) {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	err := Recover(func(m Message) error {
+		panic("nil map")
+	})(Message{Topic: "orders"})
+
+	panicErr, ok := err.(*PanicError)
+	if !ok || panicErr.Value != "nil map" || len(panicErr.Stack) == 0 {
+		t.Fatalf("Expected a *PanicError with the panic value, got %v", err)
+	}
+	if !isPermanent(err) {
+		t.Error("Expected a panic to be a permanent error")
+	}
+}
+
+func TestRecoverTransient(t *testing.T) {
+	err := RecoverTransient(func(m Message) error {
+		panic("connection pool closed")
+	})(Message{Topic: "orders"})
+
+	if _, ok := err.(*PanicError); !ok || isPermanent(err) {
+		t.Errorf("Expected a transient *PanicError, got %v", err)
+	}
+}
+
+func TestKafkaReader_PanicIsSentToDLQ(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	brokerReaderMock := NewMockBrokerReader(mockCtrl)
+	msg := Message{Topic: "orders", Key: []byte("key"), Value: []byte("value")}
+	gomock.InOrder(
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).Return(msg, nil),
+		brokerReaderMock.EXPECT().CommitMessages(gomock.Any(), msg).Return(nil),
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).Return(Message{}, errors.New("closed")),
+	)
+	written := make(chan struct{})
+	dlqWriterMock := NewMockWriter(mockCtrl)
+	dlqWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).Do(func(_ context.Context, msgs ...Message) { close(written) }).Return(nil)
+	reader := KafkaReader{brokerReader: brokerReaderMock, maxRetries: 3, dlqWriter: dlqWriterMock}
+
+	calls := 0
+	reader.Read(func(m Message) error {
+		calls++
+		panic("boom")
+	})
+
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the message to be sent to the dead letter queue")
+	}
+	time.Sleep(time.Millisecond * 10)
+	if calls != 1 {
+		t.Errorf("Expected a panic not to be retried, called %d times", calls)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	fn := Metrics(func(m Message) error {
+		return errors.New("failed")
+	})
+	before := countMetrics(messageDuration)
+	fn(Message{Topic: "metrics-test"})
+	if after := countMetrics(messageDuration); after != before+1 {
+		t.Errorf("Expected a new series for the topic, got %d series instead of %d", after, before+1)
+	}
+}
+
+// countMetrics returns the number of series of a collector
+func countMetrics(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric, 100)
+	c.Collect(ch)
+	close(ch)
+	return len(ch)
+}
+
+func TestLogging(t *testing.T) {
+	err := Logging(func(m Message) error {
+		return errors.New("failed")
+	})(Message{})
+	if err == nil || err.Error() != "failed" {
+		t.Errorf("Expected the error to be returned, got %v", err)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+	if tc != expected {
+		t.Errorf("Expected %+v, got %+v", expected, tc)
+	}
+	if tc.String() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Unexpected traceparent %s", tc)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceParent(invalid); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	parent := TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+	msg := Message{}
+	parent.Inject(&msg)
+
+	var span TraceContext
+	Tracing(func(m Message) error {
+		span, _ = TraceFrom(m)
+		return nil
+	})(msg)
+
+	if span.TraceID != parent.TraceID || span.SpanID == parent.SpanID || !span.Sampled {
+		t.Errorf("Expected a child span of %+v, got %+v", parent, span)
+	}
+	if header, _ := msg.Header(TraceParentHeader); !strings.Contains(string(header), parent.SpanID) {
+		t.Error("Expected the original message to be unchanged")
+	}
+
+	Tracing(func(m Message) error {
+		span, _ = TraceFrom(m)
+		return nil
+	})(Message{})
+	if len(span.TraceID) != 32 || span.TraceID == parent.TraceID {
+		t.Errorf("Expected a new trace for a message without traceparent, got %+v", span)
+	}
+}
@@ -0,0 +1,187 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/microdevs/missy/log"
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrSeekNotAvailable is returned when seeking a reader which is member of a consumer group, the offsets of a group
+// can be changed with ResetOffsets while all of its readers are stopped
+var ErrSeekNotAvailable = errors.New("seeking is only available for partition readers, use ResetOffsets for consumer groups")
+
+// offsetSeeker is implemented by broker readers which can change the offset of the next message
+type offsetSeeker interface {
+	SetOffset(offset int64) error
+	SetOffsetAt(ctx context.Context, t time.Time) error
+}
+
+// NewPartitionReader returns a reader for a single partition of a topic which is not member of a consumer group.
+// It starts at the first offset of the partition and does not commit messages, use the Seek methods to replay
+// messages from a different offset. You need to close it after use. (Close())
+func NewPartitionReader(brokers []string, topic string, partition int) *KafkaReader {
+	kafkaReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     topic,
+		Partition: partition,
+		MinBytes:  10e3, // 10KB do we want it from config?
+		MaxBytes:  10e6, // 10MB do we want it from config?
+	})
+
+	retries, intervalTime := fetchRetriesAndInterval()
+
+	return &KafkaReader{brokers: brokers,
+		topic:           topic,
+		partition:       partition,
+		partitionReader: true,
+		brokerReader:    &readBroker{kafkaReader, retries, intervalTime},
+		maxRetries:      retries,
+		retriesInterval: intervalTime,
+		done:            make(chan struct{}),
+	}
+}
+
+// SeekToOffset continues reading the partition at the given offset
+func (mr *KafkaReader) SeekToOffset(offset int64) error {
+	seeker, err := mr.seeker()
+	if err != nil {
+		return err
+	}
+	return seeker.SetOffset(offset)
+}
+
+// SeekToTime continues reading the partition at the first message written at or after t
+func (mr *KafkaReader) SeekToTime(ctx context.Context, t time.Time) error {
+	seeker, err := mr.seeker()
+	if err != nil {
+		return err
+	}
+	return seeker.SetOffsetAt(ctx, t)
+}
+
+// SeekToBeginning continues reading the partition at the oldest available message
+func (mr *KafkaReader) SeekToBeginning() error {
+	return mr.SeekToOffset(kafka.FirstOffset)
+}
+
+// SeekToEnd continues reading the partition with the next message written to it
+func (mr *KafkaReader) SeekToEnd() error {
+	return mr.SeekToOffset(kafka.LastOffset)
+}
+
+// seeker returns the broker reader of a partition reader which is able to change its offset
+func (mr *KafkaReader) seeker() (offsetSeeker, error) {
+	if !mr.partitionReader {
+		return nil, ErrSeekNotAvailable
+	}
+	seeker, ok := mr.brokerReader.(offsetSeeker)
+	if !ok {
+		return nil, ErrSeekNotAvailable
+	}
+	return seeker, nil
+}
+
+// ResetOffsets sets the committed offsets of a consumer group for all partitions of the topic to the first message
+// written at or after t, partitions without such message are set to their end. ResetOffsets joins the consumer group
+// to commit the offsets, so all other members of the group have to be stopped. It returns the committed offsets by
+// partition.
+func ResetOffsets(ctx context.Context, brokers []string, groupID string, topic string, t time.Time) (map[int]int64, error) {
+	partitions, err := readPartitions(ctx, brokers, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[int]int64, len(partitions))
+	for _, p := range partitions {
+		offset, err := offsetAt(ctx, brokers, topic, p.ID, t)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read offset of partition %d of %s: %v", p.ID, topic, err)
+		}
+		offsets[p.ID] = offset
+	}
+
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:      groupID,
+		Brokers: brokers,
+		Topics:  []string{topic},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer group.Close()
+
+	generation, err := group.Next(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot join consumer group %s: %v", groupID, err)
+	}
+	if err := checkAssignments(groupID, generation.Assignments[topic], partitions); err != nil {
+		return nil, err
+	}
+
+	if err := generation.CommitOffsets(map[string]map[int]int64{topic: offsets}); err != nil {
+		return nil, fmt.Errorf("cannot commit offsets of consumer group %s: %v", groupID, err)
+	}
+	log.Infof("# messaging # reset offsets of consumer group %s for %s to %s: %v", groupID, topic, t, offsets)
+	return offsets, nil
+}
+
+// checkAssignments makes sure all partitions were assigned, which is only the case if there are no other members in the group
+func checkAssignments(groupID string, assignments []kafka.PartitionAssignment, partitions []kafka.Partition) error {
+	assigned := make(map[int]bool, len(assignments))
+	for _, a := range assignments {
+		assigned[a.ID] = true
+	}
+	for _, p := range partitions {
+		if !assigned[p.ID] {
+			return fmt.Errorf("consumer group %s has active members, stop all readers of the group before resetting its offsets", groupID)
+		}
+	}
+	return nil
+}
+
+// readPartitions returns the partitions of a topic from the first broker available
+func readPartitions(ctx context.Context, brokers []string, topic string) ([]kafka.Partition, error) {
+	var err error
+	for _, broker := range brokers {
+		var conn *kafka.Conn
+		conn, err = kafka.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			continue
+		}
+		var partitions []kafka.Partition
+		partitions, err = conn.ReadPartitions(topic)
+		conn.Close()
+		if err == nil {
+			return partitions, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot read partitions of %s: %v", topic, err)
+}
+
+// offsetAt returns the offset of the first message of the partition written at or after t or the end of the partition
+func offsetAt(ctx context.Context, brokers []string, topic string, partition int, t time.Time) (int64, error) {
+	var err error
+	for _, broker := range brokers {
+		var conn *kafka.Conn
+		conn, err = kafka.DefaultDialer.DialLeader(ctx, "tcp", broker, topic, partition)
+		if err != nil {
+			continue
+		}
+		defer conn.Close()
+
+		offset, err := conn.ReadOffset(t)
+		if err != nil {
+			return 0, err
+		}
+		if offset < 0 {
+			// no message was written after t
+			return conn.ReadLastOffset()
+		}
+		return offset, nil
+	}
+	return 0, err
+}
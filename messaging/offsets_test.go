@@ -0,0 +1,68 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestNewPartitionReader(t *testing.T) {
+	monkeyPatchConfig()
+
+	r := NewPartitionReader([]string{"localhost:9091"}, "test", 2)
+	defer r.Close()
+
+	kr := r.brokerReader.(*readBroker).Reader
+	if kr.Config().Partition != 2 || kr.Config().GroupID != "" {
+		t.Errorf("expecting a reader for partition 2 without group, got partition %d and group %s", kr.Config().Partition, kr.Config().GroupID)
+	}
+
+	if err := r.SeekToOffset(42); err != nil {
+		t.Errorf("unexpected error seeking partition reader: %v", err)
+	}
+	if kr.Offset() != 42 {
+		t.Errorf("expecting offset to be 42, got %d", kr.Offset())
+	}
+
+	if err := r.SeekToBeginning(); err != nil || kr.Offset() != kafka.FirstOffset {
+		t.Errorf("expecting offset to be the first offset, got %d, err %v", kr.Offset(), err)
+	}
+	if err := r.SeekToEnd(); err != nil || kr.Offset() != kafka.LastOffset {
+		t.Errorf("expecting offset to be the last offset, got %d, err %v", kr.Offset(), err)
+	}
+}
+
+func TestKafkaReader_SeekGroupReader(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	reader := KafkaReader{groupID: "group", brokerReader: NewMockBrokerReader(mockCtrl)}
+
+	if err := reader.SeekToOffset(1); err != ErrSeekNotAvailable {
+		t.Errorf("expecting ErrSeekNotAvailable, got %v", err)
+	}
+	if err := reader.SeekToTime(context.Background(), time.Now()); err != ErrSeekNotAvailable {
+		t.Errorf("expecting ErrSeekNotAvailable, got %v", err)
+	}
+}
+
+func TestKafkaReader_PartitionReaderDoesNotCommit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	// no commit is expected by the mock
+	reader := KafkaReader{partitionReader: true, brokerReader: NewMockBrokerReader(mockCtrl)}
+
+	reader.commit(context.Background(), reader.brokerReader, Message{})
+}
+
+func TestCheckAssignments(t *testing.T) {
+	partitions := []kafka.Partition{{ID: 0}, {ID: 1}}
+
+	if err := checkAssignments("group", []kafka.PartitionAssignment{{ID: 0}, {ID: 1}}, partitions); err != nil {
+		t.Errorf("unexpected error when all partitions are assigned: %v", err)
+	}
+	if err := checkAssignments("group", []kafka.PartitionAssignment{{ID: 1}}, partitions); err == nil {
+		t.Error("expecting an error when the group has other members")
+	}
+}
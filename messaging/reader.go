@@ -8,6 +8,7 @@ import (
 	"github.com/microdevs/missy/service"
 
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/microdevs/missy/log"
@@ -39,9 +40,20 @@ type KafkaReader struct {
 	topic           string
 	brokerReader    BrokerReader
 	readFunc        *ReadMessageFunc
+	partition       int
+	partitionReader bool
 	dlqWriter       Writer
 	maxRetries      int
 	retriesInterval time.Duration
+
+	// retryTiers are consumed by the same reader when messages are retried through retry topics
+	retryTiers  []retryTier
+	retryWriter Writer
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	flow   flowControl
+	flowMu sync.Mutex
 }
 
 // readBroker us as a wrapper for kafka.Reader implementation to fulfill BrokerReader interface
@@ -72,7 +84,7 @@ func (rm *readBroker) FetchMessage(ctx context.Context) (Message, error) {
 		return Message{}, err
 	}
 
-	return Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Time: m.Time, Partition: m.Partition, Offset: m.Offset}, nil
+	return Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Headers: fromKafkaHeaders(m.Headers), Time: m.Time, Partition: m.Partition, Offset: m.Offset}, nil
 }
 
 // ReadMessage used to read and auto commit messages from the broker (currently not used in missy)
@@ -83,7 +95,7 @@ func (rm *readBroker) ReadMessage(ctx context.Context) (Message, error) {
 		return Message{}, err
 	}
 
-	return Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Time: m.Time, Partition: m.Partition, Offset: m.Offset}, nil
+	return Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Headers: fromKafkaHeaders(m.Headers), Time: m.Time, Partition: m.Partition, Offset: m.Offset}, nil
 }
 
 // CommitMessages used to commit red messages for the broker
@@ -108,16 +120,6 @@ func (rm *readBroker) Close() error {
 // we are leaving using the missy config for now, because we don't know how we want to configure this yet.
 func NewReader(brokers []string, groupID string, topic string) *KafkaReader {
 
-	kafkaReader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        brokers,
-		GroupID:        groupID,
-		Topic:          topic,
-		CommitInterval: 0,    // 0 indicates that commits should be done synchronically
-		MinBytes:       10e3, // 10KB do we want it from config?
-		MaxBytes:       10e6, // 10MB do we want it from config?
-		RetentionTime:  retentionDuration(),
-	})
-
 	retries, intervalTime := fetchRetriesAndInterval()
 
 	log.Infof("Configured num of maxRetries: %v with interval %v", retries, intervalTime)
@@ -125,12 +127,27 @@ func NewReader(brokers []string, groupID string, topic string) *KafkaReader {
 	return &KafkaReader{brokers: brokers,
 		groupID:         groupID,
 		topic:           topic,
-		brokerReader:    &readBroker{kafkaReader, retries, intervalTime},
+		brokerReader:    newReadBroker(brokers, groupID, topic, retries, intervalTime),
 		maxRetries:      retries,
 		retriesInterval: intervalTime,
+		done:            make(chan struct{}),
 	}
 }
 
+// newReadBroker returns a broker reader for the topic which commits messages synchronously
+func newReadBroker(brokers []string, groupID string, topic string, retries int, intervalTime time.Duration) *readBroker {
+	kafkaReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:        brokers,
+		GroupID:        groupID,
+		Topic:          topic,
+		CommitInterval: 0,    // 0 indicates that commits should be done synchronically
+		MinBytes:       10e3, // 10KB do we want it from config?
+		MaxBytes:       10e6, // 10MB do we want it from config?
+		RetentionTime:  retentionDuration(),
+	})
+	return &readBroker{kafkaReader, retries, intervalTime}
+}
+
 // NewReaderWithDLQ a reader with DLQ
 func NewReaderWithDLQ(brokers []string, groupID string, topic string, dlqTopic string) *KafkaReader {
 	reader := NewReader(brokers, groupID, topic)
@@ -152,51 +169,79 @@ func (mr *KafkaReader) Read(msgFunc ReadMessageFunc) error {
 	// set current read func
 	mr.readFunc = &msgFunc
 
-	// start reading goroutine
-	go func() {
-		for {
-			ctx := context.Background()
+	// a panic of msgFunc must not crash the service, the message is sent to the DLQ instead
+	msgFunc = Recover(msgFunc)
 
-			m, err := mr.brokerReader.FetchMessage(ctx)
-			if err != nil {
-				log.Errorf("# failed to fetch a message: %v", err)
+	// start reading goroutines, retry topics are consumed next to the topic
+	go mr.consume(mr.brokerReader, msgFunc, false)
+	for _, tier := range mr.retryTiers {
+		go mr.consume(tier.reader, msgFunc, true)
+	}
+
+	return nil
+}
+
+// consume calls msgFunc for every message fetched from the broker reader until fetching fails
+func (mr *KafkaReader) consume(brokerReader BrokerReader, msgFunc ReadMessageFunc, retryTopic bool) {
+	for {
+		ctx := context.Background()
+
+		m, err := brokerReader.FetchMessage(ctx)
+		if err != nil {
+			log.Errorf("# failed to fetch a message: %v", err)
+			break
+		}
+
+		log.WithFields(messageFields(m)).Debug("# messaging # new message")
+		if (retryTopic && !mr.waitUntilDue(m)) || !mr.waitForDispatch() {
+			// the reader was closed, the message is fetched again by the next reader
+			break
+		}
+		if len(mr.retryTiers) > 0 {
+			if err := mr.processWithRetryTopics(ctx, msgFunc, m); err != nil {
+				// the reader was closed, the message is not committed and fetched again by the next reader
+				log.WithFields(messageFields(m)).Errorf("Cannot hand over failed message: %v", err)
 				break
 			}
+			mr.commit(ctx, brokerReader, m)
+			continue
+		}
 
-			log.Infof("# messaging # new message: [topic] %v; [part] %v; [offset] %v; %s = %s\n", m.Topic, m.Partition, m.Offset, string(m.Key), string(m.Value))
-			if err := mr.processMessage(msgFunc, m, 0); err != nil {
-				log.Errorf("# messaging # %v, sending message to dead letter queue", err)
-
-				if mr.dlqWriter != nil {
-					if err = mr.dlqWriter.Write(m.Key, m.Value); err != nil {
-						log.Errorf("Sending message to dead letter queue failed because: %v", err)
-					}
-				}
-				mr.commit(ctx, m)
-				continue
+		if err := mr.processMessage(msgFunc, m, 0); err != nil {
+			log.Errorf("# messaging # %v, sending message to dead letter queue", err)
+			if err := mr.sendToDLQ(ctx, m, err); err != nil {
+				log.Error(err)
 			}
-
-			// commit message if no error
-			mr.commit(ctx, m)
+			mr.commit(ctx, brokerReader, m)
+			continue
 		}
-	}()
 
-	return nil
+		// commit message if no error
+		mr.commit(ctx, brokerReader, m)
+	}
 }
-func (mr *KafkaReader) commit(ctx context.Context, m Message) {
-	if err := mr.brokerReader.CommitMessages(ctx, m); err != nil {
+
+func (mr *KafkaReader) commit(ctx context.Context, brokerReader BrokerReader, m Message) {
+	// partition readers are no member of a consumer group and have nothing to commit
+	if mr.partitionReader {
+		return
+	}
+	if err := brokerReader.CommitMessages(ctx, m); err != nil {
 		// should we do something else to just logging not committed message?
-		log.Errorf("Cannot commit message [%s] %v/%v: %s = %s; with error: %v", m.Topic, m.Partition, m.Offset, string(m.Key), string(m.Value), err)
+		log.WithFields(messageFields(m)).Errorf("Cannot commit message with error: %v", err)
 	}
 }
 
-//will try to process same message for configured number of times
+//will try to process same message for configured number of times, permanent errors are returned without retrying
 func (mr *KafkaReader) processMessage(msgFunc ReadMessageFunc, message Message, retryNumber int) error {
 
 	if retryNumber > mr.maxRetries {
 		return errors.New("reached maximum number of retries")
 	}
 	if err := msgFunc(message); err != nil {
+		if isPermanent(err) {
+			return err
+		}
 		log.Errorf("# messaging # retry number %v failed, trying again, err: %v", retryNumber, err)
 		time.Sleep(mr.retriesInterval)
 		return mr.processMessage(msgFunc, message, retryNumber+1)
@@ -206,6 +251,19 @@ func (mr *KafkaReader) processMessage(msgFunc ReadMessageFunc, message Message,
 
 // Close used to close underlying connection with broker
 func (mr *KafkaReader) Close() error {
+	mr.closeOnce.Do(func() {
+		if mr.done != nil {
+			close(mr.done)
+		}
+	})
+	for _, tier := range mr.retryTiers {
+		if err := tier.reader.Close(); err != nil {
+			log.Errorf("Cannot close reader for retry topic %s: %v", tier.topic, err)
+		}
+	}
+	if mr.retryWriter != nil {
+		mr.retryWriter.Close()
+	}
 	return mr.brokerReader.Close()
 }
 
@@ -148,7 +148,7 @@ func TestMissyReader_ReadErrorOnReadFuncShouldWriteToDLQAndCommitMsg(t *testing.
 	brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).AnyTimes().Return(*msg, nil)
 	brokerReaderMock.EXPECT().Close().Return(nil)
 	dlqWriterMock := NewMockWriter(mockCtrl)
-	dlqWriterMock.EXPECT().Write(key, value).MinTimes(1).Return(nil)
+	dlqWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).MinTimes(1).Return(nil)
 	brokerReaderMock.EXPECT().CommitMessages(gomock.Any(), gomock.Any()).AnyTimes()
 	reader := KafkaReader{brokerReader: brokerReaderMock, maxRetries: 1, dlqWriter: dlqWriterMock}
 
@@ -497,17 +497,42 @@ func TestReadBroker_FailingMessageShouldBeSendToDLQ(t *testing.T) {
 	value := []byte("value")
 	msg := &Message{Topic: "test", Key: key, Value: value, Partition: 0, Offset: 0}
 	brokerReaderMock.EXPECT().CommitMessages(gomock.Any(), *msg).AnyTimes().Return(nil)
-	brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).AnyTimes().Return(*msg, nil)
+	gomock.InOrder(
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).Return(*msg, nil),
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).Return(Message{}, errors.New("closed")),
+	)
 	reader := &KafkaReader{brokerReader: brokerReaderMock, dlqWriter: dlqWriterMock, retriesInterval: 1 * time.Second, maxRetries: 1}
 	readFunc := func(msg Message) error {
 		return errors.New("error")
 	}
 
 	//main check, we just want to know that dlqWriterMock was called
-	dlqWriterMock.EXPECT().Write(key, value).Return(nil)
+	dlqWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msgs ...Message) error {
+		if string(msgs[0].Key) != string(key) || string(msgs[0].Value) != string(value) {
+			t.Errorf("unexpected dead letter %v", msgs[0])
+		}
+		return nil
+	})
 
 	reader.Read(readFunc)
 
 	time.Sleep(3 * time.Second)
 	mockCtrl.Finish()
 }
+
+func TestKafkaReader_ProcessMessagePermanentErrorIsNotRetried(t *testing.T) {
+	reader := &KafkaReader{maxRetries: 3}
+
+	calls := 0
+	err := reader.processMessage(func(msg Message) error {
+		calls++
+		return &DecodeError{ContentType: ContentTypeJSON, Err: errors.New("error")}
+	}, Message{}, 0)
+
+	if err == nil {
+		t.Error("there should be an error for a permanent error")
+	}
+	if calls != 1 {
+		t.Errorf("permanent errors should not be retried, read func called %d times", calls)
+	}
+}
@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"sync"
+)
+
+// cachedClient caches the schemas and IDs returned by a registry, schemas never change once they got an ID
+type cachedClient struct {
+	client Client
+
+	mu      sync.RWMutex
+	schemas map[int]string
+	ids     map[string]map[string]int
+}
+
+// NewCachedClient returns a client which caches the responses of Register and Schema of the given client
+func NewCachedClient(client Client) Client {
+	return &cachedClient{
+		client:  client,
+		schemas: make(map[int]string),
+		ids:     make(map[string]map[string]int),
+	}
+}
+
+// Register registers a schema once for a subject and returns the cached ID afterwards
+func (c *cachedClient) Register(subject string, schema string) (int, error) {
+	c.mu.RLock()
+	id, ok := c.ids[subject][schema]
+	c.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	id, err := c.client.Register(subject, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ids[subject] == nil {
+		c.ids[subject] = make(map[string]int)
+	}
+	c.ids[subject][schema] = id
+	c.schemas[id] = schema
+	return id, nil
+}
+
+// Schema returns the schema with the given ID and fetches it only once
+func (c *cachedClient) Schema(id int) (string, error) {
+	c.mu.RLock()
+	schema, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	schema, err := c.client.Schema(id)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schemas[id] = schema
+	return schema, nil
+}
+
+// Compatible checks the compatibility with the registry, the result is not cached as the subject may change
+func (c *cachedClient) Compatible(subject string, schema string) (bool, error) {
+	return c.client.Compatible(subject, schema)
+}
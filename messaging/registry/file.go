@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// fileContent is the JSON document a FileClient stores its schemas in
+type fileContent struct {
+	Schemas  []string         `json:"schemas"`
+	Subjects map[string][]int `json:"subjects"`
+}
+
+// FileClient is a schema registry which stores its schemas in a JSON file, it is meant as a local stand-in for a
+// schema registry server
+type FileClient struct {
+	*MemoryClient
+	path string
+}
+
+// NewFileClient returns a schema registry backed by the file at path, the file is created on the first registration.
+// A file with subjects referring to schemas it does not contain is rejected.
+func NewFileClient(path string) (*FileClient, error) {
+	c := &FileClient{MemoryClient: NewMemoryClient(), path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var content fileContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+	for subject, ids := range content.Subjects {
+		for _, id := range ids {
+			if id < 1 || id > len(content.Schemas) {
+				return nil, fmt.Errorf("schema registry file %s has unknown schema id %d for subject %s", path, id, subject)
+			}
+		}
+	}
+	c.schemas = content.Schemas
+	if content.Subjects != nil {
+		c.subjects = content.Subjects
+	}
+	return c, nil
+}
+
+// Register registers the schema for the subject and writes all schemas to the file
+func (c *FileClient) Register(subject string, schema string) (int, error) {
+	id, err := c.MemoryClient.Register(subject, schema)
+	if err != nil {
+		return 0, err
+	}
+	return id, c.save()
+}
+
+func (c *FileClient) save() error {
+	c.mu.RLock()
+	data, err := json.MarshalIndent(fileContent{Schemas: c.schemas, Subjects: c.subjects}, "", "  ")
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, data, 0644)
+}
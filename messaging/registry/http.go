@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// httpClient talks to a schema registry with the REST API of the Confluent schema registry
+type httpClient struct {
+	url    string
+	client *http.Client
+}
+
+type schemaRequest struct {
+	Schema string `json:"schema"`
+}
+
+type schemaResponse struct {
+	ID     int    `json:"id"`
+	Schema string `json:"schema"`
+}
+
+type compatibilityResponse struct {
+	IsCompatible bool `json:"is_compatible"`
+}
+
+type errorResponse struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// NewHTTPClient returns a client for the schema registry at the given URL using the given http.Client
+func NewHTTPClient(registryURL string, client *http.Client) Client {
+	return &httpClient{url: strings.TrimRight(registryURL, "/"), client: client}
+}
+
+// Register registers the schema for the subject, an incompatible schema returns an *IncompatibleSchemaError
+func (c *httpClient) Register(subject string, schema string) (int, error) {
+	var res schemaResponse
+	status, err := c.do(http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", schemaRequest{schema}, &res)
+	if status == http.StatusConflict {
+		return 0, &IncompatibleSchemaError{Subject: subject}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.ID, nil
+}
+
+// Schema returns the schema with the given ID
+func (c *httpClient) Schema(id int) (string, error) {
+	var res schemaResponse
+	status, err := c.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &res)
+	if status == http.StatusNotFound {
+		return "", ErrSchemaNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return res.Schema, nil
+}
+
+// Compatible checks the schema against the latest schema of the subject, every schema is compatible to an unknown subject
+func (c *httpClient) Compatible(subject string, schema string) (bool, error) {
+	var res compatibilityResponse
+	status, err := c.do(http.MethodPost, "/compatibility/subjects/"+url.PathEscape(subject)+"/versions/latest", schemaRequest{schema}, &res)
+	if status == http.StatusNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.IsCompatible, nil
+}
+
+// do sends a request to the registry and decodes the response into res, it returns the status code of the response
+func (c *httpClient) do(method string, path string, body interface{}, res interface{}) (int, error) {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.url+path, &reqBody)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errRes errorResponse
+		json.NewDecoder(resp.Body).Decode(&errRes)
+		return resp.StatusCode, fmt.Errorf("schema registry %s %s returned %d: %s", method, path, resp.StatusCode, errRes.Message)
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(res)
+}
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req schemaRequest
+		if r.Method == http.MethodPost {
+			if ct := r.Header.Get("Content-Type"); ct != contentType {
+				t.Errorf("invalid content type: %s", ct)
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+		}
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/subjects/orders-value/versions":
+			if req.Schema == "incompatible" {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(errorResponse{ErrorCode: 409, Message: "incompatible"})
+				return
+			}
+			json.NewEncoder(w).Encode(schemaResponse{ID: 7})
+		case r.Method == http.MethodGet && r.URL.Path == "/schemas/ids/7":
+			json.NewEncoder(w).Encode(schemaResponse{Schema: "schema-7"})
+		case r.Method == http.MethodPost && r.URL.Path == "/compatibility/subjects/orders-value/versions/latest":
+			json.NewEncoder(w).Encode(compatibilityResponse{IsCompatible: req.Schema != "incompatible"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(errorResponse{ErrorCode: 40401, Message: "not found"})
+		}
+	}))
+}
+
+func TestHTTPClient(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	c := NewHTTPClient(server.URL+"/", server.Client())
+
+	if id, err := c.Register("orders-value", "schema-7"); err != nil || id != 7 {
+		t.Errorf("unexpected registration result: id %d, err %v", id, err)
+	}
+	if _, err := c.Register("orders-value", "incompatible"); err == nil {
+		t.Error("expected an error for an incompatible schema")
+	} else if _, ok := err.(*IncompatibleSchemaError); !ok {
+		t.Errorf("expected an IncompatibleSchemaError, got %v", err)
+	}
+
+	if schema, err := c.Schema(7); err != nil || schema != "schema-7" {
+		t.Errorf("unexpected schema: %s, err %v", schema, err)
+	}
+	if _, err := c.Schema(8); err != ErrSchemaNotFound {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+
+	if compatible, err := c.Compatible("orders-value", "schema-8"); err != nil || !compatible {
+		t.Errorf("schema should be compatible, err %v", err)
+	}
+	if compatible, _ := c.Compatible("orders-value", "incompatible"); compatible {
+		t.Error("schema should not be compatible")
+	}
+	if compatible, err := c.Compatible("payments-value", "schema-1"); err != nil || !compatible {
+		t.Errorf("schema should be compatible to an unknown subject, err %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"sync"
+)
+
+// CompatibilityFunc checks if a schema is compatible to the schemas previously registered for a subject
+type CompatibilityFunc func(schema string, previous []string) (bool, error)
+
+// MemoryClient is a schema registry keeping all schemas in memory, it is meant for tests and local development
+type MemoryClient struct {
+	// Compatibility checks new schemas of a subject, all schemas are compatible if it is nil
+	Compatibility CompatibilityFunc
+
+	mu       sync.RWMutex
+	schemas  []string
+	subjects map[string][]int
+}
+
+// NewMemoryClient returns an empty in memory schema registry
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{subjects: make(map[string][]int)}
+}
+
+// Register registers the schema for the subject, an incompatible schema returns an *IncompatibleSchemaError
+func (c *MemoryClient) Register(subject string, schema string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range c.subjects[subject] {
+		if c.schemas[id-1] == schema {
+			return id, nil
+		}
+	}
+
+	compatible, err := c.compatible(subject, schema)
+	if err != nil {
+		return 0, err
+	}
+	if !compatible {
+		return 0, &IncompatibleSchemaError{Subject: subject}
+	}
+
+	id := c.id(schema)
+	c.subjects[subject] = append(c.subjects[subject], id)
+	return id, nil
+}
+
+// Schema returns the schema with the given ID
+func (c *MemoryClient) Schema(id int) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if id < 1 || id > len(c.schemas) {
+		return "", ErrSchemaNotFound
+	}
+	return c.schemas[id-1], nil
+}
+
+// Compatible checks the schema with the CompatibilityFunc of the client
+func (c *MemoryClient) Compatible(subject string, schema string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.compatible(subject, schema)
+}
+
+func (c *MemoryClient) compatible(subject string, schema string) (bool, error) {
+	ids := c.subjects[subject]
+	if c.Compatibility == nil || len(ids) == 0 {
+		return true, nil
+	}
+	previous := make([]string, len(ids))
+	for i, id := range ids {
+		previous[i] = c.schemas[id-1]
+	}
+	return c.Compatibility(schema, previous)
+}
+
+// id returns the ID of a schema, schemas are identified by their ID across subjects like in the Confluent registry
+func (c *MemoryClient) id(schema string) int {
+	for i, s := range c.schemas {
+		if s == schema {
+			return i + 1
+		}
+	}
+	c.schemas = append(c.schemas, schema)
+	return len(c.schemas)
+}
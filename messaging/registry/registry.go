@@ -0,0 +1,58 @@
+// Package registry provides clients for a schema registry which stores the schemas of messages by subject and
+// assigns every schema a unique ID, and the Confluent wire format to reference those IDs in message values.
+package registry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// magicByte is the first byte of a value in the Confluent wire format
+const magicByte byte = 0
+
+// headerSize is the size of the magic byte and the schema ID preceding the payload
+const headerSize = 5
+
+// ErrInvalidWireFormat is returned when decoding data which is not in the Confluent wire format
+var ErrInvalidWireFormat = errors.New("data is not in the confluent wire format")
+
+// ErrSchemaNotFound is returned when a schema ID or subject is unknown to the registry
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// IncompatibleSchemaError is returned when a schema is not compatible to the schemas registered for a subject
+type IncompatibleSchemaError struct {
+	Subject string
+}
+
+// Error returns the error message
+func (e *IncompatibleSchemaError) Error() string {
+	return fmt.Sprintf("schema is not compatible with the schemas registered for subject %s", e.Subject)
+}
+
+// Client is a schema registry client
+type Client interface {
+	// Register registers the schema for the subject and returns its ID, registering an existing schema returns its ID
+	Register(subject string, schema string) (int, error)
+	// Schema returns the schema with the given ID
+	Schema(id int) (string, error)
+	// Compatible checks if the schema is compatible to the schemas registered for the subject
+	Compatible(subject string, schema string) (bool, error)
+}
+
+// Encode prepends the magic byte and the schema ID to the payload
+func Encode(id int, payload []byte) []byte {
+	data := make([]byte, headerSize+len(payload))
+	data[0] = magicByte
+	binary.BigEndian.PutUint32(data[1:headerSize], uint32(id))
+	copy(data[headerSize:], payload)
+	return data
+}
+
+// Decode returns the schema ID and the payload of data in the Confluent wire format
+func Decode(data []byte) (int, []byte, error) {
+	if len(data) < headerSize || data[0] != magicByte {
+		return 0, nil, ErrInvalidWireFormat
+	}
+	return int(binary.BigEndian.Uint32(data[1:headerSize])), data[headerSize:], nil
+}
@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	data := Encode(42, []byte("payload"))
+
+	if !bytes.Equal(data[:5], []byte{0, 0, 0, 0, 42}) {
+		t.Errorf("invalid wire format header: %v", data[:5])
+	}
+
+	id, payload, err := Decode(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != 42 || string(payload) != "payload" {
+		t.Errorf("invalid decoded data: id %d, payload %s", id, payload)
+	}
+}
+
+func TestDecode_InvalidWireFormat(t *testing.T) {
+	for _, data := range [][]byte{nil, {0, 0, 0}, {1, 0, 0, 0, 1, 'a'}} {
+		if _, _, err := Decode(data); err != ErrInvalidWireFormat {
+			t.Errorf("expected ErrInvalidWireFormat for %v, got %v", data, err)
+		}
+	}
+}
+
+func TestMemoryClient(t *testing.T) {
+	c := NewMemoryClient()
+
+	id, err := c.Register("orders-value", "schema-1")
+	if err != nil || id != 1 {
+		t.Fatalf("unexpected registration result: id %d, err %v", id, err)
+	}
+	if id, _ := c.Register("orders-value", "schema-1"); id != 1 {
+		t.Errorf("registering an existing schema should return its id, got %d", id)
+	}
+	if id, _ := c.Register("payments-value", "schema-1"); id != 1 {
+		t.Errorf("the same schema should have the same id for all subjects, got %d", id)
+	}
+	if id, _ := c.Register("orders-value", "schema-2"); id != 2 {
+		t.Errorf("expected a new id for a new schema, got %d", id)
+	}
+
+	if schema, err := c.Schema(2); err != nil || schema != "schema-2" {
+		t.Errorf("unexpected schema: %s, err %v", schema, err)
+	}
+	if _, err := c.Schema(3); err != ErrSchemaNotFound {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+}
+
+func TestMemoryClient_Compatibility(t *testing.T) {
+	c := NewMemoryClient()
+	c.Compatibility = func(schema string, previous []string) (bool, error) {
+		return schema != "incompatible", nil
+	}
+
+	if compatible, _ := c.Compatible("orders-value", "incompatible"); !compatible {
+		t.Error("every schema should be compatible to a new subject")
+	}
+
+	c.Register("orders-value", "schema-1")
+
+	if compatible, _ := c.Compatible("orders-value", "incompatible"); compatible {
+		t.Error("schema should not be compatible")
+	}
+	if _, err := c.Register("orders-value", "incompatible"); err == nil {
+		t.Error("registering an incompatible schema should fail")
+	} else if _, ok := err.(*IncompatibleSchemaError); !ok {
+		t.Errorf("expected an IncompatibleSchemaError, got %v", err)
+	}
+}
+
+func TestFileClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schemas.json")
+
+	c, err := NewFileClient(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.Register("orders-value", "schema-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c, err = NewFileClient(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening the registry: %v", err)
+	}
+	if schema, err := c.Schema(1); err != nil || schema != "schema-1" {
+		t.Errorf("schema was not stored in the file: %s, err %v", schema, err)
+	}
+	if id, _ := c.Register("orders-value", "schema-2"); id != 2 {
+		t.Errorf("expected id 2 for a new schema, got %d", id)
+	}
+}
+
+func TestFileClient_UnknownSchemaID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schemas.json")
+
+	for _, ids := range []string{"[0]", "[2]"} {
+		if err := ioutil.WriteFile(path, []byte(`{"schemas": ["schema-1"], "subjects": {"orders-value": `+ids+`}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewFileClient(path); err == nil {
+			t.Errorf("expected an error for subject ids %s", ids)
+		}
+	}
+}
+
+type countingClient struct {
+	Client
+	registers int
+	schemas   int
+}
+
+func (c *countingClient) Register(subject string, schema string) (int, error) {
+	c.registers++
+	return c.Client.Register(subject, schema)
+}
+
+func (c *countingClient) Schema(id int) (string, error) {
+	c.schemas++
+	return c.Client.Schema(id)
+}
+
+func TestCachedClient(t *testing.T) {
+	counting := &countingClient{Client: NewMemoryClient()}
+	c := NewCachedClient(counting)
+
+	for i := 0; i < 3; i++ {
+		if id, err := c.Register("orders-value", "schema-1"); err != nil || id != 1 {
+			t.Fatalf("unexpected registration result: id %d, err %v", id, err)
+		}
+	}
+	if counting.registers != 1 {
+		t.Errorf("expected one registration, got %d", counting.registers)
+	}
+
+	counting.Client.Register("orders-value", "schema-2")
+	for i := 0; i < 3; i++ {
+		if schema, err := c.Schema(2); err != nil || schema != "schema-2" {
+			t.Fatalf("unexpected schema: %s, err %v", schema, err)
+		}
+	}
+	if counting.schemas != 1 {
+		t.Errorf("expected one schema lookup, got %d", counting.schemas)
+	}
+
+	if _, err := c.Schema(3); err == nil {
+		t.Error("expected an error for an unknown schema")
+	}
+}
+
+type failingClient struct {
+	Client
+}
+
+func (failingClient) Schema(id int) (string, error) {
+	return "", errors.New("registry not available")
+}
+
+func TestCachedClient_Error(t *testing.T) {
+	c := NewCachedClient(failingClient{NewMemoryClient()})
+
+	if _, err := c.Schema(1); err == nil {
+		t.Error("expected the error of the registry")
+	}
+}
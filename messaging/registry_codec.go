@@ -0,0 +1,164 @@
+package messaging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/microdevs/missy/messaging/registry"
+	"github.com/microdevs/missy/service"
+	"github.com/pkg/errors"
+)
+
+// SchemaCodecFunc returns the codec for a schema, e.g. an AvroCodec created with NewAvroCodec
+type SchemaCodecFunc func(schema string) (Codec, error)
+
+// SchemaLookupError is returned when the schema of a message cannot be fetched from the registry, it is not
+// permanent so the message is processed again
+type SchemaLookupError struct {
+	ID  int
+	Err error
+}
+
+// Error returns the error message
+func (e *SchemaLookupError) Error() string {
+	return fmt.Sprintf("cannot fetch schema %d from registry: %v", e.ID, e.Err)
+}
+
+// Permanent returns false for lookup failures and true if the schema does not exist in the registry
+func (e *SchemaLookupError) Permanent() bool {
+	return e.Err == registry.ErrSchemaNotFound
+}
+
+// RegistryCodec encodes values in the Confluent wire format with the ID of a schema registered for a subject, values
+// are decoded with the schema referenced by their ID which is fetched from the registry once
+type RegistryCodec struct {
+	client   registry.Client
+	subject  string
+	schema   string
+	codec    Codec
+	newCodec SchemaCodecFunc
+
+	mu     sync.RWMutex
+	id     int
+	codecs map[int]Codec
+}
+
+// NewRegistryCodec returns a codec which registers the schema for the subject on the first Marshal, the schema is
+// checked for compatibility with the schemas registered before
+func NewRegistryCodec(client registry.Client, subject string, schema string, newCodec SchemaCodecFunc) (*RegistryCodec, error) {
+	codec, err := newCodec(schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid schema for subject %s", subject)
+	}
+	return &RegistryCodec{
+		client:   client,
+		subject:  subject,
+		schema:   schema,
+		codec:    codec,
+		newCodec: newCodec,
+		codecs:   make(map[int]Codec),
+	}, nil
+}
+
+// ContentType returns the content type of the codec for the schema
+func (c *RegistryCodec) ContentType() string {
+	return c.codec.ContentType()
+}
+
+// Marshal encodes v with the schema and prepends the schema ID
+func (c *RegistryCodec) Marshal(v interface{}) ([]byte, error) {
+	id, err := c.register()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return registry.Encode(id, payload), nil
+}
+
+// Unmarshal decodes data with the schema referenced by its schema ID
+func (c *RegistryCodec) Unmarshal(data []byte, v interface{}) error {
+	id, payload, err := registry.Decode(data)
+	if err != nil {
+		return err
+	}
+	codec, err := c.codecFor(id)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(payload, v)
+}
+
+// register registers the schema once and returns its ID
+func (c *RegistryCodec) register() (int, error) {
+	c.mu.RLock()
+	id := c.id
+	c.mu.RUnlock()
+	if id != 0 {
+		return id, nil
+	}
+
+	compatible, err := c.client.Compatible(c.subject, c.schema)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot check compatibility of schema for subject %s", c.subject)
+	}
+	if !compatible {
+		return 0, &registry.IncompatibleSchemaError{Subject: c.subject}
+	}
+	id, err = c.client.Register(c.subject, c.schema)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot register schema for subject %s", c.subject)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = id
+	c.codecs[id] = c.codec
+	return id, nil
+}
+
+// codecFor returns the cached codec for a schema ID and creates it from the schema in the registry on first use
+func (c *RegistryCodec) codecFor(id int) (Codec, error) {
+	c.mu.RLock()
+	codec, ok := c.codecs[id]
+	c.mu.RUnlock()
+	if ok {
+		return codec, nil
+	}
+
+	schema, err := c.client.Schema(id)
+	if err != nil {
+		return nil, &SchemaLookupError{ID: id, Err: err}
+	}
+	codec, err = c.newCodec(schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid schema %d", id)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.codecs[id] = codec
+	return codec, nil
+}
+
+// NewRegistryFromConfig returns a cached schema registry client for KAFKA_SCHEMA_REGISTRY_URL, a file:// URL
+// uses a schema registry stored in a local file
+func NewRegistryFromConfig() (registry.Client, error) {
+	registryURL := service.Config().Get(kafkaSchemaRegistryURL)
+	if registryURL == "" {
+		return nil, errors.New("no schema registry configured, set KAFKA_SCHEMA_REGISTRY_URL")
+	}
+
+	if strings.HasPrefix(registryURL, "file://") {
+		client, err := registry.NewFileClient(strings.TrimPrefix(registryURL, "file://"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot open schema registry file %s", registryURL)
+		}
+		return client, nil
+	}
+
+	return registry.NewCachedClient(registry.NewHTTPClient(registryURL, service.NewClient())), nil
+}
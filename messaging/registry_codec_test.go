@@ -0,0 +1,66 @@
+package messaging
+
+import (
+	"testing"
+
+	"github.com/microdevs/missy/messaging/registry"
+)
+
+func jsonCodecForSchema(schema string) (Codec, error) {
+	return JSONCodec{}, nil
+}
+
+func TestRegistryCodec(t *testing.T) {
+	client := registry.NewMemoryClient()
+	codec, err := NewRegistryCodec(client, "orders-value", `{"type":"record","name":"OrderCreated"}`, jsonCodecForSchema)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msg, err := Encode(codec, []byte("key"), orderCreated{ID: "1", Total: 42})
+	if err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+
+	id, _, err := registry.Decode(msg.Value)
+	if err != nil || id != 1 {
+		t.Errorf("value should reference the registered schema: id %d, err %v", id, err)
+	}
+
+	// a consumer resolves the schema by the id of the message
+	consumerCodec, _ := NewRegistryCodec(client, "orders-value", `{"type":"record","name":"OrderCreated"}`, jsonCodecForSchema)
+	var order orderCreated
+	if err := Decode(consumerCodec, msg, &order); err != nil {
+		t.Fatalf("unexpected error decoding: %v", err)
+	}
+	if order.ID != "1" || order.Total != 42 {
+		t.Errorf("invalid order decoded: %+v", order)
+	}
+}
+
+func TestRegistryCodec_Incompatible(t *testing.T) {
+	client := registry.NewMemoryClient()
+	client.Register("orders-value", "v1")
+	client.Compatibility = func(schema string, previous []string) (bool, error) {
+		return false, nil
+	}
+
+	codec, _ := NewRegistryCodec(client, "orders-value", "v2", jsonCodecForSchema)
+	if _, err := codec.Marshal(orderCreated{}); err == nil {
+		t.Error("there should be an error for an incompatible schema")
+	}
+}
+
+func TestRegistryCodec_DecodeErrors(t *testing.T) {
+	codec, _ := NewRegistryCodec(registry.NewMemoryClient(), "orders-value", "v1", jsonCodecForSchema)
+
+	err := Decode(codec, Message{Value: []byte("no wire format")}, &orderCreated{})
+	if !isPermanent(err) {
+		t.Errorf("expected a permanent error for an invalid wire format, got %v", err)
+	}
+
+	err = Decode(codec, Message{Value: registry.Encode(5, []byte("{}"))}, &orderCreated{})
+	if _, ok := err.(*SchemaLookupError); !ok || !isPermanent(err) {
+		t.Errorf("expected a permanent SchemaLookupError for an unknown schema, got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package messaging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/microdevs/missy/log"
+)
+
+// headers of request and reply messages
+const (
+	// CorrelationIDHeader holds the ID which relates a reply to its request
+	CorrelationIDHeader = "correlation-id"
+	// ReplyToHeader holds the topic the reply to a request is published to
+	ReplyToHeader = "reply-to"
+	// ReplyErrorHeader holds the error returned by the responder instead of a reply
+	ReplyErrorHeader = "reply-error"
+)
+
+// DefaultRequestTimeout is the time a Requester waits for a reply if the context has no deadline
+const DefaultRequestTimeout = time.Second * 30
+
+// ErrRequestTimeout is returned when no reply arrived in time
+var ErrRequestTimeout = errors.New("messaging: no reply received before the request timed out")
+
+// ErrRequesterClosed is returned for requests which are waiting when the requester is closed
+var ErrRequesterClosed = errors.New("messaging: requester was closed")
+
+// ReplyError is returned by Requester.Request when the responder failed to process the request
+type ReplyError struct {
+	Message string
+}
+
+// Error returns the error of the responder
+func (e *ReplyError) Error() string {
+	return "responder failed: " + e.Message
+}
+
+// ReplyFunc processes a request and returns the reply
+type ReplyFunc func(request Message) (Message, error)
+
+// Requester publishes requests and waits for their replies on a reply topic it consumes on its own. The reply topic
+// has to exist with a single partition and must not be shared with other requesters, e.g. a topic per service
+// instance. Replies are matched to their request by the correlation ID header.
+type Requester struct {
+	writer     Writer
+	replies    Reader
+	replyTopic string
+	// Timeout is used for requests whose context has no deadline, defaults to DefaultRequestTimeout
+	Timeout time.Duration
+
+	pending   map[string]chan Message
+	mu        sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRequester returns a requester which publishes requests to topic and consumes the replies from replyTopic
+// starting with the latest message. You need to close it after use. (Close())
+func NewRequester(brokers []string, topic string, replyTopic string) (*Requester, error) {
+	replies := NewPartitionReader(brokers, replyTopic, 0)
+	if err := replies.SeekToEnd(); err != nil {
+		replies.Close()
+		return nil, err
+	}
+	return newRequester(NewWriter(brokers, topic), replies, replyTopic)
+}
+
+// newRequester returns a requester which writes requests with writer and starts consuming the replies
+func newRequester(writer Writer, replies Reader, replyTopic string) (*Requester, error) {
+	r := &Requester{
+		writer:     writer,
+		replies:    replies,
+		replyTopic: replyTopic,
+		Timeout:    DefaultRequestTimeout,
+		pending:    make(map[string]chan Message),
+		done:       make(chan struct{}),
+	}
+	if err := replies.Read(r.dispatch); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Request publishes the request with a new correlation ID and the reply topic in its headers and waits for the reply.
+// It returns ErrRequestTimeout if the context or the timeout of the requester expires before the reply arrived.
+func (r *Requester) Request(ctx context.Context, request Message) (Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Message{}, err
+	}
+	request.Headers = append([]Header(nil), request.Headers...)
+	request.SetHeader(CorrelationIDHeader, []byte(id))
+	request.SetHeader(ReplyToHeader, []byte(r.replyTopic))
+
+	// register before publishing, so a fast reply is not missed
+	reply := make(chan Message, 1)
+	r.mu.Lock()
+	r.pending[id] = reply
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	if err := r.writer.WriteContext(ctx, request); err != nil {
+		return Message{}, err
+	}
+
+	select {
+	case m := <-reply:
+		if cause, ok := m.Header(ReplyErrorHeader); ok {
+			return m, &ReplyError{Message: string(cause)}
+		}
+		return m, nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return Message{}, ErrRequestTimeout
+		}
+		return Message{}, ctx.Err()
+	case <-r.done:
+		return Message{}, ErrRequesterClosed
+	}
+}
+
+// dispatch hands a reply to the request waiting for it, replies to requests which timed out are dropped
+func (r *Requester) dispatch(m Message) error {
+	id, ok := m.Header(CorrelationIDHeader)
+	if !ok {
+		log.Warnf("# messaging # dropping message without %s header from reply topic %s", CorrelationIDHeader, r.replyTopic)
+		return nil
+	}
+
+	r.mu.Lock()
+	reply, ok := r.pending[string(id)]
+	r.mu.Unlock()
+	if !ok {
+		log.Debugf("# messaging # dropping reply %s, the request is not waiting anymore", id)
+		return nil
+	}
+
+	select {
+	case reply <- m:
+	default:
+		// a reply was delivered already
+	}
+	return nil
+}
+
+// Close stops waiting requests and closes the reply reader and the writer
+func (r *Requester) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	rerr := r.replies.Close()
+	werr := r.writer.Close()
+	if rerr != nil {
+		return rerr
+	}
+	return werr
+}
+
+// ReplyWriteError is returned by a Responder when the reply cannot be sent. It is permanent, the request is not
+// processed again as that could repeat its side effects.
+type ReplyWriteError struct {
+	ReplyTo string
+	Err     error
+}
+
+// Error returns the cause of the failed write
+func (e *ReplyWriteError) Error() string {
+	return fmt.Sprintf("cannot send reply to %s: %v", e.ReplyTo, e.Err)
+}
+
+// Permanent marks failed replies as permanent, only the write of the reply is retried
+func (e *ReplyWriteError) Permanent() bool {
+	return true
+}
+
+// Responder returns a ReadMessageFunc which calls fn for every request and publishes its reply with w to the topic
+// in the reply-to header of the request. If fn fails the error is published in the reply-error header instead, so the
+// requester does not have to wait for its timeout. Requests without reply-to header are processed without a reply.
+// A failed write of the reply is retried with KAFKA_RETRIES_MAX_NUMBER and KAFKA_RETRIES_INTERVAL without calling fn
+// again, if it still fails a *ReplyWriteError is returned.
+func Responder(w Writer, fn ReplyFunc) ReadMessageFunc {
+	retries, interval := fetchRetriesAndInterval()
+	return newResponder(w, fn, retries, interval)
+}
+
+// newResponder returns a Responder which retries the write of a reply the given number of times
+func newResponder(w Writer, fn ReplyFunc, retries int, interval time.Duration) ReadMessageFunc {
+	return func(request Message) error {
+		reply, err := fn(request)
+
+		replyTo, ok := request.Header(ReplyToHeader)
+		if !ok {
+			if err != nil {
+				return err
+			}
+			log.Debugf("# messaging # request has no %s header, not sending the reply", ReplyToHeader)
+			return nil
+		}
+
+		if err != nil {
+			reply = Message{Key: request.Key}
+			reply.SetHeader(ReplyErrorHeader, []byte(err.Error()))
+		} else {
+			reply.Headers = append([]Header(nil), reply.Headers...)
+		}
+		reply.Topic = string(replyTo)
+		if id, ok := request.Header(CorrelationIDHeader); ok {
+			reply.SetHeader(CorrelationIDHeader, id)
+		}
+
+		werr := w.WriteContext(context.Background(), reply)
+		for retry := 1; werr != nil && retry <= retries; retry++ {
+			log.Errorf("# messaging # cannot send reply to %s, retry number %v: %v", replyTo, retry, werr)
+			time.Sleep(interval)
+			werr = w.WriteContext(context.Background(), reply)
+		}
+		if werr != nil {
+			return &ReplyWriteError{ReplyTo: string(replyTo), Err: werr}
+		}
+		return nil
+	}
+}
+
+// newID returns a random ID, e.g. for correlation IDs
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot create random id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,193 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// funcReader is a Reader which keeps the read func, so tests can deliver messages to it
+type funcReader struct {
+	msgFunc ReadMessageFunc
+	closed  bool
+}
+
+func (r *funcReader) Read(msgFunc ReadMessageFunc) error {
+	r.msgFunc = msgFunc
+	return nil
+}
+
+func (r *funcReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+// funcWriter is a Writer which hands written messages to a function
+type funcWriter struct {
+	write func(m Message) error
+}
+
+func (w *funcWriter) Write(key, value []byte) error {
+	return w.write(Message{Key: key, Value: value})
+}
+
+func (w *funcWriter) WriteContext(ctx context.Context, msgs ...Message) error {
+	for _, m := range msgs {
+		if err := w.write(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *funcWriter) Close() error {
+	return nil
+}
+
+// newLoopbackRequester returns a requester whose requests are answered by fn through a Responder
+func newLoopbackRequester(t *testing.T, fn ReplyFunc) (*Requester, *funcReader) {
+	replies := &funcReader{}
+	replyWriter := &funcWriter{write: func(m Message) error {
+		if m.Topic != "replies" {
+			t.Errorf("Expected reply to be sent to topic replies, got %s", m.Topic)
+		}
+		go replies.msgFunc(m)
+		return nil
+	}}
+	responder := Responder(replyWriter, fn)
+	requests := &funcWriter{write: responder}
+
+	requester, err := newRequester(requests, replies, "replies")
+	if err != nil {
+		t.Fatalf("Unexpected error creating requester: %v", err)
+	}
+	return requester, replies
+}
+
+func TestRequester_Request(t *testing.T) {
+	requester, _ := newLoopbackRequester(t, func(request Message) (Message, error) {
+		if _, ok := request.Header(CorrelationIDHeader); !ok {
+			t.Error("Expected request to have a correlation id")
+		}
+		return Message{Value: append([]byte("hello "), request.Value...)}, nil
+	})
+
+	reply, err := requester.Request(context.Background(), Message{Value: []byte("world")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(reply.Value) != "hello world" {
+		t.Errorf("Expected reply hello world, got %s", reply.Value)
+	}
+	if len(requester.pending) != 0 {
+		t.Errorf("Expected no pending requests, got %d", len(requester.pending))
+	}
+}
+
+func TestRequester_ReplyError(t *testing.T) {
+	requester, _ := newLoopbackRequester(t, func(request Message) (Message, error) {
+		return Message{}, errors.New("out of stock")
+	})
+
+	_, err := requester.Request(context.Background(), Message{Value: []byte("order")})
+	replyErr, ok := err.(*ReplyError)
+	if !ok || replyErr.Message != "out of stock" {
+		t.Errorf("Expected a *ReplyError with out of stock, got %v", err)
+	}
+}
+
+func TestRequester_Timeout(t *testing.T) {
+	replies := &funcReader{}
+	var request Message
+	requester, _ := newRequester(&funcWriter{write: func(m Message) error {
+		request = m
+		return nil
+	}}, replies, "replies")
+	requester.Timeout = time.Millisecond * 10
+
+	_, err := requester.Request(context.Background(), Message{Value: []byte("order")})
+	if err != ErrRequestTimeout {
+		t.Errorf("Expected ErrRequestTimeout, got %v", err)
+	}
+
+	// a late reply is dropped
+	if err := replies.msgFunc(request); err != nil {
+		t.Errorf("Expected late reply to be dropped without error, got %v", err)
+	}
+	if replyTo, _ := request.Header(ReplyToHeader); string(replyTo) != "replies" {
+		t.Errorf("Expected reply-to header replies, got %s", replyTo)
+	}
+}
+
+func TestRequester_Close(t *testing.T) {
+	replies := &funcReader{}
+	requester, _ := newRequester(&funcWriter{write: func(m Message) error { return nil }}, replies, "replies")
+
+	result := make(chan error)
+	go func() {
+		_, err := requester.Request(context.Background(), Message{})
+		result <- err
+	}()
+	time.Sleep(time.Millisecond * 10)
+	requester.Close()
+
+	if err := <-result; err != ErrRequesterClosed {
+		t.Errorf("Expected ErrRequesterClosed, got %v", err)
+	}
+	if !replies.closed {
+		t.Error("Expected reply reader to be closed")
+	}
+}
+
+func TestResponder_WithoutReplyTo(t *testing.T) {
+	responder := Responder(&funcWriter{write: func(m Message) error {
+		t.Error("Expected no reply to be sent")
+		return nil
+	}}, func(request Message) (Message, error) {
+		return Message{}, errors.New("failed")
+	})
+
+	if err := responder(Message{}); err == nil || err.Error() != "failed" {
+		t.Errorf("Expected the error of the reply func, got %v", err)
+	}
+}
+
+func TestResponder_RetriesOnlyTheReplyWrite(t *testing.T) {
+	calls, writes := 0, 0
+	responder := newResponder(&funcWriter{write: func(m Message) error {
+		writes++
+		if writes < 3 {
+			return errors.New("broker not available")
+		}
+		return nil
+	}}, func(request Message) (Message, error) {
+		calls++
+		return Message{Value: []byte("reply")}, nil
+	}, 2, 0)
+
+	request := Message{}
+	request.SetHeader(ReplyToHeader, []byte("replies"))
+	if err := responder(request); err != nil {
+		t.Fatalf("Expected the reply to be sent after retrying, got %v", err)
+	}
+	if calls != 1 || writes != 3 {
+		t.Errorf("Expected 1 call and 3 writes, got %d calls and %d writes", calls, writes)
+	}
+
+	calls, writes = 0, 0
+	failing := newResponder(&funcWriter{write: func(m Message) error {
+		writes++
+		return errors.New("broker not available")
+	}}, func(request Message) (Message, error) {
+		calls++
+		return Message{Value: []byte("reply")}, nil
+	}, 2, 0)
+	err := failing(request)
+	if _, ok := err.(*ReplyWriteError); !ok || !isPermanent(err) {
+		t.Errorf("Expected a permanent *ReplyWriteError, got %v", err)
+	}
+	if calls != 1 || writes != 3 {
+		t.Errorf("Expected 1 call and 3 writes, got %d calls and %d writes", calls, writes)
+	}
+}
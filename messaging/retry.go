@@ -0,0 +1,184 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/microdevs/missy/log"
+)
+
+// headers of messages published to retry topics
+const (
+	// RetryAttemptHeader holds the number of failed attempts to process the message
+	RetryAttemptHeader = "retry-attempt"
+	// RetryDueHeader holds the time in unix milliseconds after which the message is processed again
+	RetryDueHeader = "retry-due"
+	// RetryTopicHeader holds the topic the message was originally published to
+	RetryTopicHeader = "retry-original-topic"
+	// RetryErrorHeader holds the error of the last failed attempt
+	RetryErrorHeader = "retry-error"
+)
+
+// retryTier is a retry topic consumed by a KafkaReader
+type retryTier struct {
+	topic  string
+	delay  time.Duration
+	reader BrokerReader
+}
+
+// RetryTopic returns the name of the retry topic of a topic for the given delay, e.g. orders.retry.1m
+func RetryTopic(topic string, delay time.Duration) string {
+	return topic + ".retry." + formatDelay(delay)
+}
+
+// formatDelay formats a delay in the largest unit it is a multiple of, e.g. 10m instead of 10m0s
+func formatDelay(delay time.Duration) string {
+	switch {
+	case delay%time.Hour == 0:
+		return fmt.Sprintf("%dh", delay/time.Hour)
+	case delay%time.Minute == 0:
+		return fmt.Sprintf("%dm", delay/time.Minute)
+	case delay%time.Second == 0:
+		return fmt.Sprintf("%ds", delay/time.Second)
+	default:
+		return delay.String()
+	}
+}
+
+// NewReaderWithRetryTopics returns a reader which does not retry failed messages in place. A failed message is
+// published to the retry topic of the first delay (see RetryTopic) and committed, so it does not block its partition.
+// The reader consumes the retry topics as well and processes their messages again once their delay is over. A message
+// which failed on the retry topic of the last delay is sent to the DLQ, an empty dlqTopic defaults to topic.dlq. A
+// failed message is only committed once it was written to a retry topic or the DLQ. The retry topics have to exist. You need to close it after use. (Close())
+func NewReaderWithRetryTopics(brokers []string, groupID string, topic string, dlqTopic string, delays ...time.Duration) *KafkaReader {
+	reader := NewReaderWithDLQ(brokers, groupID, topic, dlqTopic)
+	reader.retryWriter = NewWriter(brokers, topic)
+	for _, delay := range delays {
+		retryTopic := RetryTopic(topic, delay)
+		reader.retryTiers = append(reader.retryTiers, retryTier{
+			topic:  retryTopic,
+			delay:  delay,
+			reader: newReadBroker(brokers, groupID, retryTopic, reader.maxRetries, reader.retriesInterval),
+		})
+	}
+	return reader
+}
+
+// processWithRetryTopics processes a message once and publishes it to the next retry topic or the DLQ on failure. The
+// message is only handed over once the write succeeded, an error is returned if the reader was closed meanwhile.
+func (mr *KafkaReader) processWithRetryTopics(ctx context.Context, msgFunc ReadMessageFunc, m Message) error {
+	err := msgFunc(m)
+	if err == nil {
+		return nil
+	}
+
+	attempt := retryAttempt(m)
+	if isPermanent(err) || attempt >= len(mr.retryTiers) {
+		log.Errorf("# messaging # %v, sending message to dead letter queue after %d attempts", err, attempt+1)
+		return mr.handOver(func() error {
+			return mr.sendToDLQ(ctx, m, err)
+		})
+	}
+
+	tier := mr.retryTiers[attempt]
+	log.Errorf("# messaging # %v, retrying message in %s", err, tier.delay)
+	return mr.handOver(func() error {
+		werr := mr.retryWriter.WriteContext(ctx, retryMessage(m, tier, attempt+1, mr.topic, err))
+		if werr == nil {
+			return nil
+		}
+		log.Errorf("Sending message to retry topic %s failed because: %v, sending it to dead letter queue", tier.topic, werr)
+		if mr.dlqWriter == nil {
+			return werr
+		}
+		return mr.sendToDLQ(ctx, m, err)
+	})
+}
+
+// handOver calls write until it succeeds, so a failed message is not committed before it was written to a retry topic
+// or the DLQ. It returns the last error if the reader was closed meanwhile.
+func (mr *KafkaReader) handOver(write func() error) error {
+	interval := mr.retriesInterval
+	if interval <= 0 {
+		interval = defaultKafkaRetriesInterval
+	}
+	for {
+		err := write()
+		if err == nil {
+			return nil
+		}
+		log.Errorf("# messaging # cannot hand over failed message, trying again in %s: %v", interval, err)
+		select {
+		case <-time.After(interval):
+		case <-mr.done:
+			return err
+		}
+	}
+}
+
+// sendToDLQ writes a message including its headers to the DLQ, messages are dropped if there is no DLQ
+func (mr *KafkaReader) sendToDLQ(ctx context.Context, m Message, cause error) error {
+	if mr.dlqWriter == nil {
+		return nil
+	}
+	dlqMsg := Message{Key: m.Key, Value: m.Value, Headers: append([]Header(nil), m.Headers...)}
+	dlqMsg.SetHeader(RetryErrorHeader, []byte(cause.Error()))
+	if err := mr.dlqWriter.WriteContext(ctx, dlqMsg); err != nil {
+		return fmt.Errorf("sending message to dead letter queue failed because: %v", err)
+	}
+	return nil
+}
+
+// waitUntilDue blocks until a message of a retry topic is due, it returns false if the reader was closed meanwhile
+func (mr *KafkaReader) waitUntilDue(m Message) bool {
+	due, ok := m.Header(RetryDueHeader)
+	if !ok {
+		return true
+	}
+	dueMillis, err := strconv.ParseInt(string(due), 10, 64)
+	if err != nil {
+		log.Warnf("# messaging # invalid %s header %q, processing message right away", RetryDueHeader, due)
+		return true
+	}
+
+	wait := time.Until(time.Unix(0, dueMillis*int64(time.Millisecond)))
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-mr.done:
+		return false
+	}
+}
+
+// retryMessage returns a copy of the message for a retry topic with the retry headers set
+func retryMessage(m Message, tier retryTier, attempt int, topic string, cause error) Message {
+	retry := Message{Topic: tier.topic, Key: m.Key, Value: m.Value, Headers: append([]Header(nil), m.Headers...)}
+	due := time.Now().Add(tier.delay).UnixNano() / int64(time.Millisecond)
+	retry.SetHeader(RetryAttemptHeader, []byte(strconv.Itoa(attempt)))
+	retry.SetHeader(RetryDueHeader, []byte(strconv.FormatInt(due, 10)))
+	if _, ok := m.Header(RetryTopicHeader); !ok {
+		retry.SetHeader(RetryTopicHeader, []byte(topic))
+	}
+	retry.SetHeader(RetryErrorHeader, []byte(cause.Error()))
+	return retry
+}
+
+// retryAttempt returns the number of failed attempts recorded in the message, 0 for messages of the topic itself
+func retryAttempt(m Message) int {
+	value, ok := m.Header(RetryAttemptHeader)
+	if !ok {
+		return 0
+	}
+	attempt, err := strconv.Atoi(string(value))
+	if err != nil || attempt < 0 {
+		return 0
+	}
+	return attempt
+}
@@ -0,0 +1,213 @@
+package messaging
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+)
+
+func TestRetryTopic(t *testing.T) {
+	tests := []struct {
+		delay    time.Duration
+		expected string
+	}{
+		{delay: time.Minute, expected: "orders.retry.1m"},
+		{delay: 10 * time.Minute, expected: "orders.retry.10m"},
+		{delay: 2 * time.Hour, expected: "orders.retry.2h"},
+		{delay: 30 * time.Second, expected: "orders.retry.30s"},
+		{delay: 1500 * time.Millisecond, expected: "orders.retry.1.5s"},
+	}
+
+	for _, test := range tests {
+		if topic := RetryTopic("orders", test.delay); topic != test.expected {
+			t.Error(expected(topic, test.expected))
+		}
+	}
+}
+
+func newRetryReader(ctrl *gomock.Controller) (*KafkaReader, *MockWriter, *MockWriter) {
+	retryWriterMock := NewMockWriter(ctrl)
+	dlqWriterMock := NewMockWriter(ctrl)
+	reader := &KafkaReader{
+		topic:       "orders",
+		retryWriter: retryWriterMock,
+		dlqWriter:   dlqWriterMock,
+		retryTiers: []retryTier{
+			{topic: "orders.retry.1m", delay: time.Minute},
+			{topic: "orders.retry.10m", delay: 10 * time.Minute},
+		},
+		done: make(chan struct{}),
+	}
+	return reader, retryWriterMock, dlqWriterMock
+}
+
+func TestKafkaReader_ProcessWithRetryTopics(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	reader, retryWriterMock, _ := newRetryReader(mockCtrl)
+
+	retryWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msgs ...Message) error {
+		m := msgs[0]
+		if m.Topic != "orders.retry.1m" {
+			t.Error(expected(m.Topic, "orders.retry.1m"))
+		}
+		if attempt, _ := m.Header(RetryAttemptHeader); string(attempt) != "1" {
+			t.Error(expected(string(attempt), "1"))
+		}
+		if topic, _ := m.Header(RetryTopicHeader); string(topic) != "orders" {
+			t.Error(expected(string(topic), "orders"))
+		}
+		due, _ := m.Header(RetryDueHeader)
+		dueMillis, _ := strconv.ParseInt(string(due), 10, 64)
+		if wait := time.Until(time.Unix(0, dueMillis*int64(time.Millisecond))); wait < 59*time.Second || wait > time.Minute {
+			t.Errorf("message should be due in a minute, is due in %s", wait)
+		}
+		return nil
+	})
+
+	reader.processWithRetryTopics(context.Background(), func(msg Message) error {
+		return errors.New("error")
+	}, Message{Topic: "orders", Key: []byte("key"), Value: []byte("value")})
+}
+
+func TestKafkaReader_ProcessWithRetryTopicsNextTier(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	reader, retryWriterMock, _ := newRetryReader(mockCtrl)
+
+	retryWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msgs ...Message) error {
+		if msgs[0].Topic != "orders.retry.10m" {
+			t.Error(expected(msgs[0].Topic, "orders.retry.10m"))
+		}
+		if attempt, _ := msgs[0].Header(RetryAttemptHeader); string(attempt) != "2" {
+			t.Error(expected(string(attempt), "2"))
+		}
+		return nil
+	})
+
+	m := Message{Topic: "orders.retry.1m"}
+	m.SetHeader(RetryAttemptHeader, []byte("1"))
+	m.SetHeader(RetryTopicHeader, []byte("orders"))
+
+	reader.processWithRetryTopics(context.Background(), func(msg Message) error {
+		return errors.New("error")
+	}, m)
+}
+
+func TestKafkaReader_ProcessWithRetryTopicsExhausted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	reader, _, dlqWriterMock := newRetryReader(mockCtrl)
+
+	dlqWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msgs ...Message) error {
+		if topic, _ := msgs[0].Header(RetryTopicHeader); string(topic) != "orders" {
+			t.Error("original topic header should be kept in the dead letter queue")
+		}
+		if cause, _ := msgs[0].Header(RetryErrorHeader); string(cause) != "error" {
+			t.Error(expected(string(cause), "error"))
+		}
+		return nil
+	})
+
+	m := Message{Topic: "orders.retry.10m"}
+	m.SetHeader(RetryAttemptHeader, []byte("2"))
+	m.SetHeader(RetryTopicHeader, []byte("orders"))
+
+	reader.processWithRetryTopics(context.Background(), func(msg Message) error {
+		return errors.New("error")
+	}, m)
+}
+
+func TestKafkaReader_ProcessWithRetryTopicsPermanentError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	reader, _, dlqWriterMock := newRetryReader(mockCtrl)
+
+	dlqWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).Return(nil)
+
+	reader.processWithRetryTopics(context.Background(), func(msg Message) error {
+		return &DecodeError{ContentType: ContentTypeJSON, Err: errors.New("error")}
+	}, Message{Topic: "orders"})
+}
+
+func TestKafkaReader_ProcessWithRetryTopicsWriteFailures(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	reader, retryWriterMock, dlqWriterMock := newRetryReader(mockCtrl)
+	reader.retriesInterval = time.Millisecond
+
+	gomock.InOrder(
+		retryWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).Return(errors.New("retry topic not available")),
+		dlqWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).Return(errors.New("dlq not available")),
+		retryWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).Return(nil),
+	)
+
+	err := reader.processWithRetryTopics(context.Background(), func(msg Message) error {
+		return errors.New("error")
+	}, Message{Topic: "orders"})
+	if err != nil {
+		t.Errorf("the message should be handed over once the retry topic is available, got %v", err)
+	}
+}
+
+func TestKafkaReader_FailedHandOverIsNotCommitted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	reader, retryWriterMock, dlqWriterMock := newRetryReader(mockCtrl)
+	reader.retriesInterval = time.Millisecond
+	brokerReaderMock := NewMockBrokerReader(mockCtrl)
+	reader.brokerReader = brokerReaderMock
+
+	msg := Message{Topic: "orders", Key: []byte("key")}
+	brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).Return(msg, nil)
+	// no CommitMessages, the message has to be fetched again
+	failed := make(chan struct{}, 1)
+	retryWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).AnyTimes().Return(errors.New("retry topic not available"))
+	dlqWriterMock.EXPECT().WriteContext(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, msgs ...Message) error {
+		select {
+		case failed <- struct{}{}:
+		default:
+		}
+		return errors.New("dlq not available")
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		reader.consume(brokerReaderMock, func(msg Message) error { return errors.New("error") }, false)
+		close(stopped)
+	}()
+
+	<-failed
+	close(reader.done)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the reader should stop handing over the message when it is closed")
+	}
+}
+
+func TestKafkaReader_WaitUntilDue(t *testing.T) {
+	reader := &KafkaReader{done: make(chan struct{})}
+
+	m := Message{}
+	due := time.Now().Add(20*time.Millisecond).UnixNano() / int64(time.Millisecond)
+	m.SetHeader(RetryDueHeader, []byte(strconv.FormatInt(due, 10)))
+
+	start := time.Now()
+	if !reader.waitUntilDue(m) {
+		t.Error("message should be due")
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("reader should wait until the message is due")
+	}
+
+	m.SetHeader(RetryDueHeader, []byte(strconv.FormatInt(due+int64(time.Hour/time.Millisecond), 10)))
+	close(reader.done)
+	if reader.waitUntilDue(m) {
+		t.Error("waiting should stop when the reader is closed")
+	}
+}
@@ -0,0 +1,172 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/microdevs/missy/log"
+	"github.com/microdevs/missy/service"
+	"github.com/segmentio/kafka-go"
+)
+
+// revocationMaxWait is the longest time a published revocation waits at the broker before it is fetched
+const revocationMaxWait = time.Second
+
+// revocationRetryInterval is the time the feed waits before fetching again after the broker was not available
+const revocationRetryInterval = time.Second * 5
+
+// RevocationFeed keeps a revocation store up to date with the revocations published to a topic. It reads every
+// partition from the beginning without a consumer group, so each instance of a service sees all revocations within
+// seconds and a restarted instance gets back all revocations which have not expired. The feed keeps fetching while the
+// brokers are not available, Check reports it as failing meanwhile.
+type RevocationFeed struct {
+	readers       map[int]BrokerReader
+	handle        ReadMessageFunc
+	retryInterval time.Duration
+	errs          map[int]error
+	mu            sync.Mutex
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+// NewRevocationFeed starts reading the revocations of the topic into the store, use it together with
+// service.SetRevocationStore and register Check as readiness check. You need to close it after use. (Close())
+func NewRevocationFeed(brokers []string, topic string, store *service.MemoryRevocationStore) (*RevocationFeed, error) {
+	partitions, err := readPartitions(context.Background(), brokers, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	retries, intervalTime := fetchRetriesAndInterval()
+	readers := make(map[int]BrokerReader, len(partitions))
+	for _, p := range partitions {
+		readers[p.ID] = &readBroker{kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   brokers,
+			Topic:     topic,
+			Partition: p.ID,
+			MinBytes:  1,
+			MaxBytes:  10e6, // 10MB do we want it from config?
+			MaxWait:   revocationMaxWait,
+		}), retries, intervalTime}
+	}
+	return newRevocationFeed(readers, store, revocationRetryInterval), nil
+}
+
+// newRevocationFeed starts reading the revocations from the broker readers by partition, a failed fetch is repeated
+// after the retry interval
+func newRevocationFeed(readers map[int]BrokerReader, store *service.MemoryRevocationStore, retryInterval time.Duration) *RevocationFeed {
+	f := &RevocationFeed{
+		readers:       readers,
+		handle:        RevocationHandler(store),
+		retryInterval: retryInterval,
+		errs:          make(map[int]error),
+		done:          make(chan struct{}),
+	}
+	for partition, reader := range readers {
+		go f.consume(partition, reader)
+	}
+	return f
+}
+
+// consume adds the revocations of a partition to the store until the feed is closed, fetch errors are retried
+func (f *RevocationFeed) consume(partition int, reader BrokerReader) {
+	for {
+		m, err := reader.FetchMessage(context.Background())
+		select {
+		case <-f.done:
+			return
+		default:
+		}
+		f.setError(partition, err)
+		if err != nil {
+			log.Errorf("Cannot fetch revocations of partition %d, fetching again in %s: %v", partition, f.retryInterval, err)
+			select {
+			case <-time.After(f.retryInterval):
+				continue
+			case <-f.done:
+				return
+			}
+		}
+		if err := f.handle(m); err != nil {
+			log.WithFields(messageFields(m)).Errorf("Skipping invalid revocation: %v", err)
+		}
+	}
+}
+
+// setError records the result of the last fetch of a partition
+func (f *RevocationFeed) setError(partition int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.errs, partition)
+		return
+	}
+	f.errs[partition] = err
+}
+
+// Check fails while the revocations of a partition cannot be fetched, it can be registered as service.Check
+func (f *RevocationFeed) Check() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for partition, err := range f.errs {
+		return fmt.Errorf("cannot fetch revocations of partition %d: %v", partition, err)
+	}
+	return nil
+}
+
+// Close stops reading the revocations
+func (f *RevocationFeed) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
+	var err error
+	for partition, reader := range f.readers {
+		if closeErr := reader.Close(); closeErr != nil {
+			log.Errorf("Cannot close reader of partition %d of the revocation feed: %v", partition, closeErr)
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// RevocationHandler returns a ReadMessageFunc which adds the service.Revocation in the JSON value of a message to the
+// store, invalid revocations are rejected with a *DecodeError
+func RevocationHandler(store *service.MemoryRevocationStore) ReadMessageFunc {
+	return func(m Message) error {
+		var r service.Revocation
+		if err := json.Unmarshal(m.Value, &r); err != nil {
+			return &DecodeError{ContentType: ContentTypeJSON, Err: err}
+		}
+		if r.ID == "" && r.Subject == "" {
+			return &DecodeError{ContentType: ContentTypeJSON, Err: errors.New("revocation has neither a jti nor a sub")}
+		}
+		store.Revoke(r)
+		return nil
+	}
+}
+
+// PublishRevocation writes the revocation to the topic of the writer. A subject revocation without RevokedAt revokes
+// the tokens issued until now, so the subject can be enabled again by issuing new tokens.
+func PublishRevocation(ctx context.Context, w Writer, r service.Revocation) error {
+	if r.ID == "" && r.Subject == "" {
+		return errors.New("revocation has neither a jti nor a sub")
+	}
+	if r.Subject != "" && r.RevokedAt.IsZero() {
+		r.RevokedAt = time.Now()
+	}
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	key := r.ID
+	if key == "" {
+		key = r.Subject
+	}
+	m := Message{Key: []byte(key), Value: value}
+	m.SetHeader(ContentTypeHeader, []byte(ContentTypeJSON))
+	return w.WriteContext(ctx, m)
+}
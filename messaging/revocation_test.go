@@ -0,0 +1,101 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/microdevs/missy/service"
+)
+
+func TestPublishRevocation(t *testing.T) {
+	store := service.NewMemoryRevocationStore()
+	handle := RevocationHandler(store)
+	var published []Message
+	w := &funcWriter{write: func(m Message) error {
+		published = append(published, m)
+		return handle(m)
+	}}
+
+	if err := PublishRevocation(context.Background(), w, service.Revocation{ID: "token-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := PublishRevocation(context.Background(), w, service.Revocation{Subject: "user@missy.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := PublishRevocation(context.Background(), w, service.Revocation{}); err == nil {
+		t.Error("expected an error for a revocation without jti and sub")
+	}
+
+	if len(published) != 2 || string(published[0].Key) != "token-1" || string(published[1].Key) != "user@missy.com" {
+		t.Fatalf("unexpected messages %v", published)
+	}
+	var r service.Revocation
+	if err := json.Unmarshal(published[1].Value, &r); err != nil || r.RevokedAt.IsZero() {
+		t.Errorf("expected the subject revocation to have a revocation time, got %+v, error %v", r, err)
+	}
+
+	if !store.Revoked(&service.Claims{ID: "token-1"}) || !store.Revoked(&service.Claims{Subject: "user@missy.com", IssuedAt: r.RevokedAt.Add(-1)}) {
+		t.Error("expected the published revocations in the store")
+	}
+	if store.Revoked(&service.Claims{Subject: "user@missy.com", IssuedAt: r.RevokedAt.Add(time.Second)}) {
+		t.Error("expected tokens issued after the revocation to be accepted")
+	}
+}
+
+func TestRevocationHandler_InvalidMessages(t *testing.T) {
+	handle := RevocationHandler(service.NewMemoryRevocationStore())
+	for _, value := range []string{"not json", "{}"} {
+		if err := handle(Message{Value: []byte(value)}); !isPermanent(err) {
+			t.Errorf("%q: expected a permanent error but got %v", value, err)
+		}
+	}
+}
+
+func TestRevocationFeed_FetchesAgainAfterErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	revocation := Message{Key: []byte("token-1"), Value: []byte(`{"jti": "token-1"}`)}
+	failed := make(chan struct{})
+	closed := make(chan struct{})
+	brokerReaderMock := NewMockBrokerReader(mockCtrl)
+	gomock.InOrder(
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).DoAndReturn(func(context.Context) (Message, error) {
+			close(failed)
+			return Message{}, errors.New("broker not available")
+		}),
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).DoAndReturn(func(context.Context) (Message, error) {
+			<-failed
+			return revocation, nil
+		}),
+		brokerReaderMock.EXPECT().FetchMessage(gomock.Any()).DoAndReturn(func(context.Context) (Message, error) {
+			<-closed
+			return Message{}, errors.New("closed")
+		}),
+	)
+	brokerReaderMock.EXPECT().Close().Do(func() { close(closed) }).Return(nil)
+
+	store := service.NewMemoryRevocationStore()
+	feed := newRevocationFeed(map[int]BrokerReader{0: brokerReaderMock}, store, 50*time.Millisecond)
+	<-failed
+	time.Sleep(10 * time.Millisecond)
+	if err := feed.Check(); err == nil {
+		t.Error("expected the check to fail while the broker is not available")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !store.Revoked(&service.Claims{ID: "token-1"}) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !store.Revoked(&service.Claims{ID: "token-1"}) {
+		t.Fatal("expected the revocation fetched after the error in the store")
+	}
+	if err := feed.Check(); err != nil {
+		t.Errorf("expected the check to succeed after fetching again but got %v", err)
+	}
+	feed.Close()
+	time.Sleep(10 * time.Millisecond)
+}
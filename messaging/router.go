@@ -0,0 +1,185 @@
+package messaging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/microdevs/missy/log"
+)
+
+// Constructor is a piece of message middleware, it wraps a ReadMessageFunc like service.Constructor wraps a http.Handler
+type Constructor func(ReadMessageFunc) ReadMessageFunc
+
+// Predicate decides if a message matches a route
+type Predicate func(m Message) bool
+
+// HeaderEquals matches messages with the given header value
+func HeaderEquals(key string, value string) Predicate {
+	return func(m Message) bool {
+		v, ok := m.Header(key)
+		return ok && string(v) == value
+	}
+}
+
+// KeyPrefix matches messages whose key starts with prefix
+func KeyPrefix(prefix string) Predicate {
+	return func(m Message) bool {
+		return bytes.HasPrefix(m.Key, []byte(prefix))
+	}
+}
+
+// JSONField matches messages with a JSON value whose field at the dotted path, e.g. order.status, matches. Numbers are
+// passed to match as json.Number. Messages which are no JSON objects or do not have the field do not match.
+func JSONField(path string, match func(value interface{}) bool) Predicate {
+	fields := strings.Split(path, ".")
+	return func(m Message) bool {
+		var value interface{}
+		d := json.NewDecoder(bytes.NewReader(m.Value))
+		d.UseNumber()
+		if err := d.Decode(&value); err != nil {
+			return false
+		}
+		for _, field := range fields {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if value, ok = object[field]; !ok {
+				return false
+			}
+		}
+		return match(value)
+	}
+}
+
+// JSONFieldEquals matches messages with a JSON value whose field at the dotted path has the given value, numbers and
+// booleans are compared in their JSON text form, e.g. "42" or "true"
+func JSONFieldEquals(path string, value string) Predicate {
+	return JSONField(path, func(v interface{}) bool {
+		switch v := v.(type) {
+		case string:
+			return v == value
+		case json.Number:
+			return v.String() == value
+		default:
+			return fmt.Sprint(v) == value
+		}
+	})
+}
+
+// Route is a handler with the predicates a message has to match and the middleware of the handler, routes are created
+// with Router.Handle and can be changed while the router dispatches messages
+type Route struct {
+	router      *Router
+	handler     ReadMessageFunc
+	predicates  []Predicate
+	middlewares []Constructor
+}
+
+// Match adds a predicate to the route
+func (r *Route) Match(p Predicate) *Route {
+	r.router.mu.Lock()
+	r.predicates = append(r.predicates, p)
+	r.router.mu.Unlock()
+	return r
+}
+
+// Header requires a header value
+func (r *Route) Header(key string, value string) *Route {
+	return r.Match(HeaderEquals(key, value))
+}
+
+// KeyPrefix requires a key prefix
+func (r *Route) KeyPrefix(prefix string) *Route {
+	return r.Match(KeyPrefix(prefix))
+}
+
+// JSONField requires the JSON field at the dotted path to have the given value
+func (r *Route) JSONField(path string, value string) *Route {
+	return r.Match(JSONFieldEquals(path, value))
+}
+
+// Use adds middleware which only wraps the handler of the route
+func (r *Route) Use(constructors ...Constructor) *Route {
+	r.router.mu.Lock()
+	r.middlewares = append(r.middlewares, constructors...)
+	r.router.mu.Unlock()
+	return r
+}
+
+// matches checks all predicates of the route, the caller holds the lock of the router
+func (r *Route) matches(m Message) bool {
+	for _, p := range r.predicates {
+		if !p(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Router dispatches messages to the handler of the first matching route, similar to mux.Router for HTTP requests.
+// Its Dispatch method is a ReadMessageFunc, e.g.
+//
+//	router := messaging.NewRouter()
+//	router.Handle(orderCreated).Header("type", "order.created")
+//	router.Handle(orderCancelled).Header("type", "order.cancelled").Use(logMessages)
+//	reader.Read(router.Dispatch)
+type Router struct {
+	routes      []*Route
+	fallback    ReadMessageFunc
+	middlewares []Constructor
+	mu          sync.RWMutex
+}
+
+// NewRouter returns a router without routes
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle adds a route for the handler, messages are matched against the routes in the order they were added
+func (rt *Router) Handle(handler ReadMessageFunc) *Route {
+	route := &Route{router: rt, handler: handler}
+	rt.mu.Lock()
+	rt.routes = append(rt.routes, route)
+	rt.mu.Unlock()
+	return route
+}
+
+// Default sets the handler of messages which match no route, without it such messages are committed and skipped
+func (rt *Router) Default(handler ReadMessageFunc) {
+	rt.mu.Lock()
+	rt.fallback = handler
+	rt.mu.Unlock()
+}
+
+// Use adds middleware which wraps all handlers including the default handler
+func (rt *Router) Use(constructors ...Constructor) {
+	rt.mu.Lock()
+	rt.middlewares = append(rt.middlewares, constructors...)
+	rt.mu.Unlock()
+}
+
+// Dispatch calls the handler of the first route matching the message
+func (rt *Router) Dispatch(m Message) error {
+	rt.mu.RLock()
+	handler := rt.fallback
+	var middlewares []Constructor
+	for _, route := range rt.routes {
+		if route.matches(m) {
+			handler = route.handler
+			middlewares = route.middlewares
+			break
+		}
+	}
+	middlewares = append(append([]Constructor(nil), rt.middlewares...), middlewares...)
+	rt.mu.RUnlock()
+
+	if handler == nil {
+		log.Debugf("# messaging # no route matches message at offset %d of partition %d, skipping it", m.Offset, m.Partition)
+		return nil
+	}
+	return NewChain(middlewares...).Then(handler)(m)
+}
@@ -0,0 +1,86 @@
+package messaging
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRouter_Dispatch(t *testing.T) {
+	var calls []string
+	handler := func(name string) ReadMessageFunc {
+		return func(m Message) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	middleware := func(name string) Constructor {
+		return func(next ReadMessageFunc) ReadMessageFunc {
+			return func(m Message) error {
+				calls = append(calls, name)
+				return next(m)
+			}
+		}
+	}
+
+	router := NewRouter()
+	router.Use(middleware("logging"))
+	router.Handle(handler("created")).Header("type", "order.created")
+	router.Handle(handler("vip")).KeyPrefix("vip-").Use(middleware("metrics"), middleware("recovery"))
+	router.Handle(handler("shipped")).JSONField("order.status", "shipped")
+	router.Handle(handler("large")).JSONField("order.total", "1000")
+	router.Handle(handler("customer")).JSONField("order.customer", "12345678")
+
+	tests := []struct {
+		msg      Message
+		expected []string
+	}{
+		{Message{Headers: []Header{{Key: "type", Value: []byte("order.created")}}, Key: []byte("vip-1")}, []string{"logging", "created"}},
+		{Message{Key: []byte("vip-1")}, []string{"logging", "metrics", "recovery", "vip"}},
+		{Message{Value: []byte(`{"order":{"status":"shipped"}}`)}, []string{"logging", "shipped"}},
+		{Message{Value: []byte(`{"order":{"total":1000}}`)}, []string{"logging", "large"}},
+		{Message{Value: []byte(`{"order":{"customer":12345678}}`)}, []string{"logging", "customer"}},
+		{Message{Value: []byte(`{"order":"shipped"}`)}, nil},
+		{Message{Value: []byte("no json")}, nil},
+	}
+	for i, test := range tests {
+		calls = nil
+		if err := router.Dispatch(test.msg); err != nil {
+			t.Errorf("Unexpected error in test %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(calls, test.expected) {
+			t.Errorf("Expected calls %v in test %d, got %v", test.expected, i, calls)
+		}
+	}
+}
+
+func TestRouter_Default(t *testing.T) {
+	router := NewRouter()
+	router.Handle(func(m Message) error { return nil }).Header("type", "order.created")
+	router.Default(func(m Message) error {
+		return errors.New("unknown message type")
+	})
+
+	if err := router.Dispatch(Message{}); err == nil || err.Error() != "unknown message type" {
+		t.Errorf("Expected the error of the default handler, got %v", err)
+	}
+}
+
+func TestRouter_ChangeRoutesWhileDispatching(t *testing.T) {
+	router := NewRouter()
+	route := router.Handle(func(m Message) error { return nil })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			route.KeyPrefix("vip-").Use(Recover)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := router.Dispatch(Message{Key: []byte("vip-1")}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	<-done
+}
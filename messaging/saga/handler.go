@@ -0,0 +1,45 @@
+package saga
+
+import (
+	"net/http"
+
+	"github.com/microdevs/missy/data"
+	"github.com/microdevs/missy/log"
+	"github.com/microdevs/missy/service"
+)
+
+// RegisterHandlers exposes the instances of the saga on the metrics port of the service next to /info and /health,
+// /sagas/<name> lists all instances and /sagas/<name>/<id> returns a single instance
+func (o *Orchestrator) RegisterHandlers(s *service.Service) {
+	s.MetricsRouter.HandleFunc("/sagas/"+o.name, o.instancesHandler).Methods(http.MethodGet)
+	s.MetricsRouter.HandleFunc("/sagas/"+o.name+"/{id}", o.instanceHandler).Methods(http.MethodGet)
+}
+
+// instancesHandler returns all instances of the saga
+func (o *Orchestrator) instancesHandler(w http.ResponseWriter, r *http.Request) {
+	instances, err := o.Instances(r.Context())
+	if err != nil {
+		log.Errorf("# saga # cannot list instances of %s: %v", o.name, err)
+		http.Error(w, "cannot list saga instances", http.StatusInternalServerError)
+		return
+	}
+	if instances == nil {
+		instances = []Instance{}
+	}
+	data.Marshal(w, r, instances)
+}
+
+// instanceHandler returns the instance with the id in the path
+func (o *Orchestrator) instanceHandler(w http.ResponseWriter, r *http.Request) {
+	inst, err := o.Instance(r.Context(), service.Vars(r)["id"])
+	if err == ErrNotFound {
+		http.Error(w, "saga instance not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("# saga # cannot load instance of %s: %v", o.name, err)
+		http.Error(w, "cannot load saga instance", http.StatusInternalServerError)
+		return
+	}
+	data.Marshal(w, r, inst)
+}
@@ -0,0 +1,411 @@
+// Package saga coordinates workflows across services, e.g. order -> payment -> shipping. An Orchestrator publishes
+// the command of each step with a messaging.Writer and waits for the reply of the participant on its reply topic.
+// When a step fails or times out, the compensations of the completed steps are published in reverse order.
+//
+// Participants answer commands with messaging.Responder, the correlation-id and reply-to headers of the command relate
+// the reply to the saga instance.
+package saga
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microdevs/missy/log"
+	"github.com/microdevs/missy/messaging"
+)
+
+// Status is the state of a saga instance
+type Status string
+
+// states of a saga instance
+const (
+	// Running instances wait for the reply to the command of the current step
+	Running Status = "running"
+	// Completed instances finished all steps
+	Completed Status = "completed"
+	// Compensating instances wait for the reply to the compensation of the current step
+	Compensating Status = "compensating"
+	// Compensated instances undid all completed steps after a step failed
+	Compensated Status = "compensated"
+	// Failed instances could not be compensated and need manual intervention
+	Failed Status = "failed"
+)
+
+// phases of a step, part of the correlation id
+const (
+	phaseAction       = "action"
+	phaseCompensation = "compensation"
+)
+
+// SagaHeader holds the saga name and instance id of commands and compensations
+const SagaHeader = "saga-id"
+
+// Instance is the persisted state of a single run of a saga
+type Instance struct {
+	ID        string    `json:"id"`
+	Saga      string    `json:"saga"`
+	Status    Status    `json:"status"`
+	Step      int       `json:"step"`
+	StepName  string    `json:"stepName"`
+	Data      []byte    `json:"data"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Deadline is the time the reply of the current step has to arrive at, zero without timeout
+	Deadline time.Time `json:"deadline,omitempty"`
+	// Version is increased by every save, see Store
+	Version int64 `json:"version"`
+}
+
+// Done checks if the instance is not waiting for a reply anymore
+func (i Instance) Done() bool {
+	return i.Status == Completed || i.Status == Compensated || i.Status == Failed
+}
+
+// Step is a step of a saga
+type Step struct {
+	Name string
+	// Action returns the command which is published to start the step
+	Action func(inst Instance) (messaging.Message, error)
+	// Compensation returns the command which undoes the step after a later step failed, nil if there is nothing to undo
+	Compensation func(inst Instance) (messaging.Message, error)
+	// OnReply is called with the successful reply to the action, it can update the data of the instance, e.g. to keep
+	// an id needed by the compensation
+	OnReply func(inst *Instance, reply messaging.Message) error
+	// Timeout is the time the reply to the action or compensation has to arrive in, zero waits forever
+	Timeout time.Duration
+}
+
+// Orchestrator runs the instances of a saga. Several instances of a service may run an orchestrator of the same saga
+// with a shared store, every change of an instance is saved with the version it was loaded with before its command is
+// published. A reply or timeout which lost the race against another orchestrator is dropped.
+type Orchestrator struct {
+	name       string
+	steps      []Step
+	writer     messaging.Writer
+	store      Store
+	replyTopic string
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New returns an orchestrator of the saga with the given name and steps. Commands are published with writer, the
+// replies of the participants have to be read from replyTopic and passed to HandleReply, e.g.
+//
+//	reader.Read(orchestrator.HandleReply)
+//
+// The name is part of the correlation id of commands, New panics if it contains a slash.
+func New(name string, writer messaging.Writer, store Store, replyTopic string, steps ...Step) *Orchestrator {
+	if strings.Contains(name, "/") {
+		panic(fmt.Sprintf("saga: name %q must not contain a slash", name))
+	}
+	return &Orchestrator{
+		name:       name,
+		steps:      steps,
+		writer:     writer,
+		store:      store,
+		replyTopic: replyTopic,
+		done:       make(chan struct{}),
+	}
+}
+
+// Start starts a new instance of the saga with the given data and publishes the command of the first step
+func (o *Orchestrator) Start(ctx context.Context, data []byte) (Instance, error) {
+	id, err := newID()
+	if err != nil {
+		return Instance{}, err
+	}
+	now := time.Now().UTC()
+	inst := Instance{ID: id, Saga: o.name, Status: Running, Data: data, StartedAt: now, UpdatedAt: now}
+
+	if len(o.steps) == 0 {
+		inst.Status = Completed
+		err = o.save(ctx, &inst)
+		return inst, err
+	}
+	err = o.action(ctx, &inst, 0)
+	return inst, err
+}
+
+// Instance returns the state of an instance of the saga
+func (o *Orchestrator) Instance(ctx context.Context, id string) (Instance, error) {
+	inst, err := o.store.Load(ctx, id)
+	if err != nil {
+		return Instance{}, err
+	}
+	if inst.Saga != o.name {
+		return Instance{}, ErrNotFound
+	}
+	return inst, nil
+}
+
+// Instances returns all instances of the saga
+func (o *Orchestrator) Instances(ctx context.Context) ([]Instance, error) {
+	all, err := o.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var instances []Instance
+	for _, inst := range all {
+		if inst.Saga == o.name {
+			instances = append(instances, inst)
+		}
+	}
+	return instances, nil
+}
+
+// HandleReply advances the instance a reply belongs to, it is a messaging.ReadMessageFunc for the reply topic.
+// Replies of other sagas and late replies of steps which timed out are ignored.
+func (o *Orchestrator) HandleReply(reply messaging.Message) error {
+	correlationID, ok := reply.Header(messaging.CorrelationIDHeader)
+	if !ok {
+		return nil
+	}
+	saga, id, step, phase, ok := parseCorrelationID(string(correlationID))
+	if !ok || saga != o.name || step >= len(o.steps) {
+		return nil
+	}
+
+	ctx := context.Background()
+	inst, err := o.store.Load(ctx, id)
+	if err == ErrNotFound {
+		log.Warnf("# saga # dropping reply for unknown instance %s of %s", id, o.name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if inst.Step != step || (phase == phaseAction && inst.Status != Running) ||
+		(phase == phaseCompensation && inst.Status != Compensating) {
+		log.Debugf("# saga # dropping stale reply %s of instance %s", correlationID, id)
+		return nil
+	}
+
+	return dropConflict(o.handleReply(ctx, &inst, reply, step, phase), inst.ID)
+}
+
+// handleReply advances the instance with the reply to its current step
+func (o *Orchestrator) handleReply(ctx context.Context, inst *Instance, reply messaging.Message, step int, phase string) error {
+	var replyErr error
+	if cause, failed := reply.Header(messaging.ReplyErrorHeader); failed {
+		replyErr = fmt.Errorf("step %s failed: %s", o.steps[step].Name, cause)
+	}
+
+	if phase == phaseCompensation {
+		if replyErr != nil {
+			return o.fail(ctx, inst, fmt.Errorf("compensation of %v", replyErr))
+		}
+		return o.compensate(ctx, inst, step-1)
+	}
+
+	if replyErr == nil && o.steps[step].OnReply != nil {
+		replyErr = o.steps[step].OnReply(inst, reply)
+	}
+	if replyErr != nil {
+		inst.Error = replyErr.Error()
+		return o.compensate(ctx, inst, step-1)
+	}
+	if step+1 == len(o.steps) {
+		inst.Status = Completed
+		inst.Deadline = time.Time{}
+		return o.save(ctx, inst)
+	}
+	return o.action(ctx, inst, step+1)
+}
+
+// CheckTimeouts compensates running instances whose current step did not reply in time, instances which did not
+// receive the reply of a compensation in time fail
+func (o *Orchestrator) CheckTimeouts(ctx context.Context) error {
+	instances, err := o.Instances(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, candidate := range instances {
+		if candidate.Done() || candidate.Deadline.IsZero() || now.Before(candidate.Deadline) {
+			continue
+		}
+		// reload, a reply might have arrived meanwhile
+		inst, err := o.store.Load(ctx, candidate.ID)
+		if err != nil {
+			return err
+		}
+		if inst.Done() || inst.Deadline.IsZero() || now.Before(inst.Deadline) {
+			continue
+		}
+
+		timeout := fmt.Errorf("step %s timed out", o.steps[inst.Step].Name)
+		if inst.Status == Compensating {
+			err = o.fail(ctx, &inst, fmt.Errorf("compensation of %v", timeout))
+		} else {
+			inst.Error = timeout.Error()
+			err = o.compensate(ctx, &inst, inst.Step-1)
+		}
+		if err := dropConflict(err, inst.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropConflict ignores ErrConflict, the instance was advanced by another orchestrator meanwhile
+func dropConflict(err error, id string) error {
+	if err == ErrConflict {
+		log.Debugf("# saga # instance %s was changed concurrently, dropping the change", id)
+		return nil
+	}
+	return err
+}
+
+// WatchTimeouts checks for timed out instances in the given interval until the orchestrator is closed
+func (o *Orchestrator) WatchTimeouts(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := o.CheckTimeouts(context.Background()); err != nil {
+					log.Errorf("# saga # checking timeouts of %s failed: %v", o.name, err)
+				}
+			case <-o.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops watching timeouts, the writer and the reader of the replies have to be closed by the caller
+func (o *Orchestrator) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.done)
+	})
+	return nil
+}
+
+// action publishes the command of a step and saves the instance waiting for its reply
+func (o *Orchestrator) action(ctx context.Context, inst *Instance, step int) error {
+	inst.Status = Running
+	inst.Step = step
+	inst.StepName = o.steps[step].Name
+	inst.Deadline = o.deadline(step)
+	if err := o.save(ctx, inst); err != nil {
+		return err
+	}
+
+	cmd, err := o.steps[step].Action(*inst)
+	if err == nil {
+		err = o.publish(ctx, cmd, inst, step, phaseAction)
+	}
+	if err != nil {
+		inst.Error = fmt.Sprintf("step %s failed: %v", inst.StepName, err)
+		return o.compensate(ctx, inst, step-1)
+	}
+	return nil
+}
+
+// compensate publishes the compensation of the latest completed step with a compensation at or before step, the
+// instance is compensated if there is none left
+func (o *Orchestrator) compensate(ctx context.Context, inst *Instance, step int) error {
+	for step >= 0 && o.steps[step].Compensation == nil {
+		step--
+	}
+	if step < 0 {
+		inst.Status = Compensated
+		inst.Deadline = time.Time{}
+		log.Infof("# saga # instance %s of %s compensated: %s", inst.ID, o.name, inst.Error)
+		return o.save(ctx, inst)
+	}
+
+	inst.Status = Compensating
+	inst.Step = step
+	inst.StepName = o.steps[step].Name
+	inst.Deadline = o.deadline(step)
+	if err := o.save(ctx, inst); err != nil {
+		return err
+	}
+
+	cmd, err := o.steps[step].Compensation(*inst)
+	if err == nil {
+		err = o.publish(ctx, cmd, inst, step, phaseCompensation)
+	}
+	if err != nil {
+		return o.fail(ctx, inst, fmt.Errorf("compensation of step %s failed: %v", inst.StepName, err))
+	}
+	return nil
+}
+
+// fail marks the instance as failed, it needs manual intervention
+func (o *Orchestrator) fail(ctx context.Context, inst *Instance, err error) error {
+	log.Errorf("# saga # instance %s of %s failed: %v", inst.ID, o.name, err)
+	inst.Status = Failed
+	inst.Deadline = time.Time{}
+	if inst.Error != "" {
+		inst.Error += "; "
+	}
+	inst.Error += err.Error()
+	return o.save(ctx, inst)
+}
+
+// publish writes the command of a step with the headers relating the reply to the instance
+func (o *Orchestrator) publish(ctx context.Context, cmd messaging.Message, inst *Instance, step int, phase string) error {
+	cmd.Headers = append([]messaging.Header(nil), cmd.Headers...)
+	cmd.SetHeader(SagaHeader, []byte(o.name+"/"+inst.ID))
+	cmd.SetHeader(messaging.CorrelationIDHeader, []byte(correlationID(o.name, inst.ID, step, phase)))
+	cmd.SetHeader(messaging.ReplyToHeader, []byte(o.replyTopic))
+	return o.writer.WriteContext(ctx, cmd)
+}
+
+// save stores the instance with the current time and increases its version, ErrConflict is returned if it was
+// changed since it was loaded
+func (o *Orchestrator) save(ctx context.Context, inst *Instance) error {
+	inst.UpdatedAt = time.Now().UTC()
+	if err := o.store.Save(ctx, *inst); err != nil {
+		return err
+	}
+	inst.Version++
+	return nil
+}
+
+// deadline returns the time the reply of a step has to arrive at
+func (o *Orchestrator) deadline(step int) time.Time {
+	if o.steps[step].Timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(o.steps[step].Timeout).UTC()
+}
+
+// correlationID relates the reply of a participant to the step of an instance, e.g. orders/1a2b/0/action
+func correlationID(saga string, id string, step int, phase string) string {
+	return strings.Join([]string{saga, id, strconv.Itoa(step), phase}, "/")
+}
+
+// parseCorrelationID splits a correlation id created by correlationID
+func parseCorrelationID(s string) (saga string, id string, step int, phase string, ok bool) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 4 {
+		return "", "", 0, "", false
+	}
+	step, err := strconv.Atoi(parts[2])
+	if err != nil || (parts[3] != phaseAction && parts[3] != phaseCompensation) {
+		return "", "", 0, "", false
+	}
+	return parts[0], parts[1], step, parts[3], true
+}
+
+// newID returns a random instance id
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot create saga id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,304 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/microdevs/missy/messaging"
+	"github.com/microdevs/missy/service"
+)
+
+// queueWriter collects written messages, so tests deliver them one by one
+type queueWriter struct {
+	queue []messaging.Message
+}
+
+func (w *queueWriter) Write(key, value []byte) error {
+	return w.WriteContext(context.Background(), messaging.Message{Key: key, Value: value})
+}
+
+func (w *queueWriter) WriteContext(ctx context.Context, msgs ...messaging.Message) error {
+	w.queue = append(w.queue, msgs...)
+	return nil
+}
+
+func (w *queueWriter) Close() error {
+	return nil
+}
+
+func (w *queueWriter) next(t *testing.T) messaging.Message {
+	if len(w.queue) == 0 {
+		t.Fatal("Expected a message to be written")
+	}
+	m := w.queue[0]
+	w.queue = w.queue[1:]
+	return m
+}
+
+// command returns a step function publishing a command to the given topic
+func command(topic string) func(inst Instance) (messaging.Message, error) {
+	return func(inst Instance) (messaging.Message, error) {
+		return messaging.Message{Topic: topic, Key: []byte(inst.ID), Value: inst.Data}, nil
+	}
+}
+
+func orderSaga(writer messaging.Writer, store Store) *Orchestrator {
+	return New("order", writer, store, "order.replies",
+		Step{Name: "payment", Action: command("payments"), Compensation: command("refunds"),
+			OnReply: func(inst *Instance, reply messaging.Message) error {
+				inst.Data = append(inst.Data, reply.Value...)
+				return nil
+			}},
+		Step{Name: "stock", Action: command("stock")},
+		Step{Name: "shipping", Action: command("shipping"), Timeout: time.Millisecond},
+	)
+}
+
+// reply answers a command like a participant using messaging.Responder
+func reply(t *testing.T, o *Orchestrator, cmd messaging.Message, err error) {
+	replies := &queueWriter{}
+	responder := messaging.Responder(replies, func(request messaging.Message) (messaging.Message, error) {
+		return messaging.Message{Value: []byte("+" + request.Topic)}, err
+	})
+	if rerr := responder(cmd); rerr != nil {
+		t.Fatalf("Unexpected responder error: %v", rerr)
+	}
+	r := replies.next(t)
+	if r.Topic != "order.replies" {
+		t.Errorf("Expected reply to be sent to order.replies, got %s", r.Topic)
+	}
+	if herr := o.HandleReply(r); herr != nil {
+		t.Fatalf("Unexpected error handling reply: %v", herr)
+	}
+}
+
+func load(t *testing.T, o *Orchestrator, id string) Instance {
+	inst, err := o.Instance(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Unexpected error loading instance: %v", err)
+	}
+	return inst
+}
+
+func TestOrchestrator_Completes(t *testing.T) {
+	writer := &queueWriter{}
+	o := orderSaga(writer, NewMemoryStore())
+
+	inst, err := o.Start(context.Background(), []byte("order-1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, topic := range []string{"payments", "stock", "shipping"} {
+		cmd := writer.next(t)
+		if cmd.Topic != topic {
+			t.Fatalf("Expected command for %s, got %s", topic, cmd.Topic)
+		}
+		if sagaID, _ := cmd.Header(SagaHeader); string(sagaID) != "order/"+inst.ID {
+			t.Errorf("Expected saga header order/%s, got %s", inst.ID, sagaID)
+		}
+		reply(t, o, cmd, nil)
+	}
+
+	inst = load(t, o, inst.ID)
+	if inst.Status != Completed {
+		t.Errorf("Expected instance to be completed, got %s (%s)", inst.Status, inst.Error)
+	}
+	if string(inst.Data) != "order-1+payments" {
+		t.Errorf("Expected data to be updated by the reply, got %s", inst.Data)
+	}
+	if len(writer.queue) != 0 {
+		t.Errorf("Expected no more commands, got %v", writer.queue)
+	}
+}
+
+func TestOrchestrator_Compensates(t *testing.T) {
+	writer := &queueWriter{}
+	o := orderSaga(writer, NewMemoryStore())
+	inst, _ := o.Start(context.Background(), []byte("order-1"))
+
+	payment := writer.next(t)
+	reply(t, o, payment, nil)
+	reply(t, o, writer.next(t), errors.New("out of stock"))
+
+	refund := writer.next(t)
+	if refund.Topic != "refunds" {
+		t.Fatalf("Expected the payment to be refunded, got %s", refund.Topic)
+	}
+	if status := load(t, o, inst.ID).Status; status != Compensating {
+		t.Errorf("Expected instance to be compensating, got %s", status)
+	}
+
+	// a duplicate reply of the payment is ignored
+	reply(t, o, payment, nil)
+	reply(t, o, refund, nil)
+
+	inst = load(t, o, inst.ID)
+	if inst.Status != Compensated || inst.Error != "step stock failed: out of stock" {
+		t.Errorf("Expected instance to be compensated after the stock failure, got %s (%s)", inst.Status, inst.Error)
+	}
+}
+
+func TestOrchestrator_CompensationFails(t *testing.T) {
+	writer := &queueWriter{}
+	o := orderSaga(writer, NewMemoryStore())
+	inst, _ := o.Start(context.Background(), nil)
+
+	reply(t, o, writer.next(t), nil)
+	reply(t, o, writer.next(t), errors.New("out of stock"))
+	reply(t, o, writer.next(t), errors.New("account closed"))
+
+	inst = load(t, o, inst.ID)
+	expected := "step stock failed: out of stock; compensation of step payment failed: account closed"
+	if inst.Status != Failed || inst.Error != expected {
+		t.Errorf("Expected instance to fail with %q, got %s (%s)", expected, inst.Status, inst.Error)
+	}
+}
+
+func TestOrchestrator_Timeout(t *testing.T) {
+	writer := &queueWriter{}
+	o := orderSaga(writer, NewMemoryStore())
+	inst, _ := o.Start(context.Background(), nil)
+
+	reply(t, o, writer.next(t), nil)
+	reply(t, o, writer.next(t), nil)
+	shipping := writer.next(t)
+	time.Sleep(time.Millisecond * 5)
+
+	if err := o.CheckTimeouts(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if refund := writer.next(t); refund.Topic != "refunds" {
+		t.Errorf("Expected the payment to be refunded, got %s", refund.Topic)
+	}
+	inst = load(t, o, inst.ID)
+	if inst.Status != Compensating || inst.Error != "step shipping timed out" {
+		t.Errorf("Expected instance to be compensated after the timeout, got %s (%s)", inst.Status, inst.Error)
+	}
+
+	// the late reply of the shipping is ignored
+	reply(t, o, shipping, nil)
+	if status := load(t, o, inst.ID).Status; status != Compensating {
+		t.Errorf("Expected late reply to be ignored, got %s", status)
+	}
+}
+
+func TestParseCorrelationID(t *testing.T) {
+	saga, id, step, phase, ok := parseCorrelationID(correlationID("order", "1a2b", 2, phaseCompensation))
+	if !ok || saga != "order" || id != "1a2b" || step != 2 || phase != phaseCompensation {
+		t.Errorf("Unexpected result %s %s %d %s %v", saga, id, step, phase, ok)
+	}
+	for _, invalid := range []string{"", "order/1a2b/x/action", "order/1a2b/1/other", "a/b/c"} {
+		if _, _, _, _, ok := parseCorrelationID(invalid); ok {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestNew_NameWithSlash(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("New should panic for a name with a slash")
+		}
+	}()
+	New("order/v2", &queueWriter{}, NewMemoryStore(), "order.replies")
+}
+
+func TestOrchestrator_Handlers(t *testing.T) {
+	writer := &queueWriter{}
+	o := orderSaga(writer, NewMemoryStore())
+	inst, _ := o.Start(context.Background(), nil)
+
+	s := &service.Service{MetricsRouter: mux.NewRouter()}
+	o.RegisterHandlers(s)
+
+	rec := httptest.NewRecorder()
+	s.MetricsRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sagas/order/"+inst.ID, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	var got Instance
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Unexpected error decoding instance: %v", err)
+	}
+	if got.ID != inst.ID || got.Status != Running || got.StepName != "payment" {
+		t.Errorf("Unexpected instance %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	s.MetricsRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sagas/order", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), inst.ID) {
+		t.Errorf("Expected the instance to be listed, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.MetricsRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sagas/order/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown instance, got %d", rec.Code)
+	}
+}
+
+func TestMemoryStore_Conflict(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	inst := Instance{ID: "1", Saga: "order"}
+	if err := s.Save(ctx, inst); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.Save(ctx, inst); err != ErrConflict {
+		t.Errorf("Expected a conflict saving a new instance twice, got %v", err)
+	}
+	stored, _ := s.Load(ctx, "1")
+	if stored.Version != 1 {
+		t.Errorf("Expected version 1, got %d", stored.Version)
+	}
+	if err := s.Save(ctx, stored); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.Save(ctx, stored); err != ErrConflict {
+		t.Errorf("Expected a conflict saving an outdated version, got %v", err)
+	}
+}
+
+// staleStore loads the instances as they were before another orchestrator advanced them
+type staleStore struct {
+	Store
+	snapshot Instance
+}
+
+func (s *staleStore) Load(ctx context.Context, id string) (Instance, error) {
+	return s.snapshot, nil
+}
+
+func TestOrchestrator_ConcurrentReplies(t *testing.T) {
+	store := NewMemoryStore()
+	writer := &queueWriter{}
+	o := orderSaga(writer, store)
+	inst, _ := o.Start(context.Background(), []byte("order-1"))
+	payment := writer.next(t)
+
+	otherWriter := &queueWriter{}
+	other := orderSaga(otherWriter, &staleStore{Store: store, snapshot: load(t, o, inst.ID)})
+
+	reply(t, o, payment, nil)
+	// the other orchestrator loaded the instance before the reply was handled
+	reply(t, other, payment, nil)
+
+	if len(otherWriter.queue) != 0 {
+		t.Errorf("Expected the other orchestrator not to publish a command, got %v", otherWriter.queue)
+	}
+	if cmd := writer.next(t); cmd.Topic != "stock" {
+		t.Errorf("Expected command for stock, got %s", cmd.Topic)
+	}
+	inst = load(t, o, inst.ID)
+	if inst.Step != 1 || string(inst.Data) != "order-1+payments" {
+		t.Errorf("Expected the instance to be advanced once, got step %d with data %s", inst.Step, inst.Data)
+	}
+}
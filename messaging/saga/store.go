@@ -0,0 +1,75 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound is returned when a saga instance does not exist
+var ErrNotFound = errors.New("saga instance not found")
+
+// ErrConflict is returned when an instance was changed since it was loaded, e.g. by another instance of the service
+var ErrConflict = errors.New("saga instance was changed concurrently")
+
+// Store persists the state of saga instances, e.g. in a database shared by all instances of the service
+type Store interface {
+	// Save stores the instance if the stored instance still has the version inst.Version, the stored instance gets
+	// the version inst.Version+1. New instances have version 0. ErrConflict is returned if the versions differ, so
+	// only one orchestrator advances an instance, e.g. with UPDATE ... WHERE id = ? AND version = ?.
+	Save(ctx context.Context, inst Instance) error
+	// Load returns ErrNotFound if there is no instance with the id
+	Load(ctx context.Context, id string) (Instance, error)
+	List(ctx context.Context) ([]Instance, error)
+}
+
+// MemoryStore keeps saga instances in memory, the state is lost when the service stops
+type MemoryStore struct {
+	instances map[string]Instance
+	mu        sync.RWMutex
+}
+
+// NewMemoryStore returns an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{instances: make(map[string]Instance)}
+}
+
+// Save stores a copy of the instance if its version matches the stored instance
+func (s *MemoryStore) Save(ctx context.Context, inst Instance) error {
+	inst.Data = append([]byte(nil), inst.Data...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.instances[inst.ID]
+	if (ok && stored.Version != inst.Version) || (!ok && inst.Version != 0) {
+		return ErrConflict
+	}
+	inst.Version++
+	s.instances[inst.ID] = inst
+	return nil
+}
+
+// Load returns the instance with the given id
+func (s *MemoryStore) Load(ctx context.Context, id string) (Instance, error) {
+	s.mu.RLock()
+	inst, ok := s.instances[id]
+	s.mu.RUnlock()
+	if !ok {
+		return Instance{}, ErrNotFound
+	}
+	return inst, nil
+}
+
+// List returns all instances sorted by their start
+func (s *MemoryStore) List(ctx context.Context) ([]Instance, error) {
+	s.mu.RLock()
+	instances := make([]Instance, 0, len(s.instances))
+	for _, inst := range s.instances {
+		instances = append(instances, inst)
+	}
+	s.mu.RUnlock()
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].StartedAt.Before(instances[j].StartedAt)
+	})
+	return instances, nil
+}
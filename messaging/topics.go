@@ -0,0 +1,216 @@
+package messaging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/microdevs/missy/log"
+	"github.com/microdevs/missy/service"
+)
+
+// topicAlias holds the internal config names of a logical topic registered with RegisterTopic
+type topicAlias struct {
+	topic       string
+	dlq         string
+	retryDelays string
+}
+
+var (
+	topicAliases   = make(map[string]topicAlias)
+	topicAliasesMu sync.RWMutex
+)
+
+// RegisterTopic declares a logical topic name in the service configuration. The actual topic name is read from the
+// environment variable KAFKA_TOPIC_<NAME> and defaults to defaultTopic, a dead letter queue topic can be enabled with
+// KAFKA_TOPIC_<NAME>_DLQ and retry topics with a comma separated list of delays in KAFKA_TOPIC_<NAME>_RETRY_DELAYS
+// (see NewReaderWithRetryTopics). Readers with retry topics always use a dead letter queue, it defaults to <topic>.dlq. Call it from an init function, so the topic is part of the configuration reported to the
+// missy controller.
+func RegisterTopic(name string, defaultTopic string, usage string) {
+	envName := "KAFKA_TOPIC_" + envSuffix(name)
+	alias := topicAlias{
+		topic:       "kafka.topic." + name,
+		dlq:         "kafka.topic." + name + ".dlq",
+		retryDelays: "kafka.topic." + name + ".retry.delays",
+	}
+
+	cfg := service.Config()
+	cfg.RegisterOptionalParameter(envName, defaultTopic, alias.topic, usage)
+	cfg.RegisterOptionalParameter(envName+"_DLQ", "", alias.dlq, "The dead letter queue topic for "+name+", empty disables the dead letter queue unless retry delays are set, then it defaults to <topic>.dlq")
+	cfg.RegisterOptionalParameter(envName+"_RETRY_DELAYS", "", alias.retryDelays, "Comma separated delays of the retry topics for "+name+", e.g. 1m,10m, empty retries in place")
+	cfg.Parse()
+
+	topicAliasesMu.Lock()
+	topicAliases[name] = alias
+	topicAliasesMu.Unlock()
+}
+
+// NewReaderFromConfig returns a reader for a topic registered with RegisterTopic using the configured brokers
+// and consumer group. You need to close it after use. (Close())
+func NewReaderFromConfig(name string) (*KafkaReader, error) {
+	topic, dlqTopic, err := lookupTopic(name)
+	if err != nil {
+		return nil, err
+	}
+	brokers, err := ConfiguredBrokers()
+	if err != nil {
+		return nil, err
+	}
+	groupID := configuredGroupID()
+	if groupID == "" {
+		return nil, fmt.Errorf("no consumer group id configured for topic %s, set KAFKA_GROUP_ID or create the service first", name)
+	}
+
+	delays, err := lookupRetryDelays(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(delays) > 0 {
+		return NewReaderWithRetryTopics(brokers, groupID, topic, dlqTopic, delays...), nil
+	}
+	if dlqTopic != "" {
+		return NewReaderWithDLQ(brokers, groupID, topic, dlqTopic), nil
+	}
+	return NewReader(brokers, groupID, topic), nil
+}
+
+// NewWriterFromConfig returns a writer for a topic registered with RegisterTopic using the configured brokers.
+// You need to close it after use. (Close())
+func NewWriterFromConfig(name string) (Writer, error) {
+	topic, _, err := lookupTopic(name)
+	if err != nil {
+		return nil, err
+	}
+	brokers, err := ConfiguredBrokers()
+	if err != nil {
+		return nil, err
+	}
+	return NewWriter(brokers, topic), nil
+}
+
+// ReaderFor is a shorthand for NewReaderFromConfig, it exits the program if the reader can not be created
+func ReaderFor(name string) *KafkaReader {
+	r, err := NewReaderFromConfig(name)
+	if err != nil {
+		log.Fatalf("Unable to create reader for %s: %v", name, err)
+	}
+	return r
+}
+
+// WriterFor is a shorthand for NewWriterFromConfig, it exits the program if the writer can not be created
+func WriterFor(name string) Writer {
+	w, err := NewWriterFromConfig(name)
+	if err != nil {
+		log.Fatalf("Unable to create writer for %s: %v", name, err)
+	}
+	return w
+}
+
+// RegisteredTopics returns the configured names of all topics registered with RegisterTopic including their dead
+// letter queue and retry topics
+func RegisteredTopics() ([]string, error) {
+	topicAliasesMu.RLock()
+	names := make([]string, 0, len(topicAliases))
+	for name := range topicAliases {
+		names = append(names, name)
+	}
+	topicAliasesMu.RUnlock()
+	sort.Strings(names)
+
+	var topics []string
+	for _, name := range names {
+		topic, dlqTopic, err := lookupTopic(name)
+		if err != nil {
+			return nil, err
+		}
+		delays, err := lookupRetryDelays(name)
+		if err != nil {
+			return nil, err
+		}
+
+		topics = append(topics, topic)
+		if dlqTopic == "" && len(delays) > 0 {
+			// readers with retry topics always use a dead letter queue
+			dlqTopic = topic + ".dlq"
+		}
+		if dlqTopic != "" {
+			topics = append(topics, dlqTopic)
+		}
+		for _, delay := range delays {
+			topics = append(topics, RetryTopic(topic, delay))
+		}
+	}
+	return topics, nil
+}
+
+// lookupTopic returns the configured topic and dead letter queue topic of a registered logical topic name
+func lookupTopic(name string) (topic string, dlqTopic string, err error) {
+	topicAliasesMu.RLock()
+	alias, ok := topicAliases[name]
+	topicAliasesMu.RUnlock()
+	if !ok {
+		return "", "", fmt.Errorf("topic %s was not registered, use messaging.RegisterTopic", name)
+	}
+
+	topic = service.Config().Get(alias.topic)
+	if topic == "" {
+		return "", "", fmt.Errorf("no topic configured for %s", name)
+	}
+	return topic, service.Config().Get(alias.dlq), nil
+}
+
+// lookupRetryDelays returns the configured retry topic delays of a registered logical topic name
+func lookupRetryDelays(name string) ([]time.Duration, error) {
+	topicAliasesMu.RLock()
+	alias := topicAliases[name]
+	topicAliasesMu.RUnlock()
+
+	var delays []time.Duration
+	for _, d := range strings.Split(service.Config().Get(alias.retryDelays), ",") {
+		if d = strings.TrimSpace(d); d == "" {
+			continue
+		}
+		delay, err := time.ParseDuration(d)
+		if err != nil || delay <= 0 {
+			return nil, fmt.Errorf("invalid retry delay %q for topic %s", d, name)
+		}
+		delays = append(delays, delay)
+	}
+	return delays, nil
+}
+
+// ConfiguredBrokers returns the broker addresses set in KAFKA_BROKERS
+func ConfiguredBrokers() ([]string, error) {
+	var brokers []string
+	for _, b := range strings.Split(service.Config().Get(kafkaBrokers), ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("no kafka brokers configured, set KAFKA_BROKERS")
+	}
+	return brokers, nil
+}
+
+// configuredGroupID returns the group id set in KAFKA_GROUP_ID and falls back to the service name
+func configuredGroupID() string {
+	if groupID := service.Config().Get(kafkaGroupID); groupID != "" {
+		return groupID
+	}
+	return service.Config().Name
+}
+
+// envSuffix converts a logical name to the environment variable notation, e.g. "order-events" to "ORDER_EVENTS"
+func envSuffix(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,145 @@
+package messaging
+
+import (
+	"os"
+	"testing"
+
+	"github.com/microdevs/missy/service"
+)
+
+func TestEnvSuffix(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"orders", "ORDERS"},
+		{"order-events", "ORDER_EVENTS"},
+		{"order.events.v2", "ORDER_EVENTS_V2"},
+	}
+	for _, test := range tests {
+		if result := envSuffix(test.name); result != test.expected {
+			t.Error(expected(result, test.expected))
+		}
+	}
+}
+
+func TestRegisterTopic(t *testing.T) {
+	os.Setenv("KAFKA_TOPIC_PAYMENTS_DLQ", "payments.failed")
+	defer os.Unsetenv("KAFKA_TOPIC_PAYMENTS_DLQ")
+
+	RegisterTopic("payments", "payments.v1", "The topic payments are published to")
+
+	topic, dlqTopic, err := lookupTopic("payments")
+	if err != nil {
+		t.Fatalf("unexpected error looking up registered topic: %v", err)
+	}
+	if topic != "payments.v1" {
+		t.Error(expected(topic, "payments.v1"))
+	}
+	if dlqTopic != "payments.failed" {
+		t.Error(expected(dlqTopic, "payments.failed"))
+	}
+}
+
+func TestNewReaderFromConfig_UnknownTopic(t *testing.T) {
+	if _, err := NewReaderFromConfig("unknown"); err == nil {
+		t.Error("error was expected for a topic which was not registered")
+	}
+	if _, err := NewWriterFromConfig("unknown"); err == nil {
+		t.Error("error was expected for a topic which was not registered")
+	}
+}
+
+func TestNewReaderFromConfig(t *testing.T) {
+	os.Setenv("KAFKA_BROKERS", "kafka-1:9092, kafka-2:9092")
+	os.Setenv("KAFKA_GROUP_ID", "orders-service")
+	service.Config().ParseEnvironment(true)
+	defer func() {
+		os.Unsetenv("KAFKA_BROKERS")
+		os.Unsetenv("KAFKA_GROUP_ID")
+		service.Config().ParseEnvironment(true)
+	}()
+
+	RegisterTopic("orders", "orders.v1", "The topic orders are published to")
+
+	r, err := NewReaderFromConfig("orders")
+	if err != nil {
+		t.Fatalf("unexpected error creating reader from config: %v", err)
+	}
+	defer r.Close()
+
+	if len(r.brokers) != 2 || r.brokers[0] != "kafka-1:9092" || r.brokers[1] != "kafka-2:9092" {
+		t.Errorf("expecting brokers to be [kafka-1:9092 kafka-2:9092] but was %v", r.brokers)
+	}
+	if r.groupID != "orders-service" {
+		t.Error(expected(r.groupID, "orders-service"))
+	}
+	if r.topic != "orders.v1" {
+		t.Error(expected(r.topic, "orders.v1"))
+	}
+	if r.dlqWriter != nil {
+		t.Error("no dead letter queue writer was expected")
+	}
+
+	w, err := NewWriterFromConfig("orders")
+	if err != nil {
+		t.Fatalf("unexpected error creating writer from config: %v", err)
+	}
+	defer w.Close()
+
+	if mw := w.(*missyWriter); mw.topic != "orders.v1" {
+		t.Error(expected(mw.topic, "orders.v1"))
+	}
+}
+
+func TestNewReaderFromConfig_RetryDelays(t *testing.T) {
+	os.Setenv("KAFKA_GROUP_ID", "refunds-service")
+	os.Setenv("KAFKA_TOPIC_REFUNDS_RETRY_DELAYS", "1m, 10m")
+	service.Config().ParseEnvironment(true)
+	defer func() {
+		os.Unsetenv("KAFKA_GROUP_ID")
+		os.Unsetenv("KAFKA_TOPIC_REFUNDS_RETRY_DELAYS")
+		service.Config().ParseEnvironment(true)
+	}()
+
+	RegisterTopic("refunds", "refunds.v1", "The topic refunds are published to")
+
+	r, err := NewReaderFromConfig("refunds")
+	if err != nil {
+		t.Fatalf("unexpected error creating reader from config: %v", err)
+	}
+	defer r.Close()
+
+	if len(r.retryTiers) != 2 || r.retryTiers[0].topic != "refunds.v1.retry.1m" || r.retryTiers[1].topic != "refunds.v1.retry.10m" {
+		t.Errorf("unexpected retry topics: %v", r.retryTiers)
+	}
+	if r.dlqWriter == nil {
+		t.Error("dead letter queue writer was expected")
+	}
+}
+
+func TestRegisteredTopics(t *testing.T) {
+	os.Setenv("KAFKA_TOPIC_INVOICES_RETRY_DELAYS", "1m")
+	service.Config().ParseEnvironment(true)
+	defer func() {
+		os.Unsetenv("KAFKA_TOPIC_INVOICES_RETRY_DELAYS")
+		service.Config().ParseEnvironment(true)
+	}()
+
+	RegisterTopic("invoices", "invoices.v1", "The topic invoices are published to")
+
+	topics, err := RegisteredTopics()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, topic := range topics {
+		found[topic] = true
+	}
+	for _, topic := range []string{"invoices.v1", "invoices.v1.dlq", "invoices.v1.retry.1m"} {
+		if !found[topic] {
+			t.Errorf("expecting %s in registered topics %v", topic, topics)
+		}
+	}
+}
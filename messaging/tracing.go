@@ -0,0 +1,128 @@
+package messaging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/microdevs/missy/log"
+)
+
+// TraceParentHeader holds the W3C trace context of a message, e.g. 00-<trace id>-<parent id>-01
+const TraceParentHeader = "traceparent"
+
+// TraceContext identifies a span of a trace following the W3C trace context format
+type TraceContext struct {
+	// TraceID is 32 lower case hex characters
+	TraceID string
+	// SpanID is 16 lower case hex characters
+	SpanID  string
+	Sampled bool
+}
+
+// String returns the trace context in the format of the traceparent header
+func (tc TraceContext) String() string {
+	flags := "00"
+	if tc.Sampled {
+		flags = "01"
+	}
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + flags
+}
+
+// Inject sets the traceparent header of the message, so its consumer continues the trace
+func (tc TraceContext) Inject(m *Message) {
+	m.SetHeader(TraceParentHeader, []byte(tc.String()))
+}
+
+// ParseTraceParent parses a traceparent header
+func ParseTraceParent(s string) (TraceContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return TraceContext{}, fmt.Errorf("invalid traceparent %q", s)
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHex(parts[0], 2) || !isHex(traceID, 32) || !isHex(spanID, 16) || !isHex(flags, 2) ||
+		traceID == strings.Repeat("0", 32) || spanID == strings.Repeat("0", 16) {
+		return TraceContext{}, fmt.Errorf("invalid traceparent %q", s)
+	}
+	flagBits, _ := hex.DecodeString(flags)
+	return TraceContext{TraceID: traceID, SpanID: spanID, Sampled: flagBits[0]&1 == 1}, nil
+}
+
+// TraceFrom returns the trace context in the traceparent header of a message
+func TraceFrom(m Message) (TraceContext, bool) {
+	header, ok := m.Header(TraceParentHeader)
+	if !ok {
+		return TraceContext{}, false
+	}
+	tc, err := ParseTraceParent(string(header))
+	return tc, err == nil
+}
+
+// NewTrace starts a new sampled trace
+func NewTrace() TraceContext {
+	return TraceContext{TraceID: randomHex(16), SpanID: randomHex(8), Sampled: true}
+}
+
+// Child returns a new span of the same trace
+func (tc TraceContext) Child() TraceContext {
+	return TraceContext{TraceID: tc.TraceID, SpanID: randomHex(8), Sampled: tc.Sampled}
+}
+
+// Tracing starts a span for the processing of every message as child of the traceparent header of the message, a
+// message without valid header starts a new trace. The next ReadMessageFunc gets the message with the span in its
+// traceparent header, copy it to outgoing messages with TraceFrom(m) and Inject to continue the trace. Spans are
+// logged at debug level with their trace id, span id, parent id and duration.
+func Tracing(next ReadMessageFunc) ReadMessageFunc {
+	return func(m Message) error {
+		parent, ok := TraceFrom(m)
+		span := NewTrace()
+		if ok {
+			span = parent.Child()
+		}
+
+		traced := m
+		traced.Headers = append([]Header(nil), m.Headers...)
+		span.Inject(&traced)
+
+		start := time.Now()
+		err := next(traced)
+
+		fields := log.Fields{
+			"trace_id": span.TraceID,
+			"span_id":  span.SpanID,
+			"topic":    m.Topic,
+			"duration": time.Since(start).String(),
+		}
+		if ok {
+			fields["parent_id"] = parent.SpanID
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		log.WithFields(fields).Debug("# messaging # span finished")
+		return err
+	}
+}
+
+// isHex checks that s has the given length and only lower case hex characters
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex returns n random bytes as hex string
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
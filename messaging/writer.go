@@ -2,7 +2,10 @@ package messaging
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -11,6 +14,9 @@ import (
 // Writer is used to write messages to underlying broker
 type Writer interface {
 	Write(key []byte, value []byte) error
+	// WriteContext writes messages and respects the deadline and cancellation of the context. A message is written
+	// to Message.Topic if set and to the topic of the writer otherwise, Message.Time defaults to the current time.
+	WriteContext(ctx context.Context, msgs ...Message) error
 	io.Closer
 }
 
@@ -21,11 +27,104 @@ type BrokerWriter interface {
 	io.Closer
 }
 
+// Partitioner selects how messages are distributed across the partitions of a topic
+type Partitioner int
+
+const (
+	// LeastBytesPartitioner writes to the partition which received the least amount of data (default)
+	LeastBytesPartitioner Partitioner = iota
+	// HashPartitioner writes messages with the same key to the same partition using a FNV-1a hash (sarama compatible)
+	HashPartitioner
+	// Murmur2Partitioner writes messages with the same key to the same partition like the default Java client does
+	Murmur2Partitioner
+	// RoundRobinPartitioner distributes messages equally across all partitions
+	RoundRobinPartitioner
+	// ExplicitPartitioner writes messages to Message.Partition
+	ExplicitPartitioner
+)
+
+// balancer returns the kafka balancer of a partitioner
+func (p Partitioner) balancer() kafka.Balancer {
+	switch p {
+	case HashPartitioner:
+		return &kafka.Hash{}
+	case Murmur2Partitioner:
+		return &kafka.Murmur2Balancer{}
+	case RoundRobinPartitioner:
+		return &kafka.RoundRobin{}
+	case ExplicitPartitioner:
+		return kafka.BalancerFunc(explicitPartition)
+	default:
+		return &kafka.LeastBytes{}
+	}
+}
+
+// explicitPartition returns the partition set in the message. Writers with the ExplicitPartitioner reject unknown
+// partitions before writing, a partition is only unknown here if it was added after the kafka writer read the
+// partitions of the topic, it is written to the first partition then.
+func explicitPartition(msg kafka.Message, partitions ...int) int {
+	for _, p := range partitions {
+		if p == msg.Partition {
+			return p
+		}
+	}
+	return partitions[0]
+}
+
+// explicitWriteBroker checks that the partitions of the messages exist before writing them with the ExplicitPartitioner
+type explicitWriteBroker struct {
+	BrokerWriter
+	topic          string
+	readPartitions func(ctx context.Context) ([]int, error)
+	partitions     map[int]bool
+	mu             sync.Mutex
+}
+
+// WriteMessages returns an error if a message has a partition the topic does not have, no message is written then
+func (eb *explicitWriteBroker) WriteMessages(ctx context.Context, msgs ...Message) error {
+	if err := eb.checkPartitions(ctx, msgs); err != nil {
+		return err
+	}
+	return eb.BrokerWriter.WriteMessages(ctx, msgs...)
+}
+
+// checkPartitions reads the partitions of the topic again if a message has an unknown partition
+func (eb *explicitWriteBroker) checkPartitions(ctx context.Context, msgs []Message) error {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	refreshed := false
+	for _, m := range msgs {
+		if eb.partitions[m.Partition] {
+			continue
+		}
+		if !refreshed {
+			ids, err := eb.readPartitions(ctx)
+			if err != nil {
+				return err
+			}
+			eb.partitions = make(map[int]bool, len(ids))
+			for _, id := range ids {
+				eb.partitions[id] = true
+			}
+			refreshed = true
+		}
+		if !eb.partitions[m.Partition] {
+			return fmt.Errorf("topic %s has no partition %d", eb.topic, m.Partition)
+		}
+	}
+	return nil
+}
+
 // missyWriter used as a default missy Writer implementation
 type missyWriter struct {
 	brokers      []string
 	topic        string
 	brokerWriter BrokerWriter
+
+	// newBrokerWriter creates broker writers for messages which override the topic of the writer
+	newBrokerWriter func(topic string) BrokerWriter
+	topicWriters    map[string]BrokerWriter
+	mu              sync.Mutex
 }
 
 // writeBroker us as a wrapper for kafka.Writer implementation to fulfill BrokerWriter interface
@@ -39,7 +138,8 @@ func (wb *writeBroker) WriteMessages(ctx context.Context, msgs ...Message) error
 	kafkaMessages := make([]kafka.Message, len(msgs))
 
 	for i, m := range msgs {
-		kMessage := kafka.Message{Key: m.Key, Value: m.Value, Time: m.Time}
+		// the partition is only read by the balancer
+		kMessage := kafka.Message{Key: m.Key, Value: m.Value, Headers: toKafkaHeaders(m.Headers), Time: m.Time, Partition: m.Partition}
 		kafkaMessages[i] = kMessage
 	}
 
@@ -51,18 +151,49 @@ func (wb *writeBroker) Close() error {
 	return wb.Writer.Close()
 }
 
+// newWriteBroker returns a broker writer for the topic using the given partitioner
+func newWriteBroker(brokers []string, topic string, partitioner Partitioner) BrokerWriter {
+	bw := &writeBroker{kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  brokers,
+		Topic:    topic,
+		Balancer: partitioner.balancer(),
+	})}
+	if partitioner != ExplicitPartitioner {
+		return bw
+	}
+	return &explicitWriteBroker{
+		BrokerWriter: bw,
+		topic:        topic,
+		readPartitions: func(ctx context.Context) ([]int, error) {
+			partitions, err := readPartitions(ctx, brokers, topic)
+			if err != nil {
+				return nil, err
+			}
+			ids := make([]int, len(partitions))
+			for i, p := range partitions {
+				ids[i] = p.ID
+			}
+			return ids, nil
+		},
+	}
+}
+
 // NewWriter based on brokers hosts, consumerGroup and topic. You need to close it after use. (Close())
 // we are leaving using the missy config for now, because we don't know how we want to configure this yet.
 func NewWriter(brokers []string, topic string) Writer {
+	return NewWriterWithPartitioner(brokers, topic, LeastBytesPartitioner)
+}
 
-	// kafka writer
-	w := kafka.NewWriter(kafka.WriterConfig{
-		Brokers:  brokers,
-		Topic:    topic,
-		Balancer: &kafka.LeastBytes{},
-	})
-
-	return &missyWriter{brokers: brokers, topic: topic, brokerWriter: &writeBroker{w}}
+// NewWriterWithPartitioner based on brokers hosts and topic using the given partitioner. You need to close it after use. (Close())
+func NewWriterWithPartitioner(brokers []string, topic string, partitioner Partitioner) Writer {
+	return &missyWriter{
+		brokers:      brokers,
+		topic:        topic,
+		brokerWriter: newWriteBroker(brokers, topic, partitioner),
+		newBrokerWriter: func(topic string) BrokerWriter {
+			return newWriteBroker(brokers, topic, partitioner)
+		},
+	}
 }
 
 // Write new message
@@ -73,10 +204,71 @@ func (mw *missyWriter) Write(key []byte, value []byte) error {
 		Value: value,
 		Time:  time.Now().UTC(),
 	}
-	return mw.brokerWriter.WriteMessages(context.Background(), msg)
+	return mw.WriteContext(context.Background(), msg)
 }
 
-// Close writer after use
+// WriteContext writes messages to their topics within the deadline of the context
+func (mw *missyWriter) WriteContext(ctx context.Context, msgs ...Message) error {
+	// group messages by topic to write them in as few requests as possible
+	var topics []string
+	byTopic := make(map[string][]Message)
+	for _, m := range msgs {
+		if m.Time.IsZero() {
+			m.Time = time.Now().UTC()
+		}
+		topic := m.Topic
+		if topic == mw.topic {
+			topic = ""
+		}
+		if _, ok := byTopic[topic]; !ok {
+			topics = append(topics, topic)
+		}
+		byTopic[topic] = append(byTopic[topic], m)
+	}
+
+	for _, topic := range topics {
+		if err := mw.writerFor(topic).WriteMessages(ctx, byTopic[topic]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writerFor returns the broker writer of a topic, writers for topics other than the one of the writer are created on first use
+func (mw *missyWriter) writerFor(topic string) BrokerWriter {
+	if topic == "" || mw.newBrokerWriter == nil {
+		return mw.brokerWriter
+	}
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	if mw.topicWriters == nil {
+		mw.topicWriters = make(map[string]BrokerWriter)
+	}
+	bw, ok := mw.topicWriters[topic]
+	if !ok {
+		bw = mw.newBrokerWriter(topic)
+		mw.topicWriters[topic] = bw
+	}
+	return bw
+}
+
+// Close writer after use, all broker writers are closed and their errors are returned together
 func (mw *missyWriter) Close() error {
-	return mw.brokerWriter.Close()
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	var problems []string
+	if err := mw.brokerWriter.Close(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for topic, bw := range mw.topicWriters {
+		if err := bw.Close(); err != nil {
+			problems = append(problems, fmt.Sprintf("topic %s: %v", topic, err))
+		}
+		delete(mw.topicWriters, topic)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("cannot close writers: %s", strings.Join(problems, "; "))
+	}
+	return nil
 }
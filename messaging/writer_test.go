@@ -2,6 +2,7 @@ package messaging
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"testing"
 	tm "time"
@@ -47,7 +48,7 @@ func TestMissyWriter_WriteSuccess(t *testing.T) {
 
 	defer monkey.Unpatch(tm.Now)
 
-	monkey.PatchInstanceMethod(reflect.TypeOf(brokerWriterMock), "WriteMessages", func(_ *MockBrokerWriter, ctx context.Context, messages ...Message) error {
+	guard := monkey.PatchInstanceMethod(reflect.TypeOf(brokerWriterMock), "WriteMessages", func(_ *MockBrokerWriter, ctx context.Context, messages ...Message) error {
 		for _, ms := range messages {
 			if reflect.DeepEqual(ms, *msg) == false {
 				t.Error("Messages differ")
@@ -56,7 +57,7 @@ func TestMissyWriter_WriteSuccess(t *testing.T) {
 		return nil
 	})
 
-	defer monkey.Unpatch(brokerWriterMock.WriteMessages)
+	defer guard.Unpatch()
 
 	if err := writer.Write(key, value); err != nil {
 		t.Error("there was an unexpected error during Write message")
@@ -81,12 +82,12 @@ func TestMissyWriter_WriteError(t *testing.T) {
 
 	exec := false
 
-	monkey.PatchInstanceMethod(reflect.TypeOf(brokerWriterMock), "WriteMessages", func(_ *MockBrokerWriter, ctx context.Context, messages ...Message) error {
+	guard := monkey.PatchInstanceMethod(reflect.TypeOf(brokerWriterMock), "WriteMessages", func(_ *MockBrokerWriter, ctx context.Context, messages ...Message) error {
 		exec = true
 		return errors.New("error")
 	})
 
-	defer monkey.Unpatch(brokerWriterMock.WriteMessages)
+	defer guard.Unpatch()
 
 	key := []byte("key")
 	value := []byte("value")
@@ -202,3 +203,142 @@ func TestWriteBroker_Close(t *testing.T) {
 	}
 
 }
+
+func TestMissyWriter_WriteContextTopicOverride(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defaultWriterMock := NewMockBrokerWriter(mockCtrl)
+	otherWriterMock := NewMockBrokerWriter(mockCtrl)
+
+	msgTime := tm.Unix(42, 0).UTC()
+	ctx, cancel := context.WithTimeout(context.Background(), tm.Second)
+	defer cancel()
+
+	defaultWriterMock.EXPECT().WriteMessages(ctx, Message{Key: []byte("a"), Time: msgTime}, Message{Topic: "test", Key: []byte("c"), Time: msgTime}).Return(nil)
+	otherWriterMock.EXPECT().WriteMessages(ctx, Message{Topic: "other", Key: []byte("b"), Time: msgTime}).Return(nil)
+	defaultWriterMock.EXPECT().Close().Return(nil)
+	otherWriterMock.EXPECT().Close().Return(nil)
+
+	created := 0
+	writer := missyWriter{topic: "test", brokerWriter: defaultWriterMock, newBrokerWriter: func(topic string) BrokerWriter {
+		if topic != "other" {
+			t.Errorf("unexpected topic: expected: other, got %s", topic)
+		}
+		created++
+		return otherWriterMock
+	}}
+
+	err := writer.WriteContext(ctx,
+		Message{Key: []byte("a"), Time: msgTime},
+		Message{Topic: "other", Key: []byte("b"), Time: msgTime},
+		Message{Topic: "test", Key: []byte("c"), Time: msgTime},
+	)
+	if err != nil {
+		t.Errorf("there was an unexpected error during WriteContext: %v", err)
+	}
+
+	if created != 1 {
+		t.Errorf("expected one writer for the other topic, got %d", created)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Errorf("there is an error during Close call")
+	}
+}
+
+func TestMissyWriter_WriteContextDefaultTime(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	brokerWriterMock := NewMockBrokerWriter(mockCtrl)
+
+	msgTime := tm.Unix(0, 0).UTC()
+	monkey.Patch(tm.Now, func() tm.Time {
+		return msgTime
+	})
+	defer monkey.Unpatch(tm.Now)
+
+	brokerWriterMock.EXPECT().WriteMessages(gomock.Any(), Message{Key: []byte("key"), Time: msgTime}).Return(nil)
+
+	writer := missyWriter{brokerWriter: brokerWriterMock}
+
+	if err := writer.WriteContext(context.Background(), Message{Key: []byte("key")}); err != nil {
+		t.Errorf("there was an unexpected error during WriteContext: %v", err)
+	}
+}
+
+func TestExplicitPartition(t *testing.T) {
+	tests := []struct {
+		partition  int
+		partitions []int
+		expected   int
+	}{
+		{partition: 1, partitions: []int{0, 1, 2}, expected: 1},
+		{partition: 4, partitions: []int{0, 1, 2}, expected: 0},
+		{partition: -1, partitions: []int{0, 1, 2}, expected: 0},
+		{partition: 2, partitions: []int{2}, expected: 2},
+	}
+
+	for _, test := range tests {
+		if p := explicitPartition(kafka.Message{Partition: test.partition}, test.partitions...); p != test.expected {
+			t.Errorf("invalid partition for %d: expected: %d, got %d", test.partition, test.expected, p)
+		}
+	}
+}
+
+func TestExplicitWriteBroker_UnknownPartition(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	brokerWriterMock := NewMockBrokerWriter(mockCtrl)
+	brokerWriterMock.EXPECT().WriteMessages(gomock.Any(), Message{Partition: 1}).Return(nil)
+
+	reads := 0
+	partitions := []int{0, 1}
+	wb := &explicitWriteBroker{BrokerWriter: brokerWriterMock, topic: "test", readPartitions: func(ctx context.Context) ([]int, error) {
+		reads++
+		return partitions, nil
+	}}
+
+	if err := wb.WriteMessages(context.Background(), Message{Partition: 1}); err != nil {
+		t.Errorf("there was an unexpected error writing to partition 1: %v", err)
+	}
+	for _, partition := range []int{4, -1} {
+		err := wb.WriteMessages(context.Background(), Message{Partition: 1}, Message{Partition: partition})
+		if err == nil || err.Error() != fmt.Sprintf("topic test has no partition %d", partition) {
+			t.Errorf("expected an error for partition %d, got %v", partition, err)
+		}
+	}
+	if reads != 3 {
+		t.Errorf("expected the partitions to be read again for unknown partitions, got %d reads", reads)
+	}
+}
+
+func TestMissyWriter_CloseErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	defaultWriterMock := NewMockBrokerWriter(mockCtrl)
+	defaultWriterMock.EXPECT().Close().Return(nil)
+	otherWriterMock := NewMockBrokerWriter(mockCtrl)
+	otherWriterMock.EXPECT().Close().Return(errors.New("connection reset"))
+
+	writer := missyWriter{brokerWriter: defaultWriterMock, topicWriters: map[string]BrokerWriter{"other": otherWriterMock}}
+
+	if err := writer.Close(); err == nil || err.Error() != "cannot close writers: topic other: connection reset" {
+		t.Errorf("expected the error of the other writer, got %v", err)
+	}
+}
+
+func TestPartitioner_Balancer(t *testing.T) {
+	tests := []struct {
+		partitioner Partitioner
+		expected    kafka.Balancer
+	}{
+		{partitioner: LeastBytesPartitioner, expected: &kafka.LeastBytes{}},
+		{partitioner: HashPartitioner, expected: &kafka.Hash{}},
+		{partitioner: Murmur2Partitioner, expected: &kafka.Murmur2Balancer{}},
+		{partitioner: RoundRobinPartitioner, expected: &kafka.RoundRobin{}},
+	}
+
+	for _, test := range tests {
+		if b := test.partitioner.balancer(); reflect.TypeOf(b) != reflect.TypeOf(test.expected) {
+			t.Errorf("invalid balancer for partitioner %d: expected: %T, got %T", test.partitioner, test.expected, b)
+		}
+	}
+}
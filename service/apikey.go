@@ -0,0 +1,105 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader is the default header holding the API key of a request
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyHashPrefix marks hashed keys in an API key file, followed by the hex encoded SHA-256 hash of the key
+const apiKeyHashPrefix = "sha256:"
+
+// ErrInvalidAPIKey is returned for requests with an unknown API key
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKey is an entry of an API key file. Key holds the key itself or its SHA-256 hash as sha256:<hex>, so the file
+// does not need to contain the plain keys.
+type APIKey struct {
+	Identity
+	Key string `json:"key"`
+}
+
+// APIKeyAuthenticator authenticates requests with a static API key in the X-API-Key header
+type APIKeyAuthenticator struct {
+	// Header holds the API key, defaults to APIKeyHeader
+	Header string
+
+	keys []apiKeyHash
+}
+
+// apiKeyHash is the SHA-256 hash of an API key and its identity
+type apiKeyHash struct {
+	hash     []byte
+	identity Identity
+}
+
+// NewAPIKeyAuthenticator returns an authenticator accepting the keys
+func NewAPIKeyAuthenticator(keys ...APIKey) (*APIKeyAuthenticator, error) {
+	a := &APIKeyAuthenticator{Header: APIKeyHeader}
+	for _, k := range keys {
+		if k.Name == "" {
+			return nil, errors.New("API key without name")
+		}
+		var hash []byte
+		if strings.HasPrefix(k.Key, apiKeyHashPrefix) {
+			var err error
+			hash, err = hex.DecodeString(strings.TrimPrefix(k.Key, apiKeyHashPrefix))
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid hash of API key %s", k.Name)
+			}
+		} else if k.Key != "" {
+			sum := sha256.Sum256([]byte(k.Key))
+			hash = sum[:]
+		} else {
+			return nil, fmt.Errorf("API key %s is empty", k.Name)
+		}
+		a.keys = append(a.keys, apiKeyHash{hash: hash, identity: k.Identity})
+	}
+	return a, nil
+}
+
+// NewAPIKeyAuthenticatorFromFile returns an authenticator accepting the keys of a JSON file, e.g.
+// [{"name": "partner", "key": "sha256:...", "policies": ["orders:read"]}]
+func NewAPIKeyAuthenticatorFromFile(path string) (*APIKeyAuthenticator, error) {
+	if path == "" {
+		return nil, errors.New("no API key file configured, set AUTH_API_KEYS_FILE")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read API key file: %v", err)
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("cannot parse API key file %s: %v", path, err)
+	}
+	return NewAPIKeyAuthenticator(keys...)
+}
+
+// Authenticate compares the hash of the API key of the request with the hashes of the known keys in constant time
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	header := a.Header
+	if header == "" {
+		header = APIKeyHeader
+	}
+	key := r.Header.Get(header)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash) == 1 {
+			return k.identity.principal(AuthMethodAPIKey), nil
+		}
+	}
+	return nil, ErrInvalidAPIKey
+}
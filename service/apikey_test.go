@@ -0,0 +1,73 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	hash := sha256.Sum256([]byte("hashed-key"))
+	file, err := ioutil.TempFile("", "api-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`[
+		{"name": "static", "key": "static-key", "policies": ["orders:read"]},
+		{"name": "hashed", "key": "sha256:` + hex.EncodeToString(hash[:]) + `"}
+	]`)
+	file.Close()
+
+	a, err := NewAPIKeyAuthenticatorFromFile(file.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		key           string
+		expectedName  string
+		expectedError error
+	}{
+		{"static-key", "static", nil},
+		{"hashed-key", "hashed", nil},
+		{"sha256:" + hex.EncodeToString(hash[:]), "", ErrInvalidAPIKey},
+		{"unknown", "", ErrInvalidAPIKey},
+		{"", "", ErrNoCredentials},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.key != "" {
+			r.Header.Set(APIKeyHeader, test.key)
+		}
+		p, err := a.Authenticate(r)
+		if err != test.expectedError {
+			t.Errorf("%q: expected error %v but got %v", test.key, test.expectedError, err)
+			continue
+		}
+		if err == nil && (p.Name != test.expectedName || p.Method != AuthMethodAPIKey || p.Claims.Subject != test.expectedName) {
+			t.Errorf("%q: unexpected principal %+v", test.key, p)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(APIKeyHeader, "static-key")
+	if p, _ := a.Authenticate(r); !p.Claims.HasPolicy("orders:read") {
+		t.Errorf("expected the policies of the key but got %v", p.Claims.Policies)
+	}
+}
+
+func TestNewAPIKeyAuthenticator_InvalidKeys(t *testing.T) {
+	for _, key := range []APIKey{
+		{Key: "no-name"},
+		{Identity: Identity{Name: "empty"}},
+		{Identity: Identity{Name: "hash"}, Key: "sha256:abc"},
+	} {
+		if _, err := NewAPIKeyAuthenticator(key); err == nil {
+			t.Errorf("expected an error for %+v", key)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/microdevs/missy/log"
+)
+
+// authentication methods of a Principal
+const (
+	AuthMethodJWT        = "jwt"
+	AuthMethodAPIKey     = "api_key"
+	AuthMethodClientCert = "client_cert"
+	AuthMethodHMAC       = "hmac"
+)
+
+const ctxPrincipal ctxKey = "principal"
+
+// ErrNoCredentials is returned by an Authenticator if the request does not carry its kind of credentials, an
+// AuthenticatorChain tries the next authenticator then
+var ErrNoCredentials = errors.New("no credentials found")
+
+var (
+	configuredAuthenticator     Authenticator
+	configuredAuthenticatorOnce sync.Once
+)
+
+func init() {
+	Config().RegisterOptionalParameter("AUTH_METHODS", AuthMethodJWT, "service.auth.methods", "Comma separated authentication methods of secure handlers tried in order: jwt, api_key, client_cert, hmac")
+	Config().RegisterOptionalParameter("AUTH_API_KEYS_FILE", "", "service.auth.api.keys.file", "A JSON file with the API keys accepted by the api_key authentication method")
+	Config().RegisterOptionalParameter("AUTH_CLIENT_CERTS_FILE", "", "service.auth.client.certs.file", "A JSON file mapping client certificate subjects and SANs to identities for the client_cert authentication method, empty accepts any verified certificate")
+	Config().RegisterOptionalParameter("AUTH_HMAC_KEYS_FILE", "", "service.auth.hmac.keys.file", "A JSON file with the keys accepted by the hmac authentication method")
+	Config().Parse()
+}
+
+// Principal is the authenticated user, service or client of a request. Its Claims hold the policies of the principal
+// for all authentication methods, so policy requirements work regardless of how a request was authenticated.
+type Principal struct {
+	Name   string
+	Method string
+	Claims *Claims
+
+	token *jwt.Token
+}
+
+// Identity is a principal known by an API key, a client certificate or an HMAC key
+type Identity struct {
+	Name     string   `json:"name"`
+	Policies []string `json:"policies"`
+}
+
+// principal returns the principal of the identity authenticated with the method
+func (id Identity) principal(method string) *Principal {
+	claims := NewClaims(map[string]interface{}{"sub": id.Name})
+	if len(id.Policies) > 0 {
+		claims.Policies["default"] = id.Policies
+	}
+	return &Principal{Name: id.Name, Method: method, Claims: claims}
+}
+
+// Authenticator authenticates a request, it returns ErrNoCredentials if the request has no credentials it handles
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc is a function implementing Authenticator
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate calls f
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+// AuthenticatorChain accepts a request with the first authenticator which succeeds
+type AuthenticatorChain []Authenticator
+
+// NewAuthenticatorChain returns a chain trying the authenticators in the given order
+func NewAuthenticatorChain(authenticators ...Authenticator) AuthenticatorChain {
+	return AuthenticatorChain(authenticators)
+}
+
+// Authenticate returns the principal of the first authenticator which succeeds. If all fail, the error of the first
+// authenticator which found credentials is returned, ErrNoCredentials if none did.
+func (c AuthenticatorChain) Authenticate(r *http.Request) (*Principal, error) {
+	var firstErr error
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if err == nil {
+			return p, nil
+		}
+		if firstErr == nil && err != ErrNoCredentials {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		return nil, ErrNoCredentials
+	}
+	return nil, firstErr
+}
+
+// JWTAuthenticator authenticates requests with a bearer token validated like in AuthHandler
+type JWTAuthenticator struct{}
+
+// Authenticate validates the bearer token of the request
+func (JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	rawToken, err := RawToken(r)
+	if err != nil {
+		return nil, ErrNoCredentials
+	}
+	initTokenKeys()
+	if !tokenKeysConfigured() {
+		return nil, errors.New("neither a public ca file, a JSON Web Key Set nor a token introspection endpoint is configured")
+	}
+	token, tokenErr := validateToken(rawToken)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	claims := NewClaims(token.Claims.(jwt.MapClaims))
+	return &Principal{Name: claims.Subject, Method: AuthMethodJWT, Claims: claims, token: token}, nil
+}
+
+// WithPrincipal returns a copy of the context with the principal and its claims
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	ctx = context.WithValue(ctx, ctxPrincipal, p)
+	if p.token != nil {
+		ctx = context.WithValue(ctx, ctxToken, p.token)
+	}
+	if p.Claims != nil {
+		ctx = WithClaims(ctx, p.Claims)
+	}
+	return ctx
+}
+
+// PrincipalFrom returns the principal stored in the context by AuthenticationHandler or AuthHandler
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(ctxPrincipal).(*Principal)
+	return p, ok && p != nil
+}
+
+// AuthenticationHandler returns a middleware which authenticates requests with the authenticator and stores the
+// principal in the context. Requests without credentials are rejected with 401, invalid credentials with 403.
+func AuthenticationHandler(a Authenticator) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := a.Authenticate(r)
+			if err != nil {
+				log.Warnf("Authentication failed: %v", err)
+				if tokenErr, ok := err.(*TokenError); ok {
+					writeTokenError(w, tokenErr)
+					return
+				}
+				if err == ErrNoCredentials {
+					writeProblem(w, http.StatusUnauthorized, "The request has no credentials")
+					return
+				}
+				writeProblem(w, http.StatusForbidden, "The credentials of the request are invalid")
+				return
+			}
+			h.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// authenticator returns the authenticator of the secure handlers of the service, nil means AuthHandler
+func (s *Service) authenticator() Authenticator {
+	if s.Authenticator != nil {
+		return s.Authenticator
+	}
+	configuredAuthenticatorOnce.Do(func() {
+		a, err := NewAuthenticatorFromConfig()
+		if err != nil {
+			log.Fatalf("Unable to set up the authentication of secure handlers: %v", err)
+		}
+		configuredAuthenticator = a
+	})
+	return configuredAuthenticator
+}
+
+// NewAuthenticatorFromConfig returns a chain of the authentication methods in AUTH_METHODS, it returns nil if only
+// jwt is configured, which is handled by AuthHandler
+func NewAuthenticatorFromConfig() (Authenticator, error) {
+	methods := splitList(Config().Get("service.auth.methods"))
+	if len(methods) == 0 || (len(methods) == 1 && methods[0] == AuthMethodJWT) {
+		return nil, nil
+	}
+
+	var chain AuthenticatorChain
+	for _, method := range methods {
+		switch strings.ToLower(method) {
+		case AuthMethodJWT:
+			chain = append(chain, JWTAuthenticator{})
+		case AuthMethodAPIKey:
+			a, err := NewAPIKeyAuthenticatorFromFile(Config().Get("service.auth.api.keys.file"))
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, a)
+		case AuthMethodClientCert:
+			a := &ClientCertAuthenticator{}
+			if file := Config().Get("service.auth.client.certs.file"); file != "" {
+				identities, err := readIdentities(file)
+				if err != nil {
+					return nil, err
+				}
+				a.Identities = identities
+			}
+			chain = append(chain, a)
+		case AuthMethodHMAC:
+			a, err := NewHMACAuthenticatorFromFile(Config().Get("service.auth.hmac.keys.file"))
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, a)
+		default:
+			return nil, fmt.Errorf("unknown authentication method %q", method)
+		}
+	}
+	return chain, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthenticatorChain(t *testing.T) {
+	errInvalid := errors.New("invalid")
+	none := AuthenticatorFunc(func(r *http.Request) (*Principal, error) { return nil, ErrNoCredentials })
+	invalid := AuthenticatorFunc(func(r *http.Request) (*Principal, error) { return nil, errInvalid })
+	valid := AuthenticatorFunc(func(r *http.Request) (*Principal, error) { return &Principal{Name: "valid"}, nil })
+
+	tests := []struct {
+		chain         AuthenticatorChain
+		expectedName  string
+		expectedError error
+	}{
+		{NewAuthenticatorChain(none, valid), "valid", nil},
+		{NewAuthenticatorChain(invalid, valid), "valid", nil},
+		{NewAuthenticatorChain(none, invalid), "", errInvalid},
+		{NewAuthenticatorChain(none, none), "", ErrNoCredentials},
+		{NewAuthenticatorChain(), "", ErrNoCredentials},
+	}
+	for i, test := range tests {
+		p, err := test.chain.Authenticate(httptest.NewRequest("GET", "/", nil))
+		if err != test.expectedError {
+			t.Errorf("%d: expected error %v but got %v", i, test.expectedError, err)
+		}
+		if test.expectedName != "" && (p == nil || p.Name != test.expectedName) {
+			t.Errorf("%d: expected principal %s but got %v", i, test.expectedName, p)
+		}
+	}
+}
+
+func TestSecureHandleWithAuthenticator(t *testing.T) {
+	apiKeys, _ := NewAPIKeyAuthenticator(APIKey{Identity: Identity{Name: "partner", Policies: []string{"orders:read"}}, Key: "partner-key"})
+	s := New("testservice")
+	s.Authenticator = NewAuthenticatorChain(JWTAuthenticator{}, apiKeys)
+	s.SecureHandleFuncWithPolicies("/orders", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := PrincipalFrom(r.Context())
+		if !ok {
+			t.Fatal("expected a principal in the context")
+		}
+		w.Write([]byte(p.Method + " " + p.Name))
+	}, AnyOf("orders:read"))
+
+	tests := []struct {
+		header         string
+		value          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Authorization", "Bearer " + policyToken(t, "orders:read"), http.StatusOK, "jwt test@test.de"},
+		{APIKeyHeader, "partner-key", http.StatusOK, "api_key partner"},
+		{APIKeyHeader, "wrong-key", http.StatusForbidden, ""},
+		{"Authorization", "Bearer invalid", http.StatusForbidden, ""},
+		{"", "", http.StatusUnauthorized, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "http://missy.com/orders", nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+		if w.Code != test.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", test.header, test.expectedStatus, w.Code)
+		}
+		if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+			t.Errorf("%s: expected body %q but got %q", test.header, test.expectedBody, w.Body)
+		}
+	}
+}
+
+func TestAuthHandlerStoresPrincipal(t *testing.T) {
+	s := New("testservice")
+	var principal *Principal
+	s.SecureHandleFunc("/principal", func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = PrincipalFrom(r.Context())
+	})
+
+	r := httptest.NewRequest("GET", "http://missy.com/principal", nil)
+	r.Header.Set("Authorization", "Bearer "+policyToken(t))
+	s.Router.ServeHTTP(httptest.NewRecorder(), r)
+	if principal == nil || principal.Method != AuthMethodJWT || principal.Name != "test@test.de" {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+}
+
+func TestNewAuthenticatorFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authenticators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "api-keys.json")
+	ioutil.WriteFile(keyFile, []byte(`[{"name": "partner", "key": "partner-key"}]`), 0600)
+
+	os.Setenv("AUTH_METHODS", "api_key, jwt")
+	os.Setenv("AUTH_API_KEYS_FILE", keyFile)
+	Config().ParseEnvironment(true)
+	defer func() {
+		os.Unsetenv("AUTH_METHODS")
+		os.Unsetenv("AUTH_API_KEYS_FILE")
+		Config().ParseEnvironment(true)
+	}()
+
+	a, err := NewAuthenticatorFromConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	chain, ok := a.(AuthenticatorChain)
+	if !ok || len(chain) != 2 {
+		t.Fatalf("expected a chain of two authenticators but got %#v", a)
+	}
+	if _, ok := chain[0].(*APIKeyAuthenticator); !ok {
+		t.Errorf("expected the API key authenticator first but got %T", chain[0])
+	}
+
+	os.Setenv("AUTH_METHODS", "jwt")
+	Config().ParseEnvironment(true)
+	if a, err := NewAuthenticatorFromConfig(); a != nil || err != nil {
+		t.Errorf("expected AuthHandler to be used for jwt only, got %v %v", a, err)
+	}
+
+	os.Setenv("AUTH_METHODS", "basic")
+	Config().ParseEnvironment(true)
+	if _, err := NewAuthenticatorFromConfig(); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
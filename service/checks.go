@@ -0,0 +1,97 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Check tests a dependency of the service, it returns an error describing the problem if the dependency is not available
+type Check func() error
+
+// StatusFunc returns the current state of a component of the service, e.g. "consuming" or "paused"
+type StatusFunc func() string
+
+// RegisterHealthCheck registers a check of a dependency by name, the result of all checks is listed in the readiness report
+func (s *Service) RegisterHealthCheck(name string, check Check) {
+	s.muChecks.Lock()
+	defer s.muChecks.Unlock()
+	if s.checks == nil {
+		s.checks = make(map[string]Check)
+	}
+	s.checks[name] = check
+}
+
+// RegisterReadinessCheck registers a check which has to succeed for the service to be ready, e.g. a startup step
+func (s *Service) RegisterReadinessCheck(name string, check Check) {
+	s.muChecks.Lock()
+	defer s.muChecks.Unlock()
+	if s.readinessChecks == nil {
+		s.readinessChecks = make(map[string]Check)
+	}
+	s.readinessChecks[name] = check
+}
+
+// HealthCheck returns the check registered with the given name, it returns a failing check if there is none
+func (s *Service) HealthCheck(name string) Check {
+	return func() error {
+		s.muChecks.Lock()
+		check, ok := s.checks[name]
+		s.muChecks.Unlock()
+		if !ok {
+			return fmt.Errorf("health check %s is not registered", name)
+		}
+		return check()
+	}
+}
+
+// RegisterStatus registers a component whose state is listed in the readiness report
+func (s *Service) RegisterStatus(name string, status StatusFunc) {
+	s.muChecks.Lock()
+	defer s.muChecks.Unlock()
+	if s.statuses == nil {
+		s.statuses = make(map[string]StatusFunc)
+	}
+	s.statuses[name] = status
+}
+
+// readinessReport returns a line for every registered check and component sorted by name and whether all
+// readiness checks succeeded
+func (s *Service) readinessReport() ([]string, bool) {
+	s.muChecks.Lock()
+	checks := make(map[string]Check, len(s.checks))
+	for name, check := range s.checks {
+		checks[name] = check
+	}
+	readinessChecks := make(map[string]Check, len(s.readinessChecks))
+	for name, check := range s.readinessChecks {
+		readinessChecks[name] = check
+	}
+	statuses := make(map[string]StatusFunc, len(s.statuses))
+	for name, status := range s.statuses {
+		statuses[name] = status
+	}
+	s.muChecks.Unlock()
+
+	var report []string
+	ready := true
+	for name, check := range readinessChecks {
+		if err := check(); err != nil {
+			ready = false
+			report = append(report, fmt.Sprintf("check %s: failed: %v", name, err))
+			continue
+		}
+		report = append(report, fmt.Sprintf("check %s: OK", name))
+	}
+	for name, check := range checks {
+		result := "OK"
+		if err := check(); err != nil {
+			result = "failed: " + err.Error()
+		}
+		report = append(report, fmt.Sprintf("check %s: %s", name, result))
+	}
+	for name, status := range statuses {
+		report = append(report, fmt.Sprintf("%s: %s", name, status()))
+	}
+	sort.Strings(report)
+	return report, ready
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const ctxClaims ctxKey = "claims"
+
+// Claims are the claims of a validated token. The policies are grouped like in the tokens of our IAM, e.g.
+// {"default": ["orders.read"]}, policies which are not strings are skipped.
+type Claims struct {
+	ID        string
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	Scopes    []string
+	Policies  map[string][]string
+
+	// Raw holds all claims of the token including custom claims, use Decode to read them into a struct
+	Raw map[string]interface{} `json:"-"`
+}
+
+// NewClaims converts the claims of a token, the scopes are read from a space separated scope claim or a scp list
+func NewClaims(raw map[string]interface{}) *Claims {
+	c := &Claims{Raw: raw, Audience: audiences(raw), Policies: make(map[string][]string)}
+	c.ID, _ = raw["jti"].(string)
+	c.Subject, _ = raw["sub"].(string)
+	c.Issuer, _ = raw["iss"].(string)
+	if exp, ok := numericDate(raw, "exp"); ok {
+		c.ExpiresAt = exp
+	}
+	if iat, ok := numericDate(raw, "iat"); ok {
+		c.IssuedAt = iat
+	}
+
+	if scope, ok := raw["scope"].(string); ok {
+		c.Scopes = strings.Fields(scope)
+	} else {
+		c.Scopes = stringList(raw["scp"])
+	}
+
+	groups, _ := raw[tokenClaimsPoliciesKey].(map[string]interface{})
+	for group, policies := range groups {
+		c.Policies[group] = stringList(policies)
+	}
+	return c
+}
+
+// HasPolicy checks if a policy of any group grants the policy, see SetPolicyEvaluator
+func (c *Claims) HasPolicy(policy string) bool {
+	return currentPolicyEvaluator().Allowed(c, "", policy)
+}
+
+// HasPolicyFor checks if a policy granted for the resource grants the policy, see SetPolicyEvaluator
+func (c *Claims) HasPolicyFor(resource string, policy string) bool {
+	return currentPolicyEvaluator().Allowed(c, resource, policy)
+}
+
+// HasScope checks if the token was granted the scope
+func (c *Claims) HasScope(scope string) bool {
+	return contains(c.Scopes, scope)
+}
+
+// Decode reads the raw claims into v, which is a pointer to a struct with json tags for custom claims
+func (c *Claims) Decode(v interface{}) error {
+	data, err := json.Marshal(c.Raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WithClaims returns a copy of the context with the claims, e.g. to pass them on to code processing messages
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, ctxClaims, claims)
+}
+
+// ClaimsFrom returns the claims stored in the context by AuthHandler or WithClaims
+func ClaimsFrom(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(ctxClaims).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// ParseClaims validates a signed token with the configured keys and options and returns its claims, e.g. for
+// tokens passed along with messages
+func ParseClaims(signedToken string) (*Claims, error) {
+	initTokenKeys()
+	if !tokenKeysConfigured() {
+		return nil, errors.New("neither a public ca file, a JSON Web Key Set nor a token introspection endpoint is configured")
+	}
+	token, err := validateToken(signedToken)
+	if err != nil {
+		return nil, err
+	}
+	return NewClaims(token.Claims.(jwt.MapClaims)), nil
+}
+
+// requestClaims returns the claims from the context or of the token stored in the request
+func requestClaims(ctx context.Context) (*Claims, bool) {
+	if claims, ok := ClaimsFrom(ctx); ok {
+		return claims, true
+	}
+	token, _ := ctx.Value(ctxToken).(*jwt.Token)
+	if token == nil {
+		return nil, false
+	}
+	raw, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, false
+	}
+	return NewClaims(raw), true
+}
+
+// stringList returns the strings of a claim which is a list or a single string
+func stringList(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var list []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestNewClaims(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	claims := NewClaims(jwt.MapClaims{
+		"jti":      "id-1",
+		"sub":      "user-1",
+		"iss":      "iam",
+		"aud":      []interface{}{"orders", "billing"},
+		"exp":      float64(exp),
+		"scope":    "orders:read orders:write",
+		"policies": map[string]interface{}{"default": []interface{}{"p1", 2, "p2"}, "tenant": []interface{}{"p3"}, "invalid": true},
+	})
+
+	if claims.ID != "id-1" || claims.Subject != "user-1" || claims.Issuer != "iam" {
+		t.Errorf("unexpected registered claims %+v", claims)
+	}
+	if !reflect.DeepEqual(claims.Audience, []string{"orders", "billing"}) {
+		t.Errorf("unexpected audience %v", claims.Audience)
+	}
+	if claims.ExpiresAt.Unix() != exp || !claims.IssuedAt.IsZero() {
+		t.Errorf("unexpected times exp %s iat %s", claims.ExpiresAt, claims.IssuedAt)
+	}
+	if !claims.HasScope("orders:write") || claims.HasScope("orders") {
+		t.Errorf("unexpected scopes %v", claims.Scopes)
+	}
+	expected := map[string][]string{"default": {"p1", "p2"}, "tenant": {"p3"}, "invalid": nil}
+	if !reflect.DeepEqual(claims.Policies, expected) {
+		t.Errorf("expected policies %v but got %v", expected, claims.Policies)
+	}
+	if !claims.HasPolicy("p3") || claims.HasPolicy("p4") {
+		t.Error("unexpected result of HasPolicy")
+	}
+
+	if scp := NewClaims(jwt.MapClaims{"scp": []interface{}{"a", "b"}}); !reflect.DeepEqual(scp.Scopes, []string{"a", "b"}) {
+		t.Errorf("expected the scopes of the scp claim but got %v", scp.Scopes)
+	}
+}
+
+func TestClaims_Decode(t *testing.T) {
+	claims := NewClaims(jwt.MapClaims{"sub": "user-1", "tenant": "acme", "roles": []interface{}{"admin"}})
+	var custom struct {
+		Tenant string   `json:"tenant"`
+		Roles  []string `json:"roles"`
+	}
+	if err := claims.Decode(&custom); err != nil {
+		t.Fatal(err)
+	}
+	if custom.Tenant != "acme" || len(custom.Roles) != 1 || custom.Roles[0] != "admin" {
+		t.Errorf("unexpected custom claims %+v", custom)
+	}
+}
+
+func TestClaimsFrom(t *testing.T) {
+	if _, ok := ClaimsFrom(context.Background()); ok {
+		t.Error("expected no claims in an empty context")
+	}
+	claims := &Claims{Subject: "user-1"}
+	if c, ok := ClaimsFrom(WithClaims(context.Background(), claims)); !ok || c != claims {
+		t.Errorf("expected the stored claims but got %v", c)
+	}
+}
+
+func TestAuthHandlerStoresClaims(t *testing.T) {
+	s := New("testservice")
+	var subject string
+	s.SecureHandleFunc("/claims", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFrom(r.Context())
+		if !ok {
+			t.Fatal("expected claims in the request context")
+		}
+		subject = claims.Subject
+	})
+
+	r := httptest.NewRequest("GET", "http://missy.com/claims", nil)
+	r.Header.Set("Authorization", "Bearer "+policyToken(t, "orders.read"))
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || subject != "test@test.de" {
+		t.Errorf("expected status 200 and the subject of the token, got %d and %q", w.Code, subject)
+	}
+}
+
+func TestParseClaims(t *testing.T) {
+	claims, err := ParseClaims(policyToken(t, "orders.read"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !claims.HasPolicy("orders.read") {
+		t.Errorf("expected the policy of the token, got %v", claims.Policies)
+	}
+	if _, err := ParseClaims("not a token"); err == nil {
+		t.Error("expected an error for an invalid token")
+	}
+}
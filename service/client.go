@@ -11,13 +11,22 @@ import (
 	"github.com/microdevs/missy/log"
 )
 
-// NewClient returns a new http.Client with custom CA Cert if given through TLS_CACERT
-func NewClient() *http.Client {
+// NewClient returns a new http.Client with custom CA Cert if given through TLS_CACERT, the options attach
+// credentials to the outgoing requests, see NewClientFromConfig
+func NewClient(opts ...ClientOption) *http.Client {
 	config := &tls.Config{
 		RootCAs: rootCAs(),
 	}
 	tr := &http.Transport{TLSClientConfig: config}
-	return &http.Client{Transport: tr}
+	if len(opts) == 0 {
+		return &http.Client{Transport: tr}
+	}
+
+	auth := &authTransport{base: tr}
+	for _, opt := range opts {
+		opt(auth)
+	}
+	return &http.Client{Transport: auth}
 }
 
 // rootCAs returns the system CA Pool and inserts a custom CA file if given
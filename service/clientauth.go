@@ -0,0 +1,244 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/microdevs/missy/log"
+)
+
+// DefaultTokenRefreshAhead is the time before its expiry a client credentials token is refreshed
+const DefaultTokenRefreshAhead = time.Minute
+
+// defaultClientTokenLifetime is the time a client credentials token without expires_in is cached
+const defaultClientTokenLifetime = time.Minute * 5
+
+func init() {
+	Config().RegisterOptionalParameter("CLIENT_OAUTH_TOKEN_URL", "", "service.client.oauth.token.url", "The OAuth2 token endpoint clients of NewClientFromConfig get client credentials tokens from")
+	Config().RegisterOptionalParameter("CLIENT_OAUTH_CLIENT_ID", "", "service.client.oauth.client.id", "The client id of the service at the OAuth2 token endpoint")
+	Config().RegisterOptionalParameter("CLIENT_OAUTH_CLIENT_SECRET", "", "service.client.oauth.client.secret", "The client secret of the service at the OAuth2 token endpoint")
+	Config().RegisterOptionalParameter("CLIENT_OAUTH_SCOPES", "", "service.client.oauth.scopes", "Comma separated scopes requested for client credentials tokens")
+	Config().RegisterOptionalParameter("CLIENT_FORWARD_TOKEN", "false", "service.client.forward.token", "Forward the bearer token of the incoming request in the context of outgoing requests, it takes precedence over client credentials")
+	Config().RegisterOptionalParameter("CLIENT_API_KEY", "", "service.client.api.key", "The API key sent in the X-API-Key header of outgoing requests")
+	Config().Parse()
+}
+
+// ClientOption configures the credentials NewClient attaches to outgoing requests. The options are applied in the
+// given order, a bearer token is only set if the request has no Authorization header yet. Credentials are only sent
+// to the host of the request, not to the target of a redirect to another host.
+type ClientOption func(t *authTransport)
+
+// authTransport adds credentials to the requests before passing them to the base transport
+type authTransport struct {
+	base        http.RoundTripper
+	authorizers []func(r *http.Request) error
+}
+
+// RoundTrip sends a copy of the request with the credentials. Redirects to another host are sent without
+// credentials, so they are not leaked to hosts the request was not meant for.
+func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host != originalHost(r) {
+		return t.base.RoundTrip(r)
+	}
+	r = r.Clone(r.Context())
+	for _, authorize := range t.authorizers {
+		if err := authorize(r); err != nil {
+			if r.Body != nil {
+				r.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(r)
+}
+
+// originalHost returns the host of the request which started the redirects leading to the request
+func originalHost(r *http.Request) string {
+	for r.Response != nil && r.Response.Request != nil {
+		r = r.Response.Request
+	}
+	return r.URL.Host
+}
+
+// WithClientCredentials gets tokens from the OAuth2 token endpoint with the client credentials grant. A token is
+// cached and refreshed in the background once it expires within DefaultTokenRefreshAhead.
+func WithClientCredentials(tokenURL string, clientID string, clientSecret string, scopes ...string) ClientOption {
+	source := NewClientCredentials(tokenURL, clientID, clientSecret, scopes...)
+	return func(t *authTransport) {
+		t.authorizers = append(t.authorizers, func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "" {
+				return nil
+			}
+			token, err := source.Token()
+			if err != nil {
+				return err
+			}
+			r.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		})
+	}
+}
+
+// WithForwardedToken sends the bearer token of the incoming request, which is stored in the context by AuthHandler,
+// so requests have to be created with the context of the incoming request, e.g. with http.NewRequestWithContext
+func WithForwardedToken() ClientOption {
+	return func(t *authTransport) {
+		t.authorizers = append(t.authorizers, func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "" {
+				return nil
+			}
+			if token, ok := r.Context().Value(ctxToken).(*jwt.Token); ok && token != nil && token.Raw != "" {
+				r.Header.Set("Authorization", "Bearer "+token.Raw)
+			}
+			return nil
+		})
+	}
+}
+
+// WithAPIKey sends the API key in the X-API-Key header
+func WithAPIKey(key string) ClientOption {
+	return func(t *authTransport) {
+		t.authorizers = append(t.authorizers, func(r *http.Request) error {
+			r.Header.Set(APIKeyHeader, key)
+			return nil
+		})
+	}
+}
+
+// NewClientFromConfig returns a client with the credentials configured in the CLIENT_* parameters
+func NewClientFromConfig() *http.Client {
+	var opts []ClientOption
+	if Config().Get("service.client.forward.token") == "true" {
+		opts = append(opts, WithForwardedToken())
+	}
+	if tokenURL := Config().Get("service.client.oauth.token.url"); tokenURL != "" {
+		opts = append(opts, WithClientCredentials(tokenURL,
+			Config().Get("service.client.oauth.client.id"),
+			Config().Get("service.client.oauth.client.secret"),
+			splitList(Config().Get("service.client.oauth.scopes"))...))
+	}
+	if key := Config().Get("service.client.api.key"); key != "" {
+		opts = append(opts, WithAPIKey(key))
+	}
+	return NewClient(opts...)
+}
+
+// ClientCredentials gets and caches access tokens with the OAuth2 client credentials grant (RFC 6749 section 4.4)
+type ClientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	client       *http.Client
+	// RefreshAhead is the time before the expiry of the token it is refreshed in the background
+	RefreshAhead time.Duration
+
+	token      string
+	expires    time.Time
+	refreshing bool
+	mu         sync.Mutex
+	fetchMu    sync.Mutex
+}
+
+// NewClientCredentials returns a token source for the client
+func NewClientCredentials(tokenURL string, clientID string, clientSecret string, scopes ...string) *ClientCredentials {
+	return &ClientCredentials{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		client:       NewClient(),
+		RefreshAhead: DefaultTokenRefreshAhead,
+	}
+}
+
+// Token returns the cached token, a new token is fetched if there is none or it expired
+func (c *ClientCredentials) Token() (string, error) {
+	c.mu.Lock()
+	token, expires := c.token, c.expires
+	now := time.Now()
+	if token != "" && now.Before(expires) {
+		if now.Add(c.RefreshAhead).After(expires) && !c.refreshing {
+			c.refreshing = true
+			go c.refresh()
+		}
+		c.mu.Unlock()
+		return token, nil
+	}
+	c.mu.Unlock()
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	// another request may have fetched a token meanwhile
+	c.mu.Lock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+	c.mu.Unlock()
+	return c.fetch()
+}
+
+// refresh fetches a new token in the background, the cached token is used until it expires if this fails
+func (c *ClientCredentials) refresh() {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	if _, err := c.fetch(); err != nil {
+		log.Errorf("Unable to refresh the client credentials token: %v", err)
+	}
+	c.mu.Lock()
+	c.refreshing = false
+	c.mu.Unlock()
+}
+
+// fetch gets a token from the token endpoint and caches it, the caller holds fetchMu
+func (c *ClientCredentials) fetch() (string, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot get client credentials token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("cannot parse token response: %v", err)
+	}
+	if body.AccessToken == "" {
+		return "", fmt.Errorf("token response has no access token")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = body.AccessToken
+	lifetime := time.Duration(body.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultClientTokenLifetime
+	}
+	c.expires = time.Now().Add(lifetime)
+	return c.token, nil
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// tokenServer issues numbered client credentials tokens and counts the requests
+type tokenServer struct {
+	*httptest.Server
+	expiresIn int
+	requests  int
+	mu        sync.Mutex
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	s := &tokenServer{expiresIn: expiresIn}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("scope") != "orders invoices" {
+			t.Errorf("unexpected token request %v", r.PostForm)
+		}
+		s.mu.Lock()
+		s.requests++
+		n := s.requests
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "bearer",
+			"expires_in":   s.expiresIn,
+		})
+	}))
+	return s
+}
+
+func (s *tokenServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestClientCredentials_Token(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	defer server.Close()
+
+	c := NewClientCredentials(server.URL, "client", "secret", "orders", "invoices")
+	for n := 0; n < 3; n++ {
+		token, err := c.Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if token != "token-1" {
+			t.Errorf("expected the cached token but got %s", token)
+		}
+	}
+	if n := server.requestCount(); n != 1 {
+		t.Errorf("expected one token request but got %d", n)
+	}
+
+	if _, err := NewClientCredentials(server.URL, "client", "wrong").Token(); err == nil {
+		t.Error("expected an error for wrong client credentials")
+	}
+}
+
+func TestClientCredentials_RefreshAhead(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	defer server.Close()
+
+	c := NewClientCredentials(server.URL, "client", "secret", "orders", "invoices")
+	c.RefreshAhead = 2 * time.Hour
+	c.Token()
+	// the token expires within RefreshAhead, so it is still used while a new one is fetched
+	if token, _ := c.Token(); token != "token-1" {
+		t.Errorf("expected the cached token while refreshing but got %s", token)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for server.requestCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+	if token != "token-2" {
+		t.Errorf("expected the token to be refreshed in the background but got %s", token)
+	}
+}
+
+func TestNewClient_Credentials(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	defer tokens.Close()
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("Authorization"), r.Header.Get(APIKeyHeader))
+	}))
+	defer echo.Close()
+
+	client := NewClient(WithForwardedToken(), WithClientCredentials(tokens.URL, "client", "secret", "orders", "invoices"), WithAPIKey("key"))
+	call := func(ctx context.Context, authorization string) string {
+		req, _ := http.NewRequest("GET", echo.URL, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	incoming := context.WithValue(context.Background(), ctxToken, &jwt.Token{Raw: "incoming", Valid: true})
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		authorization string
+		expected      string
+	}{
+		{"forwarded token", incoming, "", "Bearer incoming|key"},
+		{"client credentials", context.Background(), "", "Bearer token-1|key"},
+		{"explicit header", incoming, "Bearer explicit", "Bearer explicit|key"},
+	}
+	for _, test := range tests {
+		if body := call(test.ctx, test.authorization); body != test.expected {
+			t.Errorf("%s: expected %q but got %q", test.name, test.expected, body)
+		}
+	}
+}
+
+func TestNewClientFromConfig(t *testing.T) {
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("Authorization"), r.Header.Get(APIKeyHeader))
+	}))
+	defer echo.Close()
+
+	os.Setenv("CLIENT_FORWARD_TOKEN", "true")
+	os.Setenv("CLIENT_API_KEY", "configured-key")
+	Config().ParseEnvironment(true)
+	defer func() {
+		os.Unsetenv("CLIENT_FORWARD_TOKEN")
+		os.Unsetenv("CLIENT_API_KEY")
+		Config().ParseEnvironment(true)
+	}()
+
+	req, _ := http.NewRequest("GET", echo.URL, nil)
+	ctx := context.WithValue(context.Background(), ctxToken, &jwt.Token{Raw: "incoming", Valid: true})
+	resp, err := NewClientFromConfig().Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "Bearer incoming|configured-key" {
+		t.Errorf("unexpected credentials %q", body)
+	}
+}
+
+func TestNewClient_RedirectToOtherHost(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	defer tokens.Close()
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization") + r.Header.Get(APIKeyHeader)
+	}))
+	defer other.Close()
+	var sameHost string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/orders", http.StatusFound)
+		case "/orders":
+			sameHost = r.Header.Get("Authorization") + "|" + r.Header.Get(APIKeyHeader)
+		default:
+			http.Redirect(w, r, other.URL, http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+
+	client := NewClient(WithForwardedToken(), WithClientCredentials(tokens.URL, "client", "secret", "orders", "invoices"), WithAPIKey("key"))
+	ctx := context.WithValue(context.Background(), ctxToken, &jwt.Token{Raw: "incoming", Valid: true})
+	for _, path := range []string{"/elsewhere", "/moved"} {
+		req, _ := http.NewRequest("GET", origin.URL+path, nil)
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if leaked != "" {
+		t.Errorf("expected no credentials to be sent to another host but got %q", leaked)
+	}
+	if sameHost != "Bearer incoming|key" {
+		t.Errorf("expected the credentials for a redirect to the same host but got %q", sameHost)
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/microdevs/missy/log"
+)
+
+// ErrUnknownClientCert is returned for verified client certificates which are not mapped to an identity
+var ErrUnknownClientCert = errors.New("client certificate is not mapped to an identity")
+
+// ClientCertAuthenticator authenticates requests with the client certificate verified during the TLS handshake, the
+// server has to request client certificates, see TLS_CLIENT_CAFILE
+type ClientCertAuthenticator struct {
+	// Identities maps the subject common name or a SAN (DNS name, email address or URI) of a certificate to an
+	// identity, without identities any verified certificate is accepted with its common name as principal
+	Identities map[string]Identity
+}
+
+// Authenticate maps the verified client certificate of the request to an identity
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	if a.Identities == nil {
+		return Identity{Name: cert.Subject.CommonName}.principal(AuthMethodClientCert), nil
+	}
+	for _, name := range certificateNames(cert) {
+		if identity, ok := a.Identities[name]; ok {
+			if identity.Name == "" {
+				identity.Name = name
+			}
+			return identity.principal(AuthMethodClientCert), nil
+		}
+	}
+	return nil, ErrUnknownClientCert
+}
+
+// certificateNames returns the common name and the SANs of a certificate
+func certificateNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+// readIdentities reads a JSON file mapping names to identities
+func readIdentities(path string) (map[string]Identity, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read identity file: %v", err)
+	}
+	var identities map[string]Identity
+	if err := json.Unmarshal(data, &identities); err != nil {
+		return nil, fmt.Errorf("cannot parse identity file %s: %v", path, err)
+	}
+	return identities, nil
+}
+
+// clientAuthTLSConfig returns a TLS config verifying client certificates issued by the CAs in TLS_CLIENT_CAFILE, it
+// returns nil if the file is not set. Requests without certificate are still accepted, so other authentication
+// methods keep working.
+func clientAuthTLSConfig() *tls.Config {
+	caFile := strings.Trim(os.Getenv("TLS_CLIENT_CAFILE"), " ")
+	if caFile == "" {
+		return nil
+	}
+	certs, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		log.Warnf("Failed to read %q client CA cert file: %v, client certificates are not requested", caFile, err)
+		return nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(certs) {
+		log.Warnf("No certs found in %q, client certificates are not requested", caFile)
+		return nil
+	}
+	return &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientCertAuthenticator(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://acme/billing")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "billing"},
+		DNSNames:       []string{"billing.acme.internal"},
+		EmailAddresses: []string{"billing@acme.com"},
+		URIs:           []*url.URL{spiffe},
+	}
+	withCert := httptest.NewRequest("GET", "/", nil)
+	withCert.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	// without identities any verified certificate is accepted
+	p, err := (&ClientCertAuthenticator{}).Authenticate(withCert)
+	if err != nil || p.Name != "billing" || p.Method != AuthMethodClientCert {
+		t.Errorf("unexpected principal %+v, error %v", p, err)
+	}
+
+	for name, expected := range map[string]string{
+		"billing.acme.internal": "billing-service",
+		"billing@acme.com":      "billing-service",
+		"spiffe://acme/billing": "billing-service",
+		"billing":               "billing-service",
+	} {
+		a := &ClientCertAuthenticator{Identities: map[string]Identity{name: {Name: "billing-service", Policies: []string{"invoices:*"}}}}
+		p, err := a.Authenticate(withCert)
+		if err != nil || p.Name != expected || !p.Claims.HasPolicy("invoices:read") {
+			t.Errorf("%s: unexpected principal %+v, error %v", name, p, err)
+		}
+	}
+
+	a := &ClientCertAuthenticator{Identities: map[string]Identity{"orders": {}}}
+	if _, err := a.Authenticate(withCert); err != ErrUnknownClientCert {
+		t.Errorf("expected ErrUnknownClientCert but got %v", err)
+	}
+	if _, err := a.Authenticate(httptest.NewRequest("GET", "/", nil)); err != ErrNoCredentials {
+		t.Errorf("expected ErrNoCredentials for a request without certificate but got %v", err)
+	}
+	unverified := httptest.NewRequest("GET", "/", nil)
+	unverified.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if _, err := a.Authenticate(unverified); err != ErrNoCredentials {
+		t.Errorf("expected ErrNoCredentials for an unverified certificate but got %v", err)
+	}
+}
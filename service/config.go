@@ -78,7 +78,8 @@ func (c *Configuration) ParseEnvironment(parseAll bool) {
 	}
 
 	// if parameters are missing, print errors and exit
-	if len(failedParameters) > 0 {
+	// the init command only registers the configuration, so values are not required yet
+	if len(failedParameters) > 0 && !initCommandGiven() {
 		msg := "Mandatory config values are missing,\nplease set the following environment variable(s):\n\n"
 		for _, fp := range failedParameters {
 			msg = msg + fp.EnvName + " - " + fp.Usage + "\n"
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestSigningMethodEdDSA(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	signed, err := jwt.NewWithClaims(SigningMethodEdDSA, jwt.MapClaims{"sub": "test"}).SignedString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.Parse(signed, func(t *jwt.Token) (interface{}, error) { return publicKey, nil })
+	if err != nil || !token.Valid {
+		t.Fatalf("expected a valid token but got %v", err)
+	}
+	if token.Method != SigningMethodEdDSA {
+		t.Errorf("expected the EdDSA signing method but got %v", token.Method.Alg())
+	}
+
+	if _, err := jwt.Parse(signed, func(t *jwt.Token) (interface{}, error) { return otherKey, nil }); err == nil {
+		t.Error("expected a token verified with another key to be invalid")
+	}
+	if _, err := jwt.Parse(signed, func(t *jwt.Token) (interface{}, error) { return []byte("secret"), nil }); err == nil {
+		t.Error("expected a token verified with a key of another type to be invalid")
+	}
+	if _, err := SigningMethodEdDSA.Sign("data", []byte("secret")); err != jwt.ErrInvalidKeyType {
+		t.Errorf("expected ErrInvalidKeyType but got %v", err)
+	}
+}
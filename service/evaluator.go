@@ -0,0 +1,94 @@
+package service
+
+import (
+	"strings"
+	"sync"
+)
+
+// policySeparator separates the segments of hierarchical policies, e.g. orders:read:123
+const policySeparator = ":"
+
+// policyWildcard is a policy segment matching any segment, at the end of a policy it matches all remaining segments
+const policyWildcard = "*"
+
+// PolicyEvaluator decides if the claims of a token grant a policy. The resource is empty if any policy group of the
+// token counts, otherwise only the groups of the resource are taken into account.
+type PolicyEvaluator interface {
+	Allowed(claims *Claims, resource string, policy string) bool
+}
+
+// PolicyEvaluatorFunc is a function implementing PolicyEvaluator
+type PolicyEvaluatorFunc func(claims *Claims, resource string, policy string) bool
+
+// Allowed calls f
+func (f PolicyEvaluatorFunc) Allowed(claims *Claims, resource string, policy string) bool {
+	return f(claims, resource, policy)
+}
+
+// WildcardPolicyEvaluator is the default PolicyEvaluator. It compares policies segment by segment with MatchPolicy,
+// so orders:* grants orders:read and orders:read:123. The keys of the policies claim are the resources the policies
+// are granted for, they may contain wildcards as well, e.g. the group * applies to every resource.
+type WildcardPolicyEvaluator struct{}
+
+// Allowed checks if a policy of the groups matching the resource grants the policy
+func (WildcardPolicyEvaluator) Allowed(claims *Claims, resource string, policy string) bool {
+	for group, granted := range claims.Policies {
+		if resource != "" && !MatchPolicy(group, resource) {
+			continue
+		}
+		for _, g := range granted {
+			if MatchPolicy(g, policy) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	policyEvaluator   PolicyEvaluator = WildcardPolicyEvaluator{}
+	policyEvaluatorMu sync.RWMutex
+)
+
+// SetPolicyEvaluator replaces the evaluator used by TokenHasAccess, PolicyRequirement and Claims, nil restores the
+// WildcardPolicyEvaluator
+func SetPolicyEvaluator(e PolicyEvaluator) {
+	if e == nil {
+		e = WildcardPolicyEvaluator{}
+	}
+	policyEvaluatorMu.Lock()
+	policyEvaluator = e
+	policyEvaluatorMu.Unlock()
+}
+
+// currentPolicyEvaluator returns the evaluator set with SetPolicyEvaluator
+func currentPolicyEvaluator() PolicyEvaluator {
+	policyEvaluatorMu.RLock()
+	defer policyEvaluatorMu.RUnlock()
+	return policyEvaluator
+}
+
+// MatchPolicy checks if a granted policy covers the required policy. A * segment of the granted policy matches any
+// single segment, a trailing * matches one or more remaining segments, all other segments have to be equal.
+func MatchPolicy(granted string, required string) bool {
+	if granted == required {
+		return true
+	}
+	g := strings.Split(granted, policySeparator)
+	r := strings.Split(required, policySeparator)
+	for i, segment := range g {
+		if i >= len(r) {
+			return false
+		}
+		if segment == policyWildcard {
+			if i == len(g)-1 {
+				return true
+			}
+			continue
+		}
+		if segment != r[i] {
+			return false
+		}
+	}
+	return len(g) == len(r)
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestMatchPolicy(t *testing.T) {
+	tests := []struct {
+		granted  string
+		required string
+		expected bool
+	}{
+		{"orders:read", "orders:read", true},
+		{"orders:read", "orders:write", false},
+		{"orders:*", "orders:read", true},
+		{"orders:*", "orders:read:123", true},
+		{"orders:*", "orders", false},
+		{"orders:read:*", "orders:read:123", true},
+		{"orders:read:*", "orders:write:123", false},
+		{"orders:*:123", "orders:read:123", true},
+		{"orders:*:123", "orders:read:456", false},
+		{"orders:*:123", "orders:read:123:items", false},
+		{"*", "orders:read", true},
+		{"orders", "orders:read", false},
+		{"orders:read", "orders", false},
+		{"", "", true},
+		{"", "orders", false},
+	}
+	for _, test := range tests {
+		if result := MatchPolicy(test.granted, test.required); result != test.expected {
+			t.Errorf("MatchPolicy(%q, %q) should be %t but was %t", test.granted, test.required, test.expected, result)
+		}
+	}
+}
+
+func TestWildcardPolicyEvaluator(t *testing.T) {
+	claims := &Claims{Policies: map[string][]string{
+		"tenants:acme":  {"orders:*"},
+		"tenants:other": {"invoices:read"},
+		"*":             {"profile:read"},
+	}}
+	tests := []struct {
+		resource string
+		policy   string
+		expected bool
+	}{
+		{"", "orders:write", true},
+		{"", "invoices:read", true},
+		{"tenants:acme", "orders:write", true},
+		{"tenants:acme", "invoices:read", false},
+		{"tenants:other", "orders:write", false},
+		{"tenants:other", "invoices:read", true},
+		{"tenants:acme", "profile:read", true},
+		{"tenants:unknown", "orders:write", false},
+	}
+	for _, test := range tests {
+		if result := claims.HasPolicyFor(test.resource, test.policy); result != test.expected {
+			t.Errorf("HasPolicyFor(%q, %q) should be %t but was %t", test.resource, test.policy, test.expected, result)
+		}
+	}
+}
+
+func TestSetPolicyEvaluator(t *testing.T) {
+	defer SetPolicyEvaluator(nil)
+	SetPolicyEvaluator(PolicyEvaluatorFunc(func(claims *Claims, resource string, policy string) bool {
+		return claims.Subject == "admin"
+	}))
+
+	if !(&Claims{Subject: "admin"}).HasPolicy("anything") {
+		t.Error("expected the custom evaluator to grant the policy")
+	}
+	if (&Claims{Subject: "user", Policies: map[string][]string{"default": {"anything"}}}).HasPolicy("anything") {
+		t.Error("expected the custom evaluator to deny the policy")
+	}
+
+	SetPolicyEvaluator(nil)
+	if !(&Claims{Policies: map[string][]string{"default": {"anything"}}}).HasPolicy("anything") {
+		t.Error("expected the default evaluator to be restored")
+	}
+}
+
+func TestTokenHasAccessTo(t *testing.T) {
+	token := &jwt.Token{Claims: jwt.MapClaims{"policies": map[string]interface{}{
+		"tenants:acme": []interface{}{"orders:read:*"},
+	}}}
+	r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	r = r.WithContext(context.WithValue(r.Context(), ctxToken, token))
+
+	if !TokenHasAccess(r, "orders:read:123") {
+		t.Error("expected access with the wildcard policy of any resource")
+	}
+	if !TokenHasAccessTo(r, "tenants:acme", "orders:read:123") {
+		t.Error("expected access to the resource")
+	}
+	if TokenHasAccessTo(r, "tenants:other", "orders:read:123") {
+		t.Error("expected no access to another resource")
+	}
+}
+
+func TestSecureHandleWithResourcePolicies(t *testing.T) {
+	s := New("testservice")
+	s.SecureHandleFuncWithPolicies("/tenants/{tenant}/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("orders"))
+	}, AnyOf("orders:read").For("tenants:{tenant}"))
+
+	token := policyTokenFor(t, map[string][]string{"tenants:acme": {"orders:*"}})
+	for path, expectedStatus := range map[string]int{
+		"/tenants/acme/orders":  http.StatusOK,
+		"/tenants/other/orders": http.StatusForbidden,
+	} {
+		r := httptest.NewRequest("GET", "http://missy.com"+path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+		if w.Code != expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", path, expectedStatus, w.Code)
+		}
+	}
+}
@@ -2,7 +2,13 @@ package service
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -11,10 +17,11 @@ import (
 	"github.com/microdevs/missy/log"
 )
 
-var pubkey *rsa.PublicKey
+// pubkey is the *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey validating tokens
+var pubkey crypto.PublicKey
 
 func init() {
-	Config().RegisterOptionalParameter("TOKEN_CA_FILE", "", "service.token.ca.file", "Set the location to the certificate used to validate the JWT tokens")
+	Config().RegisterOptionalParameter("TOKEN_CA_FILE", "", "service.token.ca.file", "Set the location to the certificate or the RSA, ECDSA or Ed25519 public key in PEM format used to validate the JWT tokens")
 	Config().Parse()
 	initPublicKey()
 }
@@ -35,7 +42,7 @@ func initPublicKey() {
 		return
 	}
 
-	pkey, err := jwt.ParseRSAPublicKeyFromPEM(pubkeyPEM)
+	pkey, err := parsePublicKeyPEM(pubkeyPEM)
 	if err != nil {
 		log.Errorf("Unable to parse public key for token auth: %s", err)
 		return
@@ -43,6 +50,46 @@ func initPublicKey() {
 	pubkey = pkey
 }
 
+// parsePublicKeyPEM returns the RSA, ECDSA or Ed25519 public key of the first PEM block, which is a PKIX public key,
+// a PKCS1 RSA public key or an X.509 certificate
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var key crypto.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		pkey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = pkey
+	case "RSA PUBLIC KEY":
+		pkey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = pkey
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
 // StartTimerHandler is a middleware to start a timer for the request benchmark
 func StartTimerHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -58,8 +105,8 @@ func StartTimerHandler(h http.Handler) http.Handler {
 func AuthHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		if pubkey == nil {
-			log.Error("Secure handler was called but public ca file is missing")
+		if !tokenKeysConfigured() {
+			log.Error("Secure handler was called but neither a public ca file, a JSON Web Key Set nor a token introspection endpoint is configured")
 			http.Error(w, "This handler is unavailable due to a configuration error", http.StatusInternalServerError)
 			return
 		}
@@ -70,17 +117,15 @@ func AuthHandler(h http.Handler) http.Handler {
 			http.Error(w, "No Authorization Bearer token found", http.StatusBadRequest)
 			return
 		}
-		token, err := jwt.Parse(reqToken, func(t *jwt.Token) (interface{}, error) {
-			return pubkey, nil
-		})
-		if err != nil {
-			log.Warnf("Invalid token: %v", err)
-			http.Error(w, "Unauthorized", http.StatusForbidden)
+		token, tokenErr := validateToken(reqToken)
+		if tokenErr != nil {
+			log.Warnf("Invalid token: %v", tokenErr)
+			writeTokenError(w, tokenErr)
 			return
 		}
 
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, ctxToken, token)
+		claims := NewClaims(token.Claims.(jwt.MapClaims))
+		ctx := WithPrincipal(r.Context(), &Principal{Name: claims.Subject, Method: AuthMethodJWT, Claims: claims, token: token})
 		r = r.WithContext(ctx)
 
 		h.ServeHTTP(w, r)
@@ -138,17 +183,25 @@ func (s *Service) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
-// readinessHandler
+// readinessHandler reports the readiness followed by the state of the registered checks and components, the service
+// is not ready if a readiness check fails
 func (s *Service) readinessHandler(w http.ResponseWriter, r *http.Request) {
 	s.StateProbes.MuReady.Lock()
-	defer s.StateProbes.MuReady.Unlock()
+	ready := s.StateProbes.IsReady
+	s.StateProbes.MuReady.Unlock()
 
-	if !s.StateProbes.IsReady {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Not Ready"))
-		return
+	report, checksPassed := s.readinessReport()
+
+	body := "Ready"
+	status := http.StatusOK
+	if !ready || !checksPassed {
+		body = "Not Ready"
+		status = http.StatusInternalServerError
+	}
+	for _, line := range report {
+		body += "\n" + line
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Ready"))
 
+	w.WriteHeader(status)
+	w.Write([]byte(body))
 }
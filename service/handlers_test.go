@@ -1,12 +1,23 @@
 package service
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -60,6 +71,59 @@ func TestSecureHandlerAuthWithNonToken(t *testing.T) {
 
 }
 
+func TestParsePublicKeyPEM(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublicKey, edPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	publicKeyPEM := func(key interface{}) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+	certificate := func(publicKey, privateKey interface{}) []byte {
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "iam"}, NotAfter: time.Now().Add(time.Hour)}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	tests := []struct {
+		name     string
+		pem      []byte
+		expected interface{}
+	}{
+		{"RSA public key", publicKeyPEM(&rsaKey.PublicKey), &rsaKey.PublicKey},
+		{"PKCS1 RSA public key", pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)}), &rsaKey.PublicKey},
+		{"ECDSA public key", publicKeyPEM(&ecKey.PublicKey), &ecKey.PublicKey},
+		{"Ed25519 public key", publicKeyPEM(edPublicKey), edPublicKey},
+		{"RSA certificate", certificate(&rsaKey.PublicKey, rsaKey), &rsaKey.PublicKey},
+		{"ECDSA certificate", certificate(&ecKey.PublicKey, ecKey), &ecKey.PublicKey},
+		{"Ed25519 certificate", certificate(edPublicKey, edPrivateKey), edPublicKey},
+	}
+	for _, test := range tests {
+		key, err := parsePublicKeyPEM(test.pem)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !test.expected.(interface{ Equal(crypto.PublicKey) bool }).Equal(key) {
+			t.Errorf("%s: expected %v but got %v", test.name, test.expected, key)
+		}
+	}
+
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	for _, data := range [][]byte{[]byte("no pem"), privateKeyPEM} {
+		if _, err := parsePublicKeyPEM(data); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
 func callWithToken(token string) *httptest.ResponseRecorder {
 	r := httptest.NewRequest("GET", "http://missy.com/test", nil)
 	r.Header.Set("Authorization", "Bearer "+token)
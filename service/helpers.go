@@ -3,7 +3,6 @@ package service
 import (
 	"errors"
 	"net/http"
-	"reflect"
 	"strings"
 
 	"github.com/microdevs/missy/log"
@@ -46,47 +45,21 @@ func RawToken(r *http.Request) (string, error) {
 
 // TokenHasAccess checks if a valid access token contains a given policy in a context
 func TokenHasAccess(r *http.Request, policy string) bool {
-	token := Token(r)
+	claims, ok := requestClaims(r.Context())
 	// return false if there is no token
-	if token == nil {
-		return false
-	}
-	// let's assume the claims are map claims because this is what our IAM delivers
-	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		log.Warn("Invalid token format: token claims are not of type jwt.MapClaims")
 		return false
 	}
-	// if the claims do not contain policies return false
-	policiesInterfaces, ok := claims["policies"].(map[string]interface{})
+	return claims.HasPolicy(policy)
+}
+
+// TokenHasAccessTo checks if a valid access token contains a given policy for a resource in a context
+func TokenHasAccessTo(r *http.Request, resource string, policy string) bool {
+	claims, ok := requestClaims(r.Context())
 	if !ok {
-		log.Warn("Invalid token format: policies inside claims are not of type map[string]interface{}")
 		return false
 	}
-
-	tokenPolicies := make(map[string][]interface{})
-
-	for k := range policiesInterfaces {
-		tokenPolicies[k], ok = policiesInterfaces[k].([]interface{})
-		if !ok {
-			log.Warn("Invalid token format: policies inside claims are not of type map[string][]interface{}")
-			return false
-		}
-	}
-	for _, policies := range tokenPolicies {
-		for _, p := range policies {
-			ps, ok := p.(string)
-			if !ok {
-				log.Warnf("Invalid token format: Policy is not of type string but %s", reflect.TypeOf(p).String())
-				continue
-			}
-			if ps == policy {
-				return true
-			}
-		}
-	}
-	// if the requested policy was not found in the context, the function returns false
-	return false
+	return claims.HasPolicyFor(resource, policy)
 }
 
 // IsRequestTokenValid checks if request has a valid token
@@ -102,15 +75,13 @@ func IsRequestTokenValid(r *http.Request) bool {
 
 // IsSignedTokenValid checks if provided signed token string is valid
 func IsSignedTokenValid(signedToken string) bool {
-	initPublicKey()
-	if pubkey == nil {
+	initTokenKeys()
+	if !tokenKeysConfigured() {
 		log.Error("No public key is set to validate the token.")
 		return false
 	}
 
-	token, err := jwt.Parse(signedToken, func(token *jwt.Token) (interface{}, error) {
-		return pubkey, nil
-	})
+	token, err := validateToken(signedToken)
 
 	if err != nil {
 		log.Warnf("Cannot parse jwt token: %v", err)
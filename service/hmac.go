@@ -0,0 +1,188 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HMACScheme is the authorization scheme of HMAC signed requests:
+// Authorization: HMAC-SHA256 keyId="<id>", signature="<base64 signature>"
+const HMACScheme = "HMAC-SHA256"
+
+// DefaultHMACClockSkew is the maximum difference between the Date header of a signed request and the server time
+const DefaultHMACClockSkew = time.Minute * 5
+
+// DefaultHMACMaxBodySize is the largest body of a signed request which is read to verify the signature
+const DefaultHMACMaxBodySize = 10 << 20
+
+// errors of HMAC signed requests
+var (
+	ErrInvalidHMACSignature = errors.New("invalid HMAC signature")
+	ErrUnknownHMACKey       = errors.New("request is signed with an unknown key")
+)
+
+// HMACKey is an entry of an HMAC key file, Secret is base64 encoded
+type HMACKey struct {
+	Identity
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// hmacKey is a decoded HMAC key
+type hmacKey struct {
+	secret   []byte
+	identity Identity
+}
+
+// HMACAuthenticator authenticates requests signed with a shared secret, see SignRequest. The signature covers the
+// method, the request URI, the Date header and the body, requests with a Date outside of MaxClockSkew are rejected.
+// There is no nonce, so a captured request can be replayed as long as its Date is within MaxClockSkew. Use TLS and
+// make the handlers of signed requests idempotent, e.g. with an idempotency key in the body.
+type HMACAuthenticator struct {
+	// MaxClockSkew defaults to DefaultHMACClockSkew
+	MaxClockSkew time.Duration
+	// MaxBodySize defaults to DefaultHMACMaxBodySize, requests with a larger body are rejected
+	MaxBodySize int64
+
+	keys map[string]hmacKey
+}
+
+// NewHMACAuthenticator returns an authenticator accepting requests signed with the keys
+func NewHMACAuthenticator(keys ...HMACKey) (*HMACAuthenticator, error) {
+	a := &HMACAuthenticator{MaxClockSkew: DefaultHMACClockSkew, MaxBodySize: DefaultHMACMaxBodySize, keys: make(map[string]hmacKey, len(keys))}
+	for _, k := range keys {
+		if k.ID == "" {
+			return nil, errors.New("HMAC key without id")
+		}
+		secret, err := base64.StdEncoding.DecodeString(k.Secret)
+		if err != nil || len(secret) < 32 {
+			return nil, fmt.Errorf("HMAC key %s has to be a base64 encoded secret of at least 32 bytes", k.ID)
+		}
+		if k.Name == "" {
+			k.Name = k.ID
+		}
+		a.keys[k.ID] = hmacKey{secret: secret, identity: k.Identity}
+	}
+	return a, nil
+}
+
+// NewHMACAuthenticatorFromFile returns an authenticator accepting the keys of a JSON file, e.g.
+// [{"id": "partner-1", "secret": "<base64>", "name": "partner", "policies": ["orders:read"]}]
+func NewHMACAuthenticatorFromFile(path string) (*HMACAuthenticator, error) {
+	if path == "" {
+		return nil, errors.New("no HMAC key file configured, set AUTH_HMAC_KEYS_FILE")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read HMAC key file: %v", err)
+	}
+	var keys []HMACKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("cannot parse HMAC key file %s: %v", path, err)
+	}
+	return NewHMACAuthenticator(keys...)
+}
+
+// Authenticate verifies the signature of the request
+func (a *HMACAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	keyID, signature, ok := parseHMACAuthorization(r.Header.Get("Authorization"))
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	key, ok := a.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownHMACKey
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return nil, fmt.Errorf("signed request has no valid Date header: %v", err)
+	}
+	skew := a.MaxClockSkew
+	if skew <= 0 {
+		skew = DefaultHMACClockSkew
+	}
+	if d := time.Since(date); d > skew || d < -skew {
+		return nil, fmt.Errorf("Date header %s of signed request is outside of the allowed clock skew", date)
+	}
+
+	maxBodySize := a.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultHMACMaxBodySize
+	}
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+	}
+	expected, err := hmacSignature(r, key.secret)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(signature, expected) {
+		return nil, ErrInvalidHMACSignature
+	}
+	return key.identity.principal(AuthMethodHMAC), nil
+}
+
+// SignRequest signs a request for an HMACAuthenticator, it sets the Date header if it is missing
+func SignRequest(r *http.Request, keyID string, secret []byte) error {
+	if r.Header.Get("Date") == "" {
+		r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	signature, err := hmacSignature(r, secret)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", fmt.Sprintf(`%s keyId=%q, signature=%q`, HMACScheme, keyID, base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+// hmacSignature signs the method, request URI, Date header and the SHA-256 hash of the body, the body is restored
+// after reading it
+func hmacSignature(r *http.Request, secret []byte) ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read request body: %v", err)
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n" + r.Header.Get("Date") + "\n" + hex.EncodeToString(bodyHash[:])))
+	return mac.Sum(nil), nil
+}
+
+// parseHMACAuthorization returns the key id and the signature of an HMAC authorization header
+func parseHMACAuthorization(header string) (keyID string, signature []byte, ok bool) {
+	if !strings.HasPrefix(header, HMACScheme+" ") {
+		return "", nil, false
+	}
+	for _, param := range strings.Split(strings.TrimPrefix(header, HMACScheme+" "), ",") {
+		parts := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(parts[1], `"`)
+		switch parts[0] {
+		case "keyId":
+			keyID = value
+		case "signature":
+			signature, _ = base64.StdEncoding.DecodeString(value)
+		}
+	}
+	return keyID, signature, keyID != "" && len(signature) > 0
+}
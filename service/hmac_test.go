@@ -0,0 +1,91 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHMACAuthenticator(t *testing.T) {
+	secret := bytes.Repeat([]byte{7}, 32)
+	a, err := NewHMACAuthenticator(HMACKey{Identity: Identity{Name: "partner", Policies: []string{"orders:write"}}, ID: "partner-1", Secret: base64.StdEncoding.EncodeToString(secret)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := func(body string, date time.Time, keyID string, key []byte) *http.Request {
+		r := httptest.NewRequest("POST", "http://missy.com/orders?tenant=acme", bytes.NewBufferString(body))
+		r.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+		if err := SignRequest(r, keyID, key); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r := signed(`{"id": 1}`, time.Now(), "partner-1", secret)
+	p, err := a.Authenticate(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Name != "partner" || p.Method != AuthMethodHMAC || !p.Claims.HasPolicy("orders:write") {
+		t.Errorf("unexpected principal %+v", p)
+	}
+	if body, _ := ioutil.ReadAll(r.Body); string(body) != `{"id": 1}` {
+		t.Errorf("expected the body to be restored but got %q", body)
+	}
+
+	tampered := signed(`{"id": 1}`, time.Now(), "partner-1", secret)
+	tampered.Body = ioutil.NopCloser(bytes.NewBufferString(`{"id": 2}`))
+	tamperedURL := signed(`{"id": 1}`, time.Now(), "partner-1", secret)
+	tamperedURL.URL.RawQuery = "tenant=other"
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		err     error
+	}{
+		{"tampered body", tampered, ErrInvalidHMACSignature},
+		{"tampered query", tamperedURL, ErrInvalidHMACSignature},
+		{"wrong secret", signed("", time.Now(), "partner-1", bytes.Repeat([]byte{8}, 32)), ErrInvalidHMACSignature},
+		{"unknown key", signed("", time.Now(), "partner-2", secret), ErrUnknownHMACKey},
+		{"no signature", httptest.NewRequest("GET", "/", nil), ErrNoCredentials},
+	}
+	for _, test := range tests {
+		if _, err := a.Authenticate(test.request); err != test.err {
+			t.Errorf("%s: expected %v but got %v", test.name, test.err, err)
+		}
+	}
+
+	if _, err := a.Authenticate(signed("", time.Now().Add(-10*time.Minute), "partner-1", secret)); err == nil {
+		t.Error("expected an error for a request outside of the clock skew")
+	}
+}
+
+func TestHMACAuthenticator_MaxBodySize(t *testing.T) {
+	secret := bytes.Repeat([]byte{7}, 32)
+	a, err := NewHMACAuthenticator(HMACKey{ID: "partner-1", Secret: base64.StdEncoding.EncodeToString(secret)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.MaxBodySize = 16
+
+	for body, valid := range map[string]bool{`{"id": 1}`: true, `{"id": 1, "name": "too large"}`: false} {
+		r := httptest.NewRequest("POST", "http://missy.com/orders", bytes.NewBufferString(body))
+		if err := SignRequest(r, "partner-1", secret); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Authenticate(r); (err == nil) != valid {
+			t.Errorf("%s: expected valid %t but got %v", body, valid, err)
+		}
+	}
+}
+
+func TestNewHMACAuthenticator_ShortSecret(t *testing.T) {
+	if _, err := NewHMACAuthenticator(HMACKey{ID: "short", Secret: base64.StdEncoding.EncodeToString([]byte("short"))}); err == nil {
+		t.Error("expected an error for a short secret")
+	}
+}
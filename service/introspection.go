@@ -0,0 +1,192 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/microdevs/missy/log"
+)
+
+// reasons of a failed token introspection in addition to the Token* reasons of the validation
+const (
+	TokenInactive             = "inactive"
+	TokenIntrospectionFailed  = "introspection_failed"
+	defaultIntrospectionCache = time.Minute * 5
+	introspectionCacheSize    = 10000
+)
+
+// ErrTokenInactive is returned when the introspection endpoint reports a token as not active
+var ErrTokenInactive = errors.New("token is not active")
+
+var (
+	introspector     *Introspector
+	introspectorOnce sync.Once
+)
+
+func init() {
+	Config().RegisterOptionalParameter("TOKEN_INTROSPECTION_URL", "", "service.token.introspection.url", "The OAuth2 token introspection endpoint (RFC 7662) used to validate opaque tokens")
+	Config().RegisterOptionalParameter("TOKEN_INTROSPECTION_CLIENT_ID", "", "service.token.introspection.client.id", "The client id authenticating the service at the token introspection endpoint")
+	Config().RegisterOptionalParameter("TOKEN_INTROSPECTION_CLIENT_SECRET", "", "service.token.introspection.client.secret", "The client secret authenticating the service at the token introspection endpoint")
+	Config().RegisterOptionalParameter("TOKEN_INTROSPECTION_CACHE_TIME", defaultIntrospectionCache.String(), "service.token.introspection.cache.time", "The maximum time an active introspection response is cached, it is never cached beyond the expiry of the token")
+	Config().Parse()
+}
+
+// introspection is a cached response of the introspection endpoint
+type introspection struct {
+	claims  jwt.MapClaims
+	expires time.Time
+}
+
+// Introspector validates opaque tokens at an OAuth2 token introspection endpoint as defined in RFC 7662. Active
+// responses are cached until the token expires, at most for MaxCacheTime.
+type Introspector struct {
+	url          string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	// MaxCacheTime limits how long an active token is cached, 0 disables the cache
+	MaxCacheTime time.Duration
+
+	cache map[[sha256.Size]byte]introspection
+	mu    sync.Mutex
+}
+
+// NewIntrospector returns an introspector calling the endpoint with the client credentials
+func NewIntrospector(endpoint string, clientID string, clientSecret string, client *http.Client) *Introspector {
+	return &Introspector{
+		url:          endpoint,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       client,
+		MaxCacheTime: defaultIntrospectionCache,
+		cache:        make(map[[sha256.Size]byte]introspection),
+	}
+}
+
+// Introspect returns the claims of an active token, ErrTokenInactive is returned for tokens which are expired,
+// revoked or unknown to the authorization server
+func (i *Introspector) Introspect(token string) (jwt.MapClaims, error) {
+	key := sha256.Sum256([]byte(token))
+	if claims, ok := i.cached(key); ok {
+		return claims, nil
+	}
+
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(i.clientID), url.QueryEscape(i.clientSecret))
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot call introspection endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned status %d", resp.StatusCode)
+	}
+
+	claims := jwt.MapClaims{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("cannot parse introspection response: %v", err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrTokenInactive
+	}
+	i.store(key, claims)
+	return claims, nil
+}
+
+// cached returns the claims of a token introspected before which did not expire yet
+func (i *Introspector) cached(key [sha256.Size]byte) (jwt.MapClaims, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entry, ok := i.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(i.cache, key)
+		return nil, false
+	}
+	return entry.claims, true
+}
+
+// store caches the claims of an active token until it expires, at most for MaxCacheTime
+func (i *Introspector) store(key [sha256.Size]byte, claims jwt.MapClaims) {
+	if i.MaxCacheTime <= 0 {
+		return
+	}
+	now := time.Now()
+	expires := now.Add(i.MaxCacheTime)
+	if exp, ok := numericDate(claims, "exp"); ok && exp.Before(expires) {
+		expires = exp
+	}
+	if !now.Before(expires) {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.cache) >= introspectionCacheSize {
+		for k, entry := range i.cache {
+			if !now.Before(entry.expires) {
+				delete(i.cache, k)
+			}
+		}
+		if len(i.cache) >= introspectionCacheSize {
+			return
+		}
+	}
+	i.cache[key] = introspection{claims: claims, expires: expires}
+}
+
+// initIntrospection sets up the introspector configured in TOKEN_INTROSPECTION_URL once
+func initIntrospection() {
+	introspectorOnce.Do(func() {
+		endpoint := Config().Get("service.token.introspection.url")
+		if endpoint == "" {
+			return
+		}
+		i := NewIntrospector(endpoint, Config().Get("service.token.introspection.client.id"), Config().Get("service.token.introspection.client.secret"), NewClient())
+		cacheTime, err := time.ParseDuration(Config().Get("service.token.introspection.cache.time"))
+		if err != nil || cacheTime < 0 {
+			log.Debugf("Setting token introspection cache time to %v, as service.token.introspection.cache.time was not a valid duration", defaultIntrospectionCache)
+			cacheTime = defaultIntrospectionCache
+		}
+		i.MaxCacheTime = cacheTime
+		introspector = i
+	})
+}
+
+// introspectToken validates an opaque token with the introspector and returns it as a valid token with the claims
+// of the introspection response, so Token and TokenClaims work for opaque tokens as well
+func (v tokenValidation) introspectToken(i *Introspector, rawToken string) (*jwt.Token, *TokenError) {
+	claims, err := i.Introspect(rawToken)
+	if err == ErrTokenInactive {
+		return nil, &TokenError{Reason: TokenInactive, Err: err}
+	}
+	if err != nil {
+		return nil, &TokenError{Reason: TokenIntrospectionFailed, Err: err}
+	}
+	if err := v.validateClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return &jwt.Token{Raw: rawToken, Header: map[string]interface{}{}, Claims: claims, Valid: true}, nil
+}
+
+// isJWT checks if a token has the three segments of a signed JWT
+func isJWT(rawToken string) bool {
+	return strings.Count(rawToken, ".") == 2
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// introspectionServer answers introspection requests for the active tokens and counts the requests
+type introspectionServer struct {
+	*httptest.Server
+	active   map[string]map[string]interface{}
+	requests int
+	mu       sync.Mutex
+}
+
+func newIntrospectionServer(t *testing.T) *introspectionServer {
+	s := &introspectionServer{active: make(map[string]map[string]interface{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		s.mu.Unlock()
+
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.PostFormValue("token_type_hint") != "access_token" {
+			t.Errorf("unexpected introspection request %s %v", r.Method, r.PostForm)
+		}
+		response := map[string]interface{}{"active": false}
+		if claims, ok := s.active[r.PostFormValue("token")]; ok {
+			response = map[string]interface{}{"active": true}
+			for k, v := range claims {
+				response[k] = v
+			}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	return s
+}
+
+func (s *introspectionServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestIntrospector_Introspect(t *testing.T) {
+	server := newIntrospectionServer(t)
+	defer server.Close()
+	server.active["opaque"] = map[string]interface{}{"sub": "partner-1", "exp": time.Now().Add(time.Hour).Unix()}
+	server.active["expiring"] = map[string]interface{}{"sub": "partner-2", "exp": time.Now().Add(-time.Second).Unix()}
+
+	i := NewIntrospector(server.URL, "client", "secret", http.DefaultClient)
+	for n := 0; n < 3; n++ {
+		claims, err := i.Introspect("opaque")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if claims["sub"] != "partner-1" {
+			t.Errorf("unexpected claims %v", claims)
+		}
+	}
+	if n := server.requestCount(); n != 1 {
+		t.Errorf("expected the active token to be cached, but the endpoint was called %d times", n)
+	}
+
+	// tokens are not cached beyond their expiry
+	i.Introspect("expiring")
+	i.Introspect("expiring")
+	if n := server.requestCount(); n != 3 {
+		t.Errorf("expected an expired token not to be cached, but the endpoint was called %d times", n)
+	}
+
+	for n := 0; n < 2; n++ {
+		if _, err := i.Introspect("unknown"); err != ErrTokenInactive {
+			t.Errorf("expected ErrTokenInactive but got %v", err)
+		}
+	}
+	if n := server.requestCount(); n != 5 {
+		t.Errorf("expected inactive tokens not to be cached, but the endpoint was called %d times", n)
+	}
+
+	if _, err := NewIntrospector(server.URL, "client", "wrong", http.DefaultClient).Introspect("opaque"); err == nil || err == ErrTokenInactive {
+		t.Errorf("expected an error for wrong client credentials but got %v", err)
+	}
+}
+
+func TestSecureHandlerAuthWithOpaqueToken(t *testing.T) {
+	server := newIntrospectionServer(t)
+	defer server.Close()
+	server.active["opaque"] = map[string]interface{}{"sub": "partner-1", "policies": map[string]interface{}{"default": []interface{}{"orders:read"}}}
+	introspector = NewIntrospector(server.URL, "client", "secret", http.DefaultClient)
+	defer func() { introspector = nil }()
+
+	s := New("testservice")
+	s.SecureHandleFuncWithPolicies("/orders", func(w http.ResponseWriter, r *http.Request) {
+		if !IsRequestTokenValid(r) {
+			t.Error("expected a valid token in the context")
+		}
+		w.Write([]byte(Token(r).Raw + " " + TokenClaims(r)["sub"].(string)))
+	}, AnyOf("orders:read"))
+
+	signed := policyToken(t, "orders:read")
+	tests := []struct {
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"opaque", http.StatusOK, "opaque partner-1"},
+		{"revoked", http.StatusForbidden, ""},
+		{signed, http.StatusOK, signed + " test@test.de"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "http://missy.com/orders", nil)
+		r.Header.Set("Authorization", "Bearer "+test.token)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+		if w.Code != test.expectedStatus {
+			t.Errorf("expected status %d but got %d", test.expectedStatus, w.Code)
+		}
+		if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+			t.Errorf("expected body %q but got %q", test.expectedBody, w.Body)
+		}
+	}
+	if failures := countFailures(TokenInactive); failures < 1 {
+		t.Error("expected the inactive token to be counted")
+	}
+	if n := server.requestCount(); n != 2 {
+		t.Errorf("expected signed tokens to be validated locally, but the endpoint was called %d times", n)
+	}
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/microdevs/missy/log"
+)
+
+const defaultJWKSRefreshInterval = time.Minute * 15
+
+// DefaultJWKSRefetchInterval is the minimum time between two fetches of a JWKS triggered by unknown key ids
+const DefaultJWKSRefetchInterval = time.Second * 30
+
+// ErrUnknownKeyID is returned when a token is signed with a key which is not in the key set
+var ErrUnknownKeyID = errors.New("token is signed with an unknown key")
+
+var (
+	jwks     *JWKS
+	jwksOnce sync.Once
+)
+
+func init() {
+	Config().RegisterOptionalParameter("TOKEN_JWKS_URL", "", "service.token.jwks.url", "The URL of the JSON Web Key Set used to validate the JWT tokens, takes precedence over TOKEN_CA_FILE")
+	Config().RegisterOptionalParameter("TOKEN_JWKS_FILE", "", "service.token.jwks.file", "A file with the JSON Web Key Set used to validate the JWT tokens, takes precedence over TOKEN_CA_FILE")
+	Config().RegisterOptionalParameter("TOKEN_JWKS_REFRESH_INTERVAL", defaultJWKSRefreshInterval.String(), "service.token.jwks.refresh.interval", "The time after which the JSON Web Key Set is fetched again")
+	Config().Parse()
+}
+
+// jwk is a JSON Web Key as defined in RFC 7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// JWKS is a JSON Web Key Set which is read from a URL or a file. The keys are looked up by the kid header of a
+// token, so several keys can be active at the same time while the signing key is rotated. The key set is fetched
+// again in the background and when a token refers to an unknown key, at most once per RefetchInterval.
+type JWKS struct {
+	fetch func() ([]byte, error)
+	// RefetchInterval limits how often unknown key ids trigger a fetch, defaults to DefaultJWKSRefetchInterval
+	RefetchInterval time.Duration
+
+	keys      map[string]interface{}
+	lastFetch time.Time
+	mu        sync.RWMutex
+	fetchMu   sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewJWKSFromURL returns a key set fetched from the URL with the client
+func NewJWKSFromURL(url string, client *http.Client) *JWKS {
+	return newJWKS(func() ([]byte, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %s returned status %d", url, resp.StatusCode)
+		}
+		return ioutil.ReadAll(resp.Body)
+	})
+}
+
+// NewJWKSFromFile returns a key set read from a file
+func NewJWKSFromFile(path string) *JWKS {
+	return newJWKS(func() ([]byte, error) {
+		return ioutil.ReadFile(path)
+	})
+}
+
+func newJWKS(fetch func() ([]byte, error)) *JWKS {
+	return &JWKS{
+		fetch:           fetch,
+		RefetchInterval: DefaultJWKSRefetchInterval,
+		keys:            make(map[string]interface{}),
+		done:            make(chan struct{}),
+	}
+}
+
+// Refresh fetches the key set and replaces the keys, the old keys are kept if fetching fails
+func (j *JWKS) Refresh() error {
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+	return j.refresh()
+}
+
+func (j *JWKS) refresh() error {
+	j.mu.Lock()
+	j.lastFetch = time.Now()
+	j.mu.Unlock()
+
+	data, err := j.fetch()
+	if err != nil {
+		return fmt.Errorf("cannot fetch key set: %v", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+	return nil
+}
+
+// StartRefresh fetches the key set in the given interval until the key set is closed
+func (j *JWKS) StartRefresh(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := j.Refresh(); err != nil {
+					log.Errorf("Unable to refresh the JSON Web Key Set for token auth: %v", err)
+				}
+			case <-j.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops refreshing the key set in the background
+func (j *JWKS) Close() error {
+	j.closeOnce.Do(func() {
+		close(j.done)
+	})
+	return nil
+}
+
+// Key returns the key with the given id, an unknown id fetches the key set again unless it was fetched within the
+// RefetchInterval
+func (j *JWKS) Key(kid string) (interface{}, error) {
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+	// the key may have been fetched while waiting for the lock
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	j.mu.RLock()
+	recently := time.Since(j.lastFetch) < j.RefetchInterval
+	j.mu.RUnlock()
+	if recently {
+		return nil, ErrUnknownKeyID
+	}
+	if err := j.refresh(); err != nil {
+		log.Errorf("Unable to fetch the JSON Web Key Set for unknown key %s: %v", kid, err)
+		return nil, ErrUnknownKeyID
+	}
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKeyID
+}
+
+// Keyfunc returns the key for the kid header of the token, tokens without kid are accepted if the set has one key
+func (j *JWKS) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		j.mu.RLock()
+		defer j.mu.RUnlock()
+		if len(j.keys) != 1 {
+			return nil, errors.New("token has no kid header")
+		}
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+	return j.Key(kid)
+}
+
+func (j *JWKS) lookup(kid string) (interface{}, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// parseJWKS parses the signing keys of a key set by key id, keys of unsupported types are skipped
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("cannot parse key set: %v", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Warnf("Skipping key %s of the JSON Web Key Set: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// publicKey returns the public key of a JWK
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %v", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %v", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %v", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %v", err)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %v", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key size %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// initJWKS sets up the key set configured in TOKEN_JWKS_URL or TOKEN_JWKS_FILE once and starts refreshing it
+func initJWKS() {
+	jwksOnce.Do(func() {
+		var set *JWKS
+		if url := Config().Get("service.token.jwks.url"); url != "" {
+			set = NewJWKSFromURL(url, NewClient())
+		} else if file := Config().Get("service.token.jwks.file"); file != "" {
+			set = NewJWKSFromFile(file)
+		} else {
+			return
+		}
+
+		if err := set.Refresh(); err != nil {
+			// unknown keys are fetched again on demand
+			log.Errorf("Unable to load the JSON Web Key Set for token auth: %v", err)
+		}
+		interval, err := time.ParseDuration(Config().Get("service.token.jwks.refresh.interval"))
+		if interval <= 0 || err != nil {
+			log.Debugf("Setting jwks refresh interval to %v, as service.token.jwks.refresh.interval was not a positive duration", defaultJWKSRefreshInterval)
+			interval = defaultJWKSRefreshInterval
+		}
+		set.StartRefresh(interval)
+		jwks = set
+	})
+}
+
+// initTokenKeys sets up the keys validating tokens, a configured JWKS takes precedence over TOKEN_CA_FILE, and the
+// introspection endpoint for opaque tokens
+func initTokenKeys() {
+	initJWKS()
+	if jwks == nil {
+		initPublicKey()
+	}
+	initIntrospection()
+}
+
+// tokenKeysConfigured checks if tokens can be validated
+func tokenKeysConfigured() bool {
+	return jwks != nil || pubkey != nil || introspector != nil
+}
+
+// tokenKey is the jwt.Keyfunc returning the key which validates a token
+func tokenKey(t *jwt.Token) (interface{}, error) {
+	if jwks != nil {
+		return jwks.Keyfunc(t)
+	}
+	if pubkey != nil {
+		return pubkey, nil
+	}
+	return nil, errors.New("no key to validate tokens configured")
+}
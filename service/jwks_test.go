@@ -0,0 +1,232 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// jwksServer serves a key set which can be changed by the test and counts the requests
+type jwksServer struct {
+	*httptest.Server
+	keys     map[string]*rsa.PrivateKey
+	requests int
+	mu       sync.Mutex
+}
+
+func newJWKSServer() *jwksServer {
+	s := &jwksServer{keys: make(map[string]*rsa.PrivateKey)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		w.Write(jwksJSON(s.keys))
+	}))
+	return s
+}
+
+func (s *jwksServer) addKey(t *testing.T, kid string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.keys[kid] = key
+	s.mu.Unlock()
+	return key
+}
+
+func (s *jwksServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func jwksJSON(keys map[string]*rsa.PrivateKey) []byte {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, _ := json.Marshal(set)
+	return data
+}
+
+func signedToken(t *testing.T, key *rsa.PrivateKey, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"username": "test@test.de"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWKS_KeyRotation(t *testing.T) {
+	server := newJWKSServer()
+	defer server.Close()
+	key1 := server.addKey(t, "key-1")
+
+	set := NewJWKSFromURL(server.URL, server.Client())
+	if err := set.Refresh(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := jwt.Parse(signedToken(t, key1, "key-1"), set.Keyfunc); err != nil {
+		t.Errorf("Expected token of key-1 to be valid, got %v", err)
+	}
+
+	// the rotated key is unknown within the refetch interval
+	key2 := server.addKey(t, "key-2")
+	if _, err := jwt.Parse(signedToken(t, key2, "key-2"), set.Keyfunc); err == nil {
+		t.Error("Expected the new key not to be fetched within the refetch interval")
+	}
+
+	set.RefetchInterval = 0
+	if _, err := jwt.Parse(signedToken(t, key2, "key-2"), set.Keyfunc); err != nil {
+		t.Errorf("Expected the unknown key to be fetched, got %v", err)
+	}
+	if _, err := jwt.Parse(signedToken(t, key1, "key-1"), set.Keyfunc); err != nil {
+		t.Errorf("Expected both keys to be active, got %v", err)
+	}
+	if requests := server.requestCount(); requests != 2 {
+		t.Errorf("Expected 2 requests to the key set, got %d", requests)
+	}
+}
+
+func TestJWKS_RefetchIsRateLimited(t *testing.T) {
+	server := newJWKSServer()
+	defer server.Close()
+	key := server.addKey(t, "key-1")
+
+	set := NewJWKSFromURL(server.URL, server.Client())
+	set.Refresh()
+	for i := 0; i < 10; i++ {
+		jwt.Parse(signedToken(t, key, "unknown"), set.Keyfunc)
+	}
+	if requests := server.requestCount(); requests != 1 {
+		t.Errorf("Expected unknown keys not to fetch the key set again, got %d requests", requests)
+	}
+}
+
+func TestJWKS_StartRefresh(t *testing.T) {
+	server := newJWKSServer()
+	defer server.Close()
+	server.addKey(t, "key-1")
+
+	set := NewJWKSFromURL(server.URL, server.Client())
+	set.StartRefresh(time.Millisecond * 10)
+	time.Sleep(time.Millisecond * 50)
+	set.Close()
+	// a refresh may be running while closing
+	time.Sleep(time.Millisecond * 20)
+
+	if _, ok := set.lookup("key-1"); !ok {
+		t.Error("Expected the key set to be fetched in the background")
+	}
+	requests := server.requestCount()
+	time.Sleep(time.Millisecond * 30)
+	if server.requestCount() != requests {
+		t.Error("Expected refreshing to stop after Close")
+	}
+}
+
+func TestJWKS_File(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	file, err := ioutil.TempFile("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Write(jwksJSON(map[string]*rsa.PrivateKey{"key-1": key}))
+	file.Close()
+
+	set := NewJWKSFromFile(file.Name())
+	if err := set.Refresh(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// a single key is used for tokens without kid
+	if _, err := jwt.Parse(signedToken(t, key, ""), set.Keyfunc); err != nil {
+		t.Errorf("Expected token without kid to be valid, got %v", err)
+	}
+}
+
+func TestParseJWKS_ECAndOKPKeys(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	set := map[string][]jwk{"keys": {
+		{Kty: "EC", Kid: "ec", Crv: "P-256", X: base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()), Y: base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes())},
+		{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(edKey)},
+		{Kty: "EC", Kid: "off-curve", Crv: "P-256", X: "AQ", Y: "AQ"},
+		{Kty: "OKP", Kid: "x25519", Crv: "X25519", X: base64.RawURLEncoding.EncodeToString(edKey)},
+	}}
+	data, _ := json.Marshal(set)
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("Expected invalid points and unsupported curves to be skipped, got %v", keys)
+	}
+	if key, ok := keys["ec"].(*ecdsa.PublicKey); !ok || key.X.Cmp(ecKey.X) != 0 || key.Y.Cmp(ecKey.Y) != 0 {
+		t.Errorf("Expected the ECDSA public key, got %v", keys["ec"])
+	}
+	if key, ok := keys["ed"].(ed25519.PublicKey); !ok || !key.Equal(edKey) {
+		t.Errorf("Expected the Ed25519 public key, got %v", keys["ed"])
+	}
+}
+
+func TestParseJWKS_SkipsUnsupportedKeys(t *testing.T) {
+	keys, err := parseJWKS([]byte(`{"keys":[{"kty":"oct","kid":"secret"},{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"}]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Expected unsupported and encryption keys to be skipped, got %v", keys)
+	}
+	if _, err := parseJWKS([]byte("no json")); err == nil {
+		t.Error("Expected an error for an invalid key set")
+	}
+}
+
+func TestSecureHandlerAuthWithJWKS(t *testing.T) {
+	server := newJWKSServer()
+	defer server.Close()
+	key := server.addKey(t, "key-1")
+
+	set := NewJWKSFromURL(server.URL, server.Client())
+	set.Refresh()
+	jwks = set
+	defer func() { jwks = nil }()
+
+	if w := callWithToken(signedToken(t, key, "key-1")); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a token signed with a key of the set, got %d", w.Code)
+	}
+	// the key of TOKEN_CA_FILE is not used anymore
+	if w := callWithToken(generateSignedTokenString(t)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a token signed with another key, got %d", w.Code)
+	}
+}
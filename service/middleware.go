@@ -22,6 +22,8 @@ func (p *PolicyManager) PolicyValidInRequest(policy string, req *http.Request) e
 }
 
 // TokenPolicies returns all policies from the token in HTTP request.
+//
+// Deprecated: use the Policies of ClaimsFrom(req.Context())
 func (p *PolicyManager) TokenPolicies(req *http.Request) (map[string]interface{}, bool) {
 	policiesRaw, found := TokenClaims(req)[tokenClaimsPoliciesKey]
 	if !found {
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/microdevs/missy/log"
+)
+
+const contentTypeProblemJSON = "application/problem+json"
+
+// PolicyRequirement declares the policies a token needs to access a route, it is satisfied if the token has at least
+// one of the AnyOf policies and all of the AllOf policies. With a Resource only the policies granted for the resource
+// count, it may refer to route variables, e.g. tenants:{tenant}.
+type PolicyRequirement struct {
+	AnyOf    []string `json:"anyOf,omitempty"`
+	AllOf    []string `json:"allOf,omitempty"`
+	Resource string   `json:"resource,omitempty"`
+}
+
+// AnyOf returns a requirement which is satisfied by a token with at least one of the policies
+func AnyOf(policies ...string) PolicyRequirement {
+	return PolicyRequirement{AnyOf: policies}
+}
+
+// AllOf returns a requirement which is satisfied by a token with all of the policies
+func AllOf(policies ...string) PolicyRequirement {
+	return PolicyRequirement{AllOf: policies}
+}
+
+// For returns a copy of the requirement which only counts the policies granted for the resource
+func (p PolicyRequirement) For(resource string) PolicyRequirement {
+	p.Resource = resource
+	return p
+}
+
+// SatisfiedBy checks the policies of the token in the request
+func (p PolicyRequirement) SatisfiedBy(r *http.Request) bool {
+	claims, ok := requestClaims(r.Context())
+	if !ok {
+		return false
+	}
+	resource := p.resource(r)
+	for _, policy := range p.AllOf {
+		if !claims.HasPolicyFor(resource, policy) {
+			return false
+		}
+	}
+	if len(p.AnyOf) == 0 {
+		return true
+	}
+	for _, policy := range p.AnyOf {
+		if claims.HasPolicyFor(resource, policy) {
+			return true
+		}
+	}
+	return false
+}
+
+// resource replaces the route variables in the resource with the values of the request
+func (p PolicyRequirement) resource(r *http.Request) string {
+	resource := p.Resource
+	for name, value := range Vars(r) {
+		resource = strings.Replace(resource, "{"+name+"}", value, -1)
+	}
+	return resource
+}
+
+// String describes the requirement, e.g. "any of [a b] and all of [c]"
+func (p PolicyRequirement) String() string {
+	var parts []string
+	if len(p.AnyOf) > 0 {
+		parts = append(parts, fmt.Sprintf("any of %v", p.AnyOf))
+	}
+	if len(p.AllOf) > 0 {
+		parts = append(parts, fmt.Sprintf("all of %v", p.AllOf))
+	}
+	description := strings.Join(parts, " and ")
+	if p.Resource != "" {
+		description += " for " + p.Resource
+	}
+	return description
+}
+
+// PolicyHandler returns a middleware which rejects requests with 403 unless the token satisfies all requirements.
+// It reads the token stored by AuthHandler, so it has to follow AuthHandler in the chain.
+func PolicyHandler(requirements ...PolicyRequirement) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, requirement := range requirements {
+				if !requirement.SatisfiedBy(r) {
+					log.Warnf("Access to %s denied, the token does not have %s", r.URL.Path, requirement)
+					writeProblem(w, http.StatusForbidden, "The token does not satisfy the required policies: "+requirement.String())
+					return
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Problem is the body of an error response as defined in RFC 7807
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// writeProblem writes an application/problem+json response
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	body, _ := json.Marshal(Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail})
+	w.Header().Set("Content-Type", contentTypeProblemJSON)
+	w.WriteHeader(status)
+	w.Write(body)
+}
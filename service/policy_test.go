@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// policyToken returns a token signed with the test fixture key which has the policies in the default group
+func policyToken(t *testing.T, policies ...string) string {
+	return policyTokenFor(t, map[string][]string{"default": policies})
+}
+
+// policyTokenFor returns a token signed with the test fixture key which has the policies by group
+func policyTokenFor(t *testing.T, groups map[string][]string) string {
+	data, err := ioutil.ReadFile("test-fixtures/key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies := make(map[string]interface{}, len(groups))
+	for group, list := range groups {
+		values := make([]interface{}, len(list))
+		for i, p := range list {
+			values[i] = p
+		}
+		policies[group] = values
+	}
+	claims := jwt.MapClaims{"sub": "test@test.de", "policies": policies}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestSecureHandleWithPolicies(t *testing.T) {
+	s := New("testservice")
+	s.SecureHandleFuncWithPolicies("/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("orders"))
+	}, AnyOf("orders.read", "orders.admin"), AllOf("tenant.a", "tenant.b"))
+
+	tests := []struct {
+		policies       []string
+		expectedStatus int
+	}{
+		{[]string{"orders.read", "tenant.a", "tenant.b"}, http.StatusOK},
+		{[]string{"orders.admin", "tenant.a", "tenant.b"}, http.StatusOK},
+		{[]string{"tenant.a", "tenant.b"}, http.StatusForbidden},
+		{[]string{"orders.read", "tenant.a"}, http.StatusForbidden},
+		{nil, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "http://missy.com/orders", nil)
+		r.Header.Set("Authorization", "Bearer "+policyToken(t, test.policies...))
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatus {
+			t.Errorf("policies %v: expected status %d but got %d", test.policies, test.expectedStatus, w.Code)
+		}
+		if test.expectedStatus != http.StatusForbidden {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != contentTypeProblemJSON {
+			t.Errorf("policies %v: expected content type %s but got %s", test.policies, contentTypeProblemJSON, ct)
+		}
+		var problem Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || problem.Status != http.StatusForbidden || problem.Detail == "" {
+			t.Errorf("policies %v: unexpected problem body %s", test.policies, w.Body)
+		}
+	}
+}
+
+func TestSecureHandleWithPolicies_RequiresValidToken(t *testing.T) {
+	s := New("testservice")
+	s.SecureHandleFuncWithPolicies("/orders", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not be called")
+	}, AnyOf("orders.read"))
+
+	r := httptest.NewRequest("GET", "http://missy.com/orders", nil)
+	r.Header.Set("Authorization", "Bearer invalid")
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected the auth handler to reject the token, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestPolicyRequirement_String(t *testing.T) {
+	requirement := PolicyRequirement{AnyOf: []string{"a", "b"}, AllOf: []string{"c"}}
+	if s := requirement.String(); s != "any of [a b] and all of [c]" {
+		t.Errorf("unexpected description %q", s)
+	}
+}
+
+func TestRoutesEndpoint(t *testing.T) {
+	s := New("testservice")
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	s.UnsafeHandleFunc("/public", handler).Methods(http.MethodGet)
+	s.SecureHandleFunc("/private", handler).Methods(http.MethodGet, http.MethodPost)
+	s.SecureHandleFuncWithPolicies("/orders/{id}", handler, AnyOf("orders.read")).Methods(http.MethodGet)
+
+	r := httptest.NewRequest("GET", "http://missy.com/routes", nil)
+	w := httptest.NewRecorder()
+	s.MetricsRouter.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 but got %d", w.Code)
+	}
+
+	var routes []RouteInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 3 {
+		t.Fatalf("expected 3 routes but got %v", routes)
+	}
+	if routes[0].Path != "/public" || routes[0].Secure || len(routes[0].Policies) != 0 {
+		t.Errorf("unexpected public route %+v", routes[0])
+	}
+	if routes[1].Path != "/private" || !routes[1].Secure || len(routes[1].Methods) != 2 {
+		t.Errorf("unexpected secure route %+v", routes[1])
+	}
+	if routes[2].Path != "/orders/{id}" || !routes[2].Secure || len(routes[2].Policies) != 1 || routes[2].Policies[0].AnyOf[0] != "orders.read" {
+		t.Errorf("unexpected route with policies %+v", routes[2])
+	}
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/microdevs/missy/log"
+)
+
+// TokenRevoked is the reason of a failed token validation for tokens rejected by the revocation store
+const TokenRevoked = "revoked"
+
+const defaultRevocationRefreshInterval = time.Second * 10
+
+// ErrTokenRevoked is returned for tokens whose id or subject has been revoked
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+var (
+	revocationStore     RevocationStore
+	revocationStoreMu   sync.RWMutex
+	revocationStoreOnce sync.Once
+)
+
+func init() {
+	Config().RegisterOptionalParameter("TOKEN_REVOCATION_FILE", "", "service.token.revocation.file", "A file with a JSON list of revoked token ids and subjects which are rejected after the token validation")
+	Config().RegisterOptionalParameter("TOKEN_REVOCATION_REFRESH_INTERVAL", defaultRevocationRefreshInterval.String(), "service.token.revocation.refresh.interval", "The time after which the revocation file is read again")
+	Config().Parse()
+}
+
+// Revocation revokes a single token by its jti claim or all tokens of a subject issued up to RevokedAt. A zero
+// RevokedAt revokes all tokens of the subject, tokens without an iat claim are always rejected for a revoked subject.
+type Revocation struct {
+	ID        string    `json:"jti,omitempty"`
+	Subject   string    `json:"sub,omitempty"`
+	RevokedAt time.Time `json:"revoked_at"`
+	// ExpiresAt is the time after which the revocation is dropped, e.g. the expiry of the revoked token. A zero
+	// ExpiresAt keeps the revocation.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// expired checks if the revocation can be dropped
+func (r Revocation) expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && now.After(r.ExpiresAt)
+}
+
+// RevocationStore decides if the claims of a validated token have been revoked
+type RevocationStore interface {
+	Revoked(claims *Claims) bool
+}
+
+// RevocationStores combines several stores, a token is revoked if any of them revoked it
+type RevocationStores []RevocationStore
+
+// Revoked asks all stores
+func (s RevocationStores) Revoked(claims *Claims) bool {
+	for _, store := range s {
+		if store.Revoked(claims) {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryRevocationStore keeps the revocations in memory, expired revocations are dropped when new ones are added
+type MemoryRevocationStore struct {
+	ids      map[string]Revocation
+	subjects map[string]Revocation
+	mu       sync.RWMutex
+}
+
+// NewMemoryRevocationStore returns an empty store
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{ids: make(map[string]Revocation), subjects: make(map[string]Revocation)}
+}
+
+// Revoke adds the revocations, a later revocation of the same subject replaces the earlier one
+func (s *MemoryRevocationStore) Revoke(revocations ...Revocation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.dropExpired(now)
+	addRevocations(s.ids, s.subjects, revocations, now)
+}
+
+// Replace replaces all revocations with the given ones at once, so no revoked token is accepted meanwhile
+func (s *MemoryRevocationStore) Replace(revocations []Revocation) {
+	ids := make(map[string]Revocation)
+	subjects := make(map[string]Revocation)
+	addRevocations(ids, subjects, revocations, time.Now())
+
+	s.mu.Lock()
+	s.ids = ids
+	s.subjects = subjects
+	s.mu.Unlock()
+}
+
+// addRevocations adds the revocations which have not expired to the maps
+func addRevocations(ids map[string]Revocation, subjects map[string]Revocation, revocations []Revocation, now time.Time) {
+	for _, r := range revocations {
+		if r.expired(now) {
+			continue
+		}
+		if r.ID != "" {
+			ids[r.ID] = r
+		}
+		if r.Subject != "" {
+			subjects[r.Subject] = r
+		}
+	}
+}
+
+// Revoked checks the jti and the sub claim against the revocations
+func (s *MemoryRevocationStore) Revoked(claims *Claims) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	if r, ok := s.ids[claims.ID]; ok && claims.ID != "" && !r.expired(now) {
+		return true
+	}
+	r, ok := s.subjects[claims.Subject]
+	if !ok || claims.Subject == "" || r.expired(now) {
+		return false
+	}
+	return r.RevokedAt.IsZero() || claims.IssuedAt.IsZero() || !claims.IssuedAt.After(r.RevokedAt)
+}
+
+// dropExpired removes the expired revocations, the caller holds the lock
+func (s *MemoryRevocationStore) dropExpired(now time.Time) {
+	for id, r := range s.ids {
+		if r.expired(now) {
+			delete(s.ids, id)
+		}
+	}
+	for subject, r := range s.subjects {
+		if r.expired(now) {
+			delete(s.subjects, subject)
+		}
+	}
+}
+
+// FileRevocationStore reads the revocations from a file with a JSON list of revocations, e.g.
+// [{"jti": "4f1g23a12aa"}, {"sub": "user@missy.com", "revoked_at": "2019-03-01T12:00:00Z"}]
+type FileRevocationStore struct {
+	*MemoryRevocationStore
+	path      string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewFileRevocationStore reads the revocations from the file
+func NewFileRevocationStore(path string) (*FileRevocationStore, error) {
+	s := &FileRevocationStore{MemoryRevocationStore: NewMemoryRevocationStore(), path: path, done: make(chan struct{})}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the file again and replaces the revocations, the old revocations are kept if reading fails
+func (s *FileRevocationStore) Reload() error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("cannot read revocations: %v", err)
+	}
+	var revocations []Revocation
+	if err := json.Unmarshal(data, &revocations); err != nil {
+		return fmt.Errorf("cannot parse revocations in %s: %v", s.path, err)
+	}
+	s.Replace(revocations)
+	return nil
+}
+
+// StartRefresh reads the file in the given interval until the store is closed
+func (s *FileRevocationStore) StartRefresh(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Reload(); err != nil {
+					log.Errorf("Unable to reload the token revocations: %v", err)
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops reading the file in the background
+func (s *FileRevocationStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// SetRevocationStore sets the store which is asked for every validated token, e.g. a MemoryRevocationStore fed by
+// messaging.NewRevocationFeed. It replaces the store configured in TOKEN_REVOCATION_FILE, nil disables the check.
+func SetRevocationStore(store RevocationStore) {
+	revocationStoreOnce.Do(func() {})
+	revocationStoreMu.Lock()
+	revocationStore = store
+	revocationStoreMu.Unlock()
+}
+
+// currentRevocationStore returns the store set with SetRevocationStore or configured in TOKEN_REVOCATION_FILE
+func currentRevocationStore() RevocationStore {
+	initRevocation()
+	revocationStoreMu.RLock()
+	defer revocationStoreMu.RUnlock()
+	return revocationStore
+}
+
+// initRevocation sets up the store configured in TOKEN_REVOCATION_FILE once and starts reloading it
+func initRevocation() {
+	revocationStoreOnce.Do(func() {
+		path := Config().Get("service.token.revocation.file")
+		if path == "" {
+			return
+		}
+		store, err := NewFileRevocationStore(path)
+		if err != nil {
+			// the file is read again in the background
+			log.Errorf("Unable to load the token revocations: %v", err)
+			store = &FileRevocationStore{MemoryRevocationStore: NewMemoryRevocationStore(), path: path, done: make(chan struct{})}
+		}
+		interval, err := time.ParseDuration(Config().Get("service.token.revocation.refresh.interval"))
+		if interval <= 0 || err != nil {
+			log.Debugf("Setting token revocation refresh interval to %v, as service.token.revocation.refresh.interval was not a positive duration", defaultRevocationRefreshInterval)
+			interval = defaultRevocationRefreshInterval
+		}
+		store.StartRefresh(interval)
+		revocationStoreMu.Lock()
+		revocationStore = store
+		revocationStoreMu.Unlock()
+	})
+}
+
+// checkRevocation rejects a validated token if the revocation store revoked it
+func checkRevocation(token *jwt.Token) *TokenError {
+	store := currentRevocationStore()
+	if store == nil {
+		return nil
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return &TokenError{Reason: TokenMalformed, Err: fmt.Errorf("unexpected claims type %T", token.Claims)}
+	}
+	if store.Revoked(NewClaims(claims)) {
+		return &TokenError{Reason: TokenRevoked, Err: ErrTokenRevoked}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// revocationToken returns a token signed with the test fixture key
+func revocationToken(t *testing.T, claims jwt.MapClaims) string {
+	data, err := ioutil.ReadFile("test-fixtures/key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryRevocationStore()
+	s.Revoke(
+		Revocation{ID: "token-1"},
+		Revocation{Subject: "disabled@missy.com"},
+		Revocation{Subject: "reset@missy.com", RevokedAt: now},
+		Revocation{ID: "expired", ExpiresAt: now.Add(-time.Minute)},
+	)
+
+	tests := []struct {
+		name     string
+		claims   *Claims
+		expected bool
+	}{
+		{"revoked id", &Claims{ID: "token-1", Subject: "user@missy.com"}, true},
+		{"other id", &Claims{ID: "token-2", Subject: "user@missy.com"}, false},
+		{"revoked subject", &Claims{Subject: "disabled@missy.com", IssuedAt: now.Add(time.Hour)}, true},
+		{"issued before the revocation", &Claims{Subject: "reset@missy.com", IssuedAt: now.Add(-time.Minute)}, true},
+		{"issued after the revocation", &Claims{Subject: "reset@missy.com", IssuedAt: now.Add(time.Minute)}, false},
+		{"no issued at", &Claims{Subject: "reset@missy.com"}, true},
+		{"expired revocation", &Claims{ID: "expired"}, false},
+		{"no id and subject", &Claims{}, false},
+	}
+	for _, test := range tests {
+		if revoked := s.Revoked(test.claims); revoked != test.expected {
+			t.Errorf("%s: expected revoked %t but got %t", test.name, test.expected, revoked)
+		}
+	}
+
+	s.Replace([]Revocation{{ID: "token-2"}})
+	if s.Revoked(&Claims{ID: "token-1"}) || !s.Revoked(&Claims{ID: "token-2"}) {
+		t.Error("expected the revocations to be replaced")
+	}
+}
+
+func TestMemoryRevocationStore_ReplaceKeepsRevocations(t *testing.T) {
+	s := NewMemoryRevocationStore()
+	revocations := []Revocation{{ID: "token-1"}}
+	s.Replace(revocations)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 0; n < 1000; n++ {
+			s.Replace(revocations)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			if !s.Revoked(&Claims{ID: "token-1"}) {
+				t.Fatal("expected the token to stay revoked while the revocations are replaced")
+			}
+		}
+	}
+}
+
+func TestFileRevocationStore(t *testing.T) {
+	file, err := ioutil.TempFile("", "revocations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`[{"jti": "token-1"}, {"sub": "disabled@missy.com", "revoked_at": "2019-03-01T12:00:00Z"}]`)
+	file.Close()
+
+	s, err := NewFileRevocationStore(file.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+	if !s.Revoked(&Claims{ID: "token-1"}) || !s.Revoked(&Claims{Subject: "disabled@missy.com", IssuedAt: time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)}) {
+		t.Error("expected the revocations of the file")
+	}
+
+	ioutil.WriteFile(file.Name(), []byte(`[{"jti": "token-2"}]`), 0600)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Revoked(&Claims{ID: "token-1"}) || !s.Revoked(&Claims{ID: "token-2"}) {
+		t.Error("expected the revocations to be reloaded")
+	}
+
+	ioutil.WriteFile(file.Name(), []byte(`not json`), 0600)
+	if err := s.Reload(); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+	if !s.Revoked(&Claims{ID: "token-2"}) {
+		t.Error("expected the revocations to be kept if the file is invalid")
+	}
+}
+
+func TestAuthHandler_RevokedToken(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	SetRevocationStore(store)
+	defer SetRevocationStore(nil)
+
+	token := revocationToken(t, jwt.MapClaims{"jti": "token-1", "sub": "test@test.de", "iat": time.Now().Add(-time.Minute).Unix()})
+	if w := callWithToken(token); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 before the revocation but got %d", w.Code)
+	}
+
+	for _, r := range []Revocation{{ID: "token-1"}, {Subject: "test@test.de", RevokedAt: time.Now()}} {
+		store.Replace([]Revocation{r})
+		w := callWithToken(token)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Header().Get("WWW-Authenticate"), TokenRevoked) {
+			t.Errorf("%+v: expected 403 with reason %s but got %d %q", r, TokenRevoked, w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	if _, err := ParseClaims(token); err == nil {
+		t.Error("expected ParseClaims to reject a revoked token")
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/microdevs/missy/data"
+)
+
+// RouteInfo describes a route of the service router for the /routes endpoint
+type RouteInfo struct {
+	Path     string              `json:"path"`
+	Methods  []string            `json:"methods,omitempty"`
+	Secure   bool                `json:"secure"`
+	Policies []PolicyRequirement `json:"policies,omitempty"`
+}
+
+// routeSecurity holds the authorization of a route registered with the Handle functions
+type routeSecurity struct {
+	secure   bool
+	policies []PolicyRequirement
+}
+
+// registerRoute remembers the authorization of a route for the introspection
+func (s *Service) registerRoute(route *mux.Route, secure bool, policies []PolicyRequirement) *mux.Route {
+	s.muRoutes.Lock()
+	defer s.muRoutes.Unlock()
+	if s.routes == nil {
+		s.routes = make(map[*mux.Route]routeSecurity)
+	}
+	s.routes[route] = routeSecurity{secure: secure, policies: policies}
+	return route
+}
+
+// Routes returns the routes of the service router with their methods and required policies
+func (s *Service) Routes() []RouteInfo {
+	s.muRoutes.Lock()
+	defer s.muRoutes.Unlock()
+
+	routes := []RouteInfo{}
+	s.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			// routes without path, e.g. only matching a host
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		security := s.routes[route]
+		routes = append(routes, RouteInfo{
+			Path:     path,
+			Methods:  methods,
+			Secure:   security.secure,
+			Policies: security.policies,
+		})
+		return nil
+	})
+	return routes
+}
+
+// routesHandler lists the routes of the service router
+func (s *Service) routesHandler(w http.ResponseWriter, r *http.Request) {
+	data.Marshal(w, r, s.Routes())
+}
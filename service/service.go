@@ -66,6 +66,19 @@ type Service struct {
 	Router        *mux.Router
 	MetricsRouter *mux.Router
 	Stop          chan os.Signal
+	// Authenticator authenticates the requests of secure handlers, defaults to the methods in AUTH_METHODS
+	Authenticator Authenticator
+
+	shutdowners   []Shutdowner
+	muShutdowners sync.Mutex
+
+	routes   map[*mux.Route]routeSecurity
+	muRoutes sync.Mutex
+
+	checks          map[string]Check
+	readinessChecks map[string]Check
+	statuses        map[string]StatusFunc
+	muChecks        sync.Mutex
 
 	StateProbes struct {
 		IsHealthy bool
@@ -77,6 +90,9 @@ type Service struct {
 
 var controllerAddr string
 
+// initCmd is the flag set of the init command which registers the service with the missy controller
+var initCmd = flag.NewFlagSet("init", flag.ExitOnError)
+
 // FlagMissyControllerAddressDefault is a default for the missy-controller url used in the during service initialisation when given the init flag
 const FlagMissyControllerAddressDefault = "http://missy-controller"
 
@@ -89,29 +105,12 @@ const (
 	metricsListenPort = "service.metrics.listen.port"
 )
 
-// init checks for init flag and executes the service registration with the missy controller if applicable
+// init prepares the init flag and registers the service configuration parameters
 func init() {
 
-	initCmd := flag.NewFlagSet("init", flag.ExitOnError)
 	initCmd.StringVar(&controllerAddr, "addr", FlagMissyControllerAddressDefault, FlagMissyControllerUsage)
 	initCmd.StringVar(&controllerAddr, "a", FlagMissyControllerAddressDefault, FlagMissyControllerUsage+" (Shorthand)")
 
-	if len(os.Args) > 1 && os.Args[1] == "init" {
-		initCmd.Parse(os.Args[2:])
-		cjson, jsonErr := json.Marshal(Config())
-		if jsonErr != nil {
-			fmt.Println("Error marshalling config to json.")
-			os.Exit(1)
-		}
-		log.Infof("Registering service %s with MiSSy controller at %s", Config().Name, controllerAddr)
-		_, err := http.Post(controllerAddr+"/registerService", "application/json", bytes.NewReader(cjson))
-		// todo: check response for return status
-		if err != nil {
-			fmt.Printf("Can not reach missy controller: %s", err)
-			os.Exit(1)
-		}
-		os.Exit(0)
-	}
 	//todo: refactor this to LISTEN_ADDRESS
 	config := Config()
 	config.RegisterOptionalParameter("LISTEN_HOST", "0.0.0.0", listenHost, "The address the service listens on")
@@ -120,6 +119,34 @@ func init() {
 	config.Parse()
 }
 
+// registerWithController executes the service registration with the missy controller if the init flag was given.
+// It runs when the service is created rather than in init(), so that parameters registered in the init functions
+// of other packages (e.g. messaging topics) are part of the registered configuration.
+func registerWithController() {
+	if !initCommandGiven() {
+		return
+	}
+	initCmd.Parse(os.Args[2:])
+	cjson, jsonErr := json.Marshal(Config())
+	if jsonErr != nil {
+		fmt.Println("Error marshalling config to json.")
+		os.Exit(1)
+	}
+	log.Infof("Registering service %s with MiSSy controller at %s", Config().Name, controllerAddr)
+	_, err := http.Post(controllerAddr+"/registerService", "application/json", bytes.NewReader(cjson))
+	// todo: check response for return status
+	if err != nil {
+		fmt.Printf("Can not reach missy controller: %s", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// initCommandGiven tells if the program was started with the init command
+func initCommandGiven() bool {
+	return len(os.Args) > 1 && os.Args[1] == "init"
+}
+
 // New returns a new Service object
 func New(name string) *Service {
 
@@ -129,6 +156,7 @@ func New(name string) *Service {
 	}
 	config := Config()
 	config.Name = name
+	registerWithController()
 
 	s := &Service{
 		name:          name,
@@ -155,7 +183,7 @@ func (s *Service) Start() {
 	log.Infof("Listening for metrics on %s:%s ...", s.Host, s.MetricsPort)
 	// set service host and port to listen to
 	listen := s.Host + ":" + s.Port
-	h := &http.Server{Addr: listen, Handler: s.Router}
+	h := &http.Server{Addr: listen, Handler: s.Router, TLSConfig: clientAuthTLSConfig()}
 	// set service metrics host and port to listen to
 	metricsListen := s.Host + ":" + s.MetricsPort
 	m := &http.Server{Addr: metricsListen, Handler: s.MetricsRouter}
@@ -201,6 +229,20 @@ func (s *Service) prepareShutdown(h Server, m Server) {
 	shutdown(h)
 	// shutdown metrics service
 	shutdown(m)
+	// shutdown registered components after all in-flight requests finished
+	s.muShutdowners.Lock()
+	defer s.muShutdowners.Unlock()
+	for _, sd := range s.shutdowners {
+		shutdown(sd)
+	}
+}
+
+// RegisterShutdowner adds a component which is shut down gracefully after the HTTP servers stopped,
+// e.g. an asynchronous messaging writer which still has to deliver buffered messages
+func (s *Service) RegisterShutdowner(sd Shutdowner) {
+	s.muShutdowners.Lock()
+	defer s.muShutdowners.Unlock()
+	s.shutdowners = append(s.shutdowners, sd)
 }
 
 // Shutdown allows to stop the HTTP Server gracefully
@@ -288,6 +330,7 @@ func (s *Service) prepareBeforeStart() {
 	s.MetricsRouter.HandleFunc("/health", s.healthHandler).Methods(http.MethodGet)
 	s.MetricsRouter.HandleFunc("/ready", s.readinessHandler).Methods(http.MethodGet)
 	s.MetricsRouter.HandleFunc("/info", s.infoHandler).Methods(http.MethodGet)
+	s.MetricsRouter.HandleFunc("/routes", s.routesHandler).Methods(http.MethodGet)
 }
 
 // HandleFunc excepts a HanderFunc an converts it to a handler, then registers this handler
@@ -306,29 +349,42 @@ func (s *Service) SecureHandleFunc(pattern string, handler func(http.ResponseWri
 	return s.SecureHandle(pattern, http.HandlerFunc(handler))
 }
 
+// SecureHandleFuncWithPolicies excepts a HanderFunc an converts it to a handler, then registers this handler
+// with the required policies
+func (s *Service) SecureHandleFuncWithPolicies(pattern string, handler func(http.ResponseWriter, *http.Request), policies ...PolicyRequirement) *mux.Route {
+	return s.SecureHandleWithPolicies(pattern, http.HandlerFunc(handler), policies...)
+}
+
 // Handle is a wrapper around the original Go handle func with logging recovery and metrics
 // Deprecated: Developers should use SecureHandle() or UnsafeHandle() explicitly
 func (s *Service) Handle(pattern string, originalHandler http.Handler) *mux.Route {
-	h := s.makeHandler(originalHandler, pattern, false)
-	return s.Router.Handle(pattern, h)
+	h := s.makeHandler(originalHandler, pattern, false, nil)
+	return s.registerRoute(s.Router.Handle(pattern, h), false, nil)
 }
 
 // UnsafeHandle is a wrapper around the original Go handle func with logging recovery and metrics
 func (s *Service) UnsafeHandle(pattern string, originalHandler http.Handler) *mux.Route {
-	h := s.makeHandler(originalHandler, pattern, false)
-	return s.Router.Handle(pattern, h)
+	h := s.makeHandler(originalHandler, pattern, false, nil)
+	return s.registerRoute(s.Router.Handle(pattern, h), false, nil)
 }
 
 // SecureHandle is a wrapper around the original Go handle func with logging recovery and metrics
 func (s *Service) SecureHandle(pattern string, originalHandler http.Handler) *mux.Route {
-	initPublicKey()
-	h := s.makeHandler(originalHandler, pattern, true)
-	return s.Router.Handle(pattern, h)
+	return s.SecureHandleWithPolicies(pattern, originalHandler)
+}
+
+// SecureHandleWithPolicies is SecureHandle for handlers which require policies, a request is rejected with 403
+// unless its token satisfies all of the requirements, e.g. AnyOf("orders.read", "orders.admin")
+func (s *Service) SecureHandleWithPolicies(pattern string, originalHandler http.Handler, policies ...PolicyRequirement) *mux.Route {
+	initTokenKeys()
+	s.authenticator()
+	h := s.makeHandler(originalHandler, pattern, true, policies)
+	return s.registerRoute(s.Router.Handle(pattern, h), true, policies)
 }
 
 // Makes a handler that wraps Missy specific functionality and returns either a secure or insecure chain
-// a secure chain includes the auth handler
-func (s *Service) makeHandler(originalHandler http.Handler, pattern string, secure bool) http.Handler {
+// a secure chain includes the auth handler and the policy handler if policies are required
+func (s *Service) makeHandler(originalHandler http.Handler, pattern string, secure bool, policies []PolicyRequirement) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
@@ -346,7 +402,14 @@ func (s *Service) makeHandler(originalHandler http.Handler, pattern string, secu
 		// call custom handler
 		chain := NewChain(StartTimerHandler, FinalHandler(pattern)).Then(originalHandler)
 		if secure {
-			chain = NewChain(StartTimerHandler, AuthHandler, FinalHandler(pattern)).Then(originalHandler)
+			auth := AuthHandler
+			if a := s.authenticator(); a != nil {
+				auth = AuthenticationHandler(a)
+			}
+			chain = NewChain(StartTimerHandler, auth, FinalHandler(pattern)).Then(originalHandler)
+			if len(policies) > 0 {
+				chain = NewChain(StartTimerHandler, auth, PolicyHandler(policies...), FinalHandler(pattern)).Then(originalHandler)
+			}
 		}
 		chain.ServeHTTP(w, r)
 	})
@@ -2,6 +2,8 @@ package service
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -113,6 +115,29 @@ func TestFailingHandler(t *testing.T) {
 	http.DefaultServeMux = nil
 }
 
+type testShutdowner struct {
+	called bool
+}
+
+func (ts *testShutdowner) Shutdown(ctx context.Context) error {
+	ts.called = true
+	return nil
+}
+
+func TestRegisterShutdowner(t *testing.T) {
+	s := New("test")
+	sd := &testShutdowner{}
+	s.RegisterShutdowner(sd)
+
+	s.Shutdown()
+	s.prepareShutdown(nil, nil)
+
+	if !sd.called {
+		t.Error("Expected registered shutdowner to be shut down")
+	}
+	http.DefaultServeMux = nil
+}
+
 type TLSTest struct {
 	Certfile         string
 	Keyfile          string
@@ -174,3 +199,56 @@ func TestPrepareTLSSuccess(t *testing.T) {
 
 	}
 }
+
+func TestReadinessEndpoint(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://missy/ready", nil)
+	s := New("test")
+	s.RegisterHealthCheck("payments-api", func() error {
+		return errors.New("connection refused")
+	})
+	s.RegisterHealthCheck("database", func() error {
+		return nil
+	})
+	s.RegisterStatus("orders reader", func() string {
+		return "paused"
+	})
+
+	s.MetricsRouter.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Error calling /ready endpoint")
+	}
+
+	expected := "Ready\ncheck database: OK\ncheck payments-api: failed: connection refused\norders reader: paused"
+	if body := w.Body.String(); body != expected {
+		t.Errorf("/ready returned unexpected output, expected %q got %q", expected, body)
+	}
+
+	if err := s.HealthCheck("payments-api")(); err == nil {
+		t.Error("expected the error of the registered check")
+	}
+	if err := s.HealthCheck("unknown")(); err == nil {
+		t.Error("expected an error for a check which is not registered")
+	}
+	http.DefaultServeMux = nil
+}
+
+func TestReadinessEndpoint_FailingReadinessCheck(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://missy/ready", nil)
+	s := New("test")
+	s.RegisterReadinessCheck("kafka topics", func() error {
+		return errors.New("topic orders.v1 does not exist")
+	})
+
+	s.MetricsRouter.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("/ready should fail when a readiness check fails, got %d", w.Code)
+	}
+
+	expected := "Not Ready\ncheck kafka topics: failed: topic orders.v1 does not exist"
+	if body := w.Body.String(); body != expected {
+		t.Errorf("/ready returned unexpected output, expected %q got %q", expected, body)
+	}
+	http.DefaultServeMux = nil
+}
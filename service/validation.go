@@ -0,0 +1,263 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reasons of a failed token validation, they are part of the WWW-Authenticate header and the metrics
+const (
+	TokenMalformed           = "malformed"
+	TokenUnknownKey          = "unknown_key"
+	TokenAlgorithmNotAllowed = "algorithm_not_allowed"
+	TokenInvalidSignature    = "invalid_signature"
+	TokenExpired             = "expired"
+	TokenNotYetValid         = "not_yet_valid"
+	TokenInvalidIssuer       = "invalid_issuer"
+	TokenInvalidAudience     = "invalid_audience"
+	TokenMissingClaim        = "missing_claim"
+)
+
+var tokenValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "missy_token_validation_failures_total",
+	Help: "The number of rejected tokens by reason",
+},
+	[]string{"reason"},
+)
+
+func init() {
+	Config().RegisterOptionalParameter("TOKEN_ALGORITHMS", "", "service.token.algorithms", "Comma separated signing algorithms accepted for tokens, e.g. RS256, empty accepts all algorithms matching the key type")
+	Config().RegisterOptionalParameter("TOKEN_ISSUERS", "", "service.token.issuers", "Comma separated issuers accepted in the iss claim of tokens, empty accepts any issuer")
+	Config().RegisterOptionalParameter("TOKEN_AUDIENCE", "", "service.token.audience", "The audience which has to be in the aud claim of tokens, empty accepts any audience")
+	Config().RegisterOptionalParameter("TOKEN_LEEWAY", "0s", "service.token.leeway", "The clock skew tolerated when checking the exp, nbf and iat claims of tokens")
+	Config().RegisterOptionalParameter("TOKEN_REQUIRED_CLAIMS", "", "service.token.required.claims", "Comma separated claims every token has to contain, e.g. exp,sub")
+	Config().Parse()
+
+	prometheus.MustRegister(tokenValidationFailures)
+}
+
+// TokenError is returned when a token is rejected, Reason is one of the Token* reasons
+type TokenError struct {
+	Reason string
+	Err    error
+}
+
+// Error returns the reason and the cause
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+}
+
+// tokenValidation holds the configured validation options
+type tokenValidation struct {
+	algorithms     []string
+	issuers        []string
+	audience       string
+	leeway         time.Duration
+	requiredClaims []string
+}
+
+// configuredTokenValidation returns the validation options registered in the configuration
+func configuredTokenValidation() tokenValidation {
+	leeway, err := time.ParseDuration(Config().Get("service.token.leeway"))
+	if err != nil || leeway < 0 {
+		leeway = 0
+	}
+	return tokenValidation{
+		algorithms:     splitList(Config().Get("service.token.algorithms")),
+		issuers:        splitList(Config().Get("service.token.issuers")),
+		audience:       strings.TrimSpace(Config().Get("service.token.audience")),
+		leeway:         leeway,
+		requiredClaims: splitList(Config().Get("service.token.required.claims")),
+	}
+}
+
+// validateToken parses a signed token and validates it with the configured options, a failure is counted and
+// returned as *TokenError. Opaque tokens, and all tokens if no keys are configured, are validated with the
+// configured introspection endpoint. Valid tokens are checked against the revocation store.
+func validateToken(rawToken string) (*jwt.Token, *TokenError) {
+	v := configuredTokenValidation()
+	var token *jwt.Token
+	var err *TokenError
+	if introspector != nil && (!isJWT(rawToken) || (jwks == nil && pubkey == nil)) {
+		token, err = v.introspectToken(introspector, rawToken)
+	} else {
+		token, err = v.validate(rawToken, tokenKey)
+	}
+	if err == nil {
+		err = checkRevocation(token)
+	}
+	if err != nil {
+		tokenValidationFailures.WithLabelValues(err.Reason).Inc()
+		return nil, err
+	}
+	return token, nil
+}
+
+// validate parses the token with the keyfunc and checks the claims
+func (v tokenValidation) validate(signedToken string, keyfunc jwt.Keyfunc) (*jwt.Token, *TokenError) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(signedToken, func(t *jwt.Token) (interface{}, error) {
+		if !v.algorithmAllowed(t.Method.Alg()) {
+			return nil, &TokenError{Reason: TokenAlgorithmNotAllowed, Err: fmt.Errorf("algorithm %s is not allowed", t.Method.Alg())}
+		}
+		key, err := keyfunc(t)
+		if err != nil {
+			return nil, &TokenError{Reason: TokenUnknownKey, Err: err}
+		}
+		if !methodMatchesKey(t.Method, key) {
+			return nil, &TokenError{Reason: TokenAlgorithmNotAllowed, Err: fmt.Errorf("algorithm %s does not match the key type %T", t.Method.Alg(), key)}
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, tokenError(err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, &TokenError{Reason: TokenMalformed, Err: fmt.Errorf("unexpected claims type %T", token.Claims)}
+	}
+	if err := v.validateClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// validateClaims checks the time, issuer, audience and required claims
+func (v tokenValidation) validateClaims(claims jwt.MapClaims, now time.Time) *TokenError {
+	for _, name := range v.requiredClaims {
+		if _, ok := claims[name]; !ok {
+			return &TokenError{Reason: TokenMissingClaim, Err: fmt.Errorf("claim %s is missing", name)}
+		}
+	}
+
+	if exp, ok := numericDate(claims, "exp"); ok && now.After(exp.Add(v.leeway)) {
+		return &TokenError{Reason: TokenExpired, Err: fmt.Errorf("token expired at %s", exp)}
+	}
+	if nbf, ok := numericDate(claims, "nbf"); ok && now.Add(v.leeway).Before(nbf) {
+		return &TokenError{Reason: TokenNotYetValid, Err: fmt.Errorf("token is not valid before %s", nbf)}
+	}
+	if iat, ok := numericDate(claims, "iat"); ok && now.Add(v.leeway).Before(iat) {
+		return &TokenError{Reason: TokenNotYetValid, Err: fmt.Errorf("token was issued in the future at %s", iat)}
+	}
+
+	if len(v.issuers) > 0 {
+		iss, _ := claims["iss"].(string)
+		if !contains(v.issuers, iss) {
+			return &TokenError{Reason: TokenInvalidIssuer, Err: fmt.Errorf("issuer %q is not accepted", iss)}
+		}
+	}
+	if v.audience != "" && !contains(audiences(claims), v.audience) {
+		return &TokenError{Reason: TokenInvalidAudience, Err: fmt.Errorf("token is not issued for %s", v.audience)}
+	}
+	return nil
+}
+
+// algorithmAllowed checks the algorithm against the configured algorithms
+func (v tokenValidation) algorithmAllowed(alg string) bool {
+	return len(v.algorithms) == 0 || contains(v.algorithms, alg)
+}
+
+// methodMatchesKey checks that the signing method of a token belongs to the type of the key, so the algorithm
+// declared in a token header cannot select a different kind of verification
+func methodMatchesKey(method jwt.SigningMethod, key interface{}) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		// the curve is part of the algorithm, e.g. ES256 is only valid with P-256
+		if m, ok := method.(*jwt.SigningMethodECDSA); ok {
+			return k.Curve.Params().BitSize == m.CurveBits
+		}
+	case ed25519.PublicKey:
+		_, ok := method.(*SigningMethodEd25519)
+		return ok
+	}
+	return false
+}
+
+// tokenError converts a parse error to a *TokenError
+func tokenError(err error) *TokenError {
+	ve, ok := err.(*jwt.ValidationError)
+	if !ok {
+		return &TokenError{Reason: TokenMalformed, Err: err}
+	}
+	if te, ok := ve.Inner.(*TokenError); ok {
+		return te
+	}
+	switch {
+	case ve.Errors&jwt.ValidationErrorMalformed != 0:
+		return &TokenError{Reason: TokenMalformed, Err: err}
+	case ve.Errors&jwt.ValidationErrorUnverifiable != 0:
+		return &TokenError{Reason: TokenUnknownKey, Err: err}
+	default:
+		return &TokenError{Reason: TokenInvalidSignature, Err: err}
+	}
+}
+
+// writeTokenError rejects a request with 403 and the reason in the WWW-Authenticate header (RFC 6750)
+func writeTokenError(w http.ResponseWriter, err *TokenError) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, err.Reason))
+	http.Error(w, "Unauthorized", http.StatusForbidden)
+}
+
+// numericDate returns a NumericDate claim as time
+func numericDate(claims jwt.MapClaims, name string) (time.Time, bool) {
+	switch v := claims[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// audiences returns the aud claim, which is a string or a list of strings
+func audiences(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var list []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// splitList splits a comma separated config value and drops empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
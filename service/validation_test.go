@@ -0,0 +1,148 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestTokenValidation_Validate(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keyfunc := func(t *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	}
+	now := time.Now().Unix()
+	sign := func(method jwt.SigningMethod, claims jwt.MapClaims) string {
+		var signingKey interface{} = key
+		if method == jwt.SigningMethodHS256 {
+			signingKey = []byte("secret")
+		}
+		s, err := jwt.NewWithClaims(method, claims).SignedString(signingKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	strict := tokenValidation{
+		algorithms:     []string{"RS256"},
+		issuers:        []string{"https://iam.example.com"},
+		audience:       "orders",
+		leeway:         time.Minute,
+		requiredClaims: []string{"sub"},
+	}
+	valid := jwt.MapClaims{"sub": "user-1", "iss": "https://iam.example.com", "aud": []string{"billing", "orders"}, "exp": now + 60}
+
+	tests := []struct {
+		name       string
+		validation tokenValidation
+		token      string
+		reason     string
+	}{
+		{"valid", strict, sign(jwt.SigningMethodRS256, valid), ""},
+		{"within leeway", strict, sign(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "user-1", "iss": "https://iam.example.com", "aud": "orders", "exp": now - 30}), ""},
+		{"expired", strict, sign(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "user-1", "iss": "https://iam.example.com", "aud": "orders", "exp": now - 120}), TokenExpired},
+		{"not yet valid", tokenValidation{}, sign(jwt.SigningMethodRS256, jwt.MapClaims{"nbf": now + 120}), TokenNotYetValid},
+		{"issuer", strict, sign(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "user-1", "iss": "https://evil.example.com", "aud": "orders"}), TokenInvalidIssuer},
+		{"audience", strict, sign(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "user-1", "iss": "https://iam.example.com", "aud": "billing"}), TokenInvalidAudience},
+		{"required claim", strict, sign(jwt.SigningMethodRS256, jwt.MapClaims{"iss": "https://iam.example.com", "aud": "orders"}), TokenMissingClaim},
+		{"algorithm not allowed", strict, sign(jwt.SigningMethodRS512, valid), TokenAlgorithmNotAllowed},
+		{"algorithm does not match key", tokenValidation{}, sign(jwt.SigningMethodHS256, valid), TokenAlgorithmNotAllowed},
+		{"malformed", tokenValidation{}, "not a token", TokenMalformed},
+		{"invalid signature", tokenValidation{}, sign(jwt.SigningMethodRS256, valid)[:20] + "x" + sign(jwt.SigningMethodRS256, valid)[21:], TokenMalformed},
+	}
+	for _, test := range tests {
+		_, err := test.validation.validate(test.token, keyfunc)
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("Expected %s token to be valid, got %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Reason != test.reason {
+			t.Errorf("Expected reason %s for %s token, got %v", test.reason, test.name, err)
+		}
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, valid).SignedString(other)
+	if _, err := strict.validate(forged, keyfunc); err == nil || err.Reason != TokenInvalidSignature {
+		t.Errorf("Expected reason %s for a token signed with another key, got %v", TokenInvalidSignature, err)
+	}
+}
+
+func TestTokenValidation_KeyTypes(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p256Key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPublicKey, edPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name          string
+		method        jwt.SigningMethod
+		signingKey    interface{}
+		verifyingKey  interface{}
+		expectedError string
+	}{
+		{"ES256", jwt.SigningMethodES256, p256Key, &p256Key.PublicKey, ""},
+		{"ES384", jwt.SigningMethodES384, p384Key, &p384Key.PublicKey, ""},
+		{"EdDSA", SigningMethodEdDSA, edPrivateKey, edPublicKey, ""},
+		{"RS256 with an ECDSA key", jwt.SigningMethodRS256, rsaKey, &p256Key.PublicKey, TokenAlgorithmNotAllowed},
+		{"ES256 with an RSA key", jwt.SigningMethodES256, p256Key, &rsaKey.PublicKey, TokenAlgorithmNotAllowed},
+		{"EdDSA with an ECDSA key", SigningMethodEdDSA, edPrivateKey, &p256Key.PublicKey, TokenAlgorithmNotAllowed},
+		{"ES256 with a P-384 key", jwt.SigningMethodES256, p256Key, &p384Key.PublicKey, TokenAlgorithmNotAllowed},
+	}
+
+	for _, test := range tests {
+		signed, err := jwt.NewWithClaims(test.method, jwt.MapClaims{"sub": "test"}).SignedString(test.signingKey)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		_, tokenErr := tokenValidation{}.validate(signed, func(*jwt.Token) (interface{}, error) {
+			return test.verifyingKey, nil
+		})
+		switch {
+		case test.expectedError == "" && tokenErr != nil:
+			t.Errorf("%s: expected a valid token but got %v", test.name, tokenErr)
+		case test.expectedError != "" && (tokenErr == nil || tokenErr.Reason != test.expectedError):
+			t.Errorf("%s: expected reason %s but got %v", test.name, test.expectedError, tokenErr)
+		}
+	}
+}
+
+func TestSecureHandlerAuthReportsReason(t *testing.T) {
+	os.Setenv("TOKEN_ISSUERS", "https://iam.example.com")
+	Config().ParseEnvironment(true)
+	defer func() {
+		os.Unsetenv("TOKEN_ISSUERS")
+		Config().ParseEnvironment(true)
+	}()
+
+	before := countFailures(TokenInvalidIssuer)
+	w := callWithToken(generateSignedTokenString(t))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+	expected := `Bearer error="invalid_token", error_description="invalid_issuer"`
+	if header := w.Header().Get("WWW-Authenticate"); header != expected {
+		t.Errorf("Expected WWW-Authenticate header %s, got %s", expected, header)
+	}
+	if after := countFailures(TokenInvalidIssuer); after != before+1 {
+		t.Errorf("Expected the failure to be counted, got %v instead of %v", after, before+1)
+	}
+}
+
+// countFailures returns the number of failures counted for a reason
+func countFailures(reason string) float64 {
+	var m dto.Metric
+	tokenValidationFailures.WithLabelValues(reason).Write(&m)
+	return m.GetCounter().GetValue()
+}